@@ -2,16 +2,16 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"io"
 	"net"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/josexy/mini-ss/address"
 	"github.com/josexy/mini-ss/bufferpool"
-	"github.com/josexy/mini-ss/options"
 	"github.com/josexy/mini-ss/transport"
 )
 
@@ -28,6 +28,7 @@ type Socks5Client struct {
 	timeout    time.Duration
 	authMethod byte
 	authInfo   *url.Userinfo
+	tlsConfig  *tls.Config
 	buf        []byte
 }
 
@@ -37,7 +38,7 @@ func NewSocks5Client(addr string) *Socks5Client {
 		timeout:    10 * time.Second,
 		authMethod: 0x00,
 		buf:        make([]byte, bufferpool.MaxSocksBufferSize),
-		dialer:     transport.NewDialer(transport.Tcp, options.DefaultOptions),
+		dialer:     transport.DialFunc(transport.DialTCP),
 	}
 }
 
@@ -46,6 +47,11 @@ func (c *Socks5Client) SetSocksAuth(username, password string) {
 	c.authMethod = 0x02
 }
 
+// SetTLSConfig connects to the socks5 proxy server over tls
+func (c *Socks5Client) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+}
+
 func (c *Socks5Client) Close() (err error) {
 	if c.conn != nil {
 		err = c.conn.Close()
@@ -68,7 +74,7 @@ func (c *Socks5Client) Dial(ctx context.Context, addr string) (transport.Conn, e
 }
 
 func (c *Socks5Client) DialUDP(ctx context.Context, addr string) (transport.Conn, error) {
-	bindAddr, err := c.handshake(ctx, addr, 3) // UDP
+	bindAddr, err := c.UDPAssociate(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -76,16 +82,47 @@ func (c *Socks5Client) DialUDP(ctx context.Context, addr string) (transport.Conn
 	if err != nil {
 		return nil, err
 	}
-	ucw, err := newUdpConnWrapper(conn, bindAddr, addr)
+	ucw, err := newUdpConnWrapper(conn, bindAddr.String(), addr)
 	c.udpConn = ucw
 	return ucw, err
 }
 
+// UDPAssociate returns the udp relay address of the proxy server,
+// the association terminates once the client is closed
+func (c *Socks5Client) UDPAssociate(ctx context.Context) (*net.UDPAddr, error) {
+	bindAddr, err := c.handshake(ctx, "0.0.0.0:0", 3) // UDP
+	if err != nil {
+		return nil, err
+	}
+	relayAddr, err := net.ResolveUDPAddr("udp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	// the relay address is the same as the proxy server if unspecified
+	if relayAddr.IP.IsUnspecified() {
+		host, _, _ := net.SplitHostPort(c.Addr)
+		serverAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(relayAddr.Port)))
+		if err != nil {
+			return nil, err
+		}
+		relayAddr = serverAddr
+	}
+	return relayAddr, nil
+}
+
 func (c *Socks5Client) handshake(ctx context.Context, address string, cmd byte) (string, error) {
 	conn, err := c.dialer.Dial(ctx, c.Addr)
 	if err != nil {
 		return "", err
 	}
+	if c.tlsConfig != nil {
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return "", err
+		}
+		conn = tlsConn
+	}
 	c.conn = conn
 	if err = c.negotiate(conn); err != nil {
 		_ = conn.Close()
@@ -116,7 +153,7 @@ func (c *Socks5Client) negotiate(conn net.Conn) error {
 	copy(buf[2:], defaultSupportMethods)
 	conn.Write(buf[:2+len(defaultSupportMethods)])
 
-	_, err := conn.Read(buf)
+	_, err := io.ReadFull(conn, buf[:2])
 	if err != nil {
 		return err
 	}
@@ -159,7 +196,7 @@ func (c *Socks5Client) authentication(conn net.Conn) error {
 	// +----+--------+
 	// | 1  |   1    |
 	// +----+--------+
-	_, err := conn.Read(buf)
+	_, err := io.ReadFull(conn, buf[:2])
 	if err != nil {
 		return err
 	}
@@ -174,16 +211,12 @@ func (c *Socks5Client) authentication(conn net.Conn) error {
 }
 
 func (c *Socks5Client) request(conn net.Conn, target string, cmd byte) (string, error) {
-	var host string
-	var port int
-	hp := strings.Split(target, ":")
-	host = hp[0]
-	// HTTP request
-	if len(hp) == 1 {
-		port = 80
-	} else {
-		port, _ = strconv.Atoi(hp[1])
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		// HTTP request
+		host, portStr = target, "80"
 	}
+	port, _ := strconv.Atoi(portStr)
 
 	// +----+-----+-------+------+----------+----------+
 	// |VER | CMD |  RSV  | ATYP | DST.ADDR | DST.PORT |
@@ -204,7 +237,7 @@ func (c *Socks5Client) request(conn net.Conn, target string, cmd byte) (string,
 	// +----+-----+-------+------+----------+----------+
 	// | 1  |  1  | X'00' |  1   | Variable |    2     |
 	// +----+-----+-------+------+----------+----------+
-	_, err = conn.Read(buf)
+	_, err = io.ReadFull(conn, buf[:3])
 	if err != nil {
 		return "", err
 	}
@@ -212,7 +245,7 @@ func (c *Socks5Client) request(conn net.Conn, target string, cmd byte) (string,
 	if code != 0x00 {
 		return "", errors.New("socks request failure")
 	}
-	bindAddr, err := address.ParseAddressFromBuffer(buf[3:])
+	bindAddr, err := address.ParseAddressFromReader(conn, buf[3:])
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,400 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/util/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTLSConfig(t *testing.T) (server, client *tls.Config) {
+	privateKey, err := cert.GeneratePrivateKey()
+	assert.Nil(t, err)
+	serverCert, err := cert.GenerateCertificate(pkix.Name{CommonName: "proxy.example.com"},
+		[]string{"proxy.example.com"}, nil, nil, nil, privateKey)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return &tls.Config{Certificates: []tls.Certificate{serverCert}},
+		&tls.Config{RootCAs: pool, ServerName: "proxy.example.com"}
+}
+
+func listen(t *testing.T, tlsConfig *tls.Config, serve func(net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func startTcpEchoServer(t *testing.T, banner []byte) string {
+	return listen(t, nil, func(conn net.Conn) {
+		conn.Write(banner)
+		io.Copy(conn, conn)
+	})
+}
+
+func startUdpEchoServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, bufferpool.MaxUdpBufferSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func pipe(dst, src net.Conn, srcReader io.Reader) {
+	go io.Copy(dst, srcReader)
+	io.Copy(src, dst)
+}
+
+// fakeSocks5Server a minimal socks5 server which supports CONNECT and UDP ASSOCIATE
+type fakeSocks5Server struct {
+	user, password string
+	targets        chan string
+}
+
+func startFakeSocks5Server(t *testing.T, user, password string, tlsConfig *tls.Config) (string, *fakeSocks5Server) {
+	s := &fakeSocks5Server{user: user, password: password, targets: make(chan string, 16)}
+	return listen(t, tlsConfig, s.serve), s
+}
+
+func (s *fakeSocks5Server) reply(conn net.Conn, rep byte, bindAddr string) {
+	addr, _ := address.ParseAddress(bindAddr, make([]byte, bufferpool.MaxAddressBufferSize))
+	conn.Write(append([]byte{0x05, rep, 0x00}, addr...))
+}
+
+func (s *fakeSocks5Server) serve(conn net.Conn) {
+	buf := make([]byte, bufferpool.MaxSocksBufferSize)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	method := byte(0x00)
+	if s.user != "" {
+		method = 0x02
+	}
+	if !bytes.Contains(buf[:buf[1]], []byte{method}) {
+		conn.Write([]byte{0x05, 0xff})
+		return
+	}
+	conn.Write([]byte{0x05, method})
+	if method == 0x02 {
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		password := make([]byte, buf[0])
+		io.ReadFull(conn, password)
+		if string(user) != s.user || string(password) != s.password {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	}
+
+	if _, err := io.ReadFull(conn, buf[:3]); err != nil {
+		return
+	}
+	cmd := buf[1]
+	addr, err := address.ParseAddressFromReader(conn, buf[3:])
+	if err != nil {
+		return
+	}
+	s.targets <- addr.String()
+	switch cmd {
+	case 0x01:
+		dst, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			s.reply(conn, 0x05, "0.0.0.0:0")
+			return
+		}
+		defer dst.Close()
+		s.reply(conn, 0x00, dst.LocalAddr().String())
+		pipe(conn, dst, dst)
+	case 0x03:
+		relay, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		// the unspecified relay address is replaced with the proxy server address by the client
+		port := relay.LocalAddr().(*net.UDPAddr).Port
+		s.reply(conn, 0x00, net.JoinHostPort("0.0.0.0", strconv.Itoa(port)))
+		go func() {
+			io.Copy(io.Discard, conn)
+			relay.Close()
+		}()
+		s.relayUDP(relay)
+	default:
+		s.reply(conn, 0x07, "0.0.0.0:0")
+	}
+}
+
+func (s *fakeSocks5Server) relayUDP(relay net.PacketConn) {
+	var client net.Addr
+	buf := make([]byte, bufferpool.MaxUdpBufferSize)
+	for {
+		n, from, err := relay.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if client == nil || from.String() == client.String() {
+			client = from
+			addr, err := address.ParseAddressFromBuffer(buf[3:n])
+			if err != nil {
+				continue
+			}
+			target, err := net.ResolveUDPAddr("udp", addr.String())
+			if err != nil {
+				continue
+			}
+			relay.WriteTo(buf[3+len(addr):n], target)
+			continue
+		}
+		addr, _ := address.ParseAddress(from.String(), make([]byte, bufferpool.MaxAddressBufferSize))
+		relay.WriteTo(append(append([]byte{0x00, 0x00, 0x00}, addr...), buf[:n]...), client)
+	}
+}
+
+// startFakeHttpProxy a minimal http proxy server which supports CONNECT,
+// the banner is sent in the same segment as the response
+func startFakeHttpProxy(t *testing.T, user, password string, tlsConfig *tls.Config, banner []byte) string {
+	return listen(t, tlsConfig, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect {
+			conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		if user != "" && req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)) {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		dst, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		defer dst.Close()
+		conn.Write(append([]byte("HTTP/1.1 200 Connection established\r\n\r\n"), banner...))
+		pipe(dst, conn, br)
+	})
+}
+
+func assertStreamEcho(t *testing.T, conn net.Conn, banner []byte) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	expected := append(append([]byte(nil), banner...), "hello world"...)
+	_, err := conn.Write([]byte("hello world"))
+	assert.Nil(t, err)
+	got := make([]byte, len(expected))
+	_, err = io.ReadFull(conn, got)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, got)
+}
+
+func TestSocks5ClientDial(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfig(t)
+	target := startTcpEchoServer(t, nil)
+	tests := []struct {
+		name           string
+		user, password string
+		serverTLS      *tls.Config
+		clientTLS      *tls.Config
+		target         string
+	}{
+		{name: "no-auth", target: target},
+		{name: "auth", user: "user", password: "pass", target: target},
+		{name: "tls", user: "user", password: "pass", serverTLS: serverTLS, clientTLS: clientTLS, target: target},
+		{name: "domain", target: net.JoinHostPort("localhost", portOf(target))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, server := startFakeSocks5Server(t, tt.user, tt.password, tt.serverTLS)
+			cli := NewSocks5Client(addr)
+			if tt.user != "" {
+				cli.SetSocksAuth(tt.user, tt.password)
+			}
+			cli.SetTLSConfig(tt.clientTLS)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := cli.Dial(ctx, tt.target)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer cli.Close()
+			// the domain name is resolved by the proxy server
+			assert.Equal(t, tt.target, <-server.targets)
+			assert.Equal(t, tt.target, conn.RemoteAddr().String())
+			assertStreamEcho(t, conn, nil)
+		})
+	}
+}
+
+func portOf(addr string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
+
+func TestSocks5ClientDialFailure(t *testing.T) {
+	addr, _ := startFakeSocks5Server(t, "user", "pass", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := NewSocks5Client(addr)
+	cli.SetSocksAuth("user", "wrong")
+	_, err := cli.Dial(ctx, startTcpEchoServer(t, nil))
+	assert.EqualError(t, err, "socks authentication failure")
+
+	// the port of the closed listener is refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ln.Close()
+	cli = NewSocks5Client(addr)
+	cli.SetSocksAuth("user", "pass")
+	_, err = cli.Dial(ctx, ln.Addr().String())
+	assert.EqualError(t, err, "socks request failure")
+
+	// the tls handshake fails against the plain server
+	_, clientTLS := newTestTLSConfig(t)
+	cli = NewSocks5Client(addr)
+	cli.SetTLSConfig(clientTLS)
+	_, err = cli.Dial(ctx, ln.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestSocks5ClientUDPAssociate(t *testing.T) {
+	addr, server := startFakeSocks5Server(t, "user", "pass", nil)
+	target := startUdpEchoServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := NewSocks5Client(addr)
+	cli.SetSocksAuth("user", "pass")
+	relayAddr, err := cli.UDPAssociate(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "0.0.0.0:0", <-server.targets)
+	assert.Equal(t, "127.0.0.1", relayAddr.IP.String())
+	assert.NotZero(t, relayAddr.Port)
+	assert.Nil(t, cli.Close())
+
+	cli = NewSocks5Client(addr)
+	cli.SetSocksAuth("user", "pass")
+	conn, err := cli.DialUDP(ctx, target)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer cli.Close()
+	assert.Equal(t, target, conn.RemoteAddr().String())
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for _, payload := range []string{"hello", "world"} {
+		_, err = conn.Write([]byte(payload))
+		assert.Nil(t, err)
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, string(buf[:n]))
+	}
+}
+
+func TestHttpClientDial(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfig(t)
+	target := startTcpEchoServer(t, nil)
+	tests := []struct {
+		name           string
+		user, password string
+		serverTLS      *tls.Config
+		clientTLS      *tls.Config
+		banner         []byte
+	}{
+		{name: "no-auth"},
+		{name: "auth", user: "user", password: "pass"},
+		{name: "tls", user: "user", password: "pass", serverTLS: serverTLS, clientTLS: clientTLS},
+		{name: "buffered", banner: []byte("welcome\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := NewHttpClient(startFakeHttpProxy(t, tt.user, tt.password, tt.serverTLS, tt.banner))
+			if tt.user != "" {
+				cli.SetHttpAuth(tt.user, tt.password)
+			}
+			cli.SetTLSConfig(tt.clientTLS)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := cli.Dial(ctx, target)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer conn.Close()
+			assert.Equal(t, target, conn.RemoteAddr().String())
+			// the data buffered with the response is read first
+			assertStreamEcho(t, conn, tt.banner)
+		})
+	}
+}
+
+func TestHttpClientDialFailure(t *testing.T) {
+	addr := startFakeHttpProxy(t, "user", "pass", nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := NewHttpClient(addr)
+	_, err := cli.Dial(ctx, startTcpEchoServer(t, nil))
+	assert.ErrorContains(t, err, "407 Proxy Authentication Required")
+
+	cli.SetHttpAuth("user", "wrong")
+	_, err = cli.Dial(ctx, startTcpEchoServer(t, nil))
+	assert.ErrorContains(t, err, "407 Proxy Authentication Required")
+
+	cli.SetHttpAuth("user", "pass")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ln.Close()
+	_, err = cli.Dial(ctx, ln.Addr().String())
+	assert.ErrorContains(t, err, "502 Bad Gateway")
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"net"
+	"net/netip"
 
 	"github.com/josexy/mini-ss/address"
 	"github.com/josexy/mini-ss/bufferpool"
@@ -12,10 +13,17 @@ type tcpConnWrapper struct {
 	remoteAddr net.Addr // target address
 }
 
+// targetAddr the unresolved target address, since the domain name is resolved by the proxy server
+type targetAddr string
+
+func (a targetAddr) Network() string { return "tcp" }
+
+func (a targetAddr) String() string { return string(a) }
+
 func newTcpConnWrapper(conn net.Conn, target string) (*tcpConnWrapper, error) {
-	addr, err := net.ResolveTCPAddr("tcp", target)
-	if err != nil {
-		return nil, err
+	var addr net.Addr = targetAddr(target)
+	if addrPort, err := netip.ParseAddrPort(target); err == nil {
+		addr = net.TCPAddrFromAddrPort(addrPort)
 	}
 	return &tcpConnWrapper{
 		Conn:       conn,
@@ -28,7 +36,8 @@ func (c *tcpConnWrapper) RemoteAddr() net.Addr {
 }
 
 func (c *tcpConnWrapper) TCP() *net.TCPConn {
-	return c.Conn.(*net.TCPConn)
+	conn, _ := c.Conn.(*net.TCPConn)
+	return conn
 }
 
 func (c *tcpConnWrapper) UDP() *net.UDPConn {
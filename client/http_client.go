@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/josexy/mini-ss/connection"
+	"github.com/josexy/mini-ss/transport"
+)
+
+// HttpClient tunnels the tcp connections through the http proxy server with the CONNECT method
+type HttpClient struct {
+	dialer    transport.Dialer
+	Addr      string
+	timeout   time.Duration
+	authInfo  *url.Userinfo
+	tlsConfig *tls.Config
+}
+
+func NewHttpClient(addr string) *HttpClient {
+	return &HttpClient{
+		Addr:    addr,
+		timeout: 10 * time.Second,
+		dialer:  transport.DialFunc(transport.DialTCP),
+	}
+}
+
+func (c *HttpClient) SetHttpAuth(username, password string) {
+	c.authInfo = url.UserPassword(username, password)
+}
+
+// SetTLSConfig connects to the http proxy server over tls
+func (c *HttpClient) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+}
+
+func (c *HttpClient) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := c.dialer.Dial(ctx, c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	tcw, err := c.connect(conn, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tcw, nil
+}
+
+func (c *HttpClient) connect(conn net.Conn, addr string) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	req.Header.Set("Proxy-Connection", "Keep-Alive")
+	if c.authInfo != nil {
+		password, _ := c.authInfo.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(c.authInfo.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http proxy connect failure: %s", rsp.Status)
+	}
+	// the data sent by the target server may be buffered already
+	if n := br.Buffered(); n > 0 {
+		data, _ := br.Peek(n)
+		conn = connection.NewConnWithReader(conn, bytes.NewReader(data))
+	}
+	return newTcpConnWrapper(conn, addr)
+}
@@ -36,13 +36,17 @@ func init() {
 	localCmd.Flags().StringVarP(&cfg.Local.HTTPAddr, "http", "x", "", "HTTP proxy listening address")
 	localCmd.Flags().StringVar(&cfg.Local.SocksAuth, "socks-auth", "", "SOCKS proxy authentication (format: \"user:password\")")
 	localCmd.Flags().StringVar(&cfg.Local.HTTPAuth, "http-auth", "", "HTTP proxy authentication (format: \"user:password\")")
+	localCmd.Flags().StringSliceVar(&cfg.Local.Users, "users", nil, "SOCKS and HTTP proxy users, replace the socks-auth and http-auth (format: \"user:password\")")
+	localCmd.Flags().StringVar(&cfg.Local.UsersFile, "users-file", "", "SOCKS and HTTP proxy users file in htpasswd format with bcrypt passwords, reloaded by SIGHUP")
 	localCmd.Flags().StringVarP(&cfg.Local.MixedAddr, "mixed", "M", "", "mixed proxy for SOCKS and HTTP")
 	localCmd.Flags().StringSliceVar(&cfg.Local.TCPTunAddr, "tcp-tun", nil, "simple tcp tun listening address (format: \"local:port=remote:port\")")
+	localCmd.Flags().StringVar(&cfg.Local.RedirAddr, "redir", "", "transparent proxy listening address for REDIRECT tcp (linux-only)")
+	localCmd.Flags().StringVar(&cfg.Local.TProxyAddr, "tproxy", "", "transparent proxy listening address for TPROXY tcp and udp (linux-only)")
 	localCmd.Flags().BoolVar(&cfg.Local.SystemProxy, "system-proxy", false, "enable system proxy settings")
 	localCmd.Flags().BoolVar(&cfg.Local.LookupHostsFile, "lookup-hostsfile", false, "dns lookup local hosts file")
 
 	// ssr
-	localCmd.Flags().StringVarP(&cfg.Server[0].Type, "type", "T", "", "enable shadowsocksr")
+	localCmd.Flags().StringVarP(&cfg.Server[0].Type, "type", "T", "", "server type (ssr, trojan, socks5, http)")
 	localCmd.Flags().StringVarP(&cfg.Server[0].SSR.Protocol, "ssr-protocol", "O", "origin", "ssr protocol plugin")
 	localCmd.Flags().StringVarP(&cfg.Server[0].SSR.ProtocolParam, "ssr-protocol-param", "G", "", "ssr protocol param")
 	localCmd.Flags().StringVarP(&cfg.Server[0].SSR.Obfs, "ssr-obfs", "o", "plain", "ssr obfs plugin")
@@ -52,6 +56,7 @@ func init() {
 	localCmd.Flags().BoolVar(&cfg.Local.Tun.Enable, "tun-enable", false, "enable the local tun device, administrator privileges are required")
 	localCmd.Flags().StringVar(&cfg.Local.Tun.Name, "tun-name", "utun9", "tun interface name")
 	localCmd.Flags().StringVar(&cfg.Local.Tun.Cidr, "tun-cidr", "198.18.0.1/16", "tun interface cidr")
+	localCmd.Flags().StringVar(&cfg.Local.Tun.Cidr6, "tun-cidr6", "", "tun interface ipv6 cidr for fake ipv6 addresses (e.g. fdfe:dcba:9876::1/64)")
 	localCmd.Flags().IntVar(&cfg.Local.Tun.Mtu, "tun-mtu", enhancer.DefaultMTU, "tun interface mtu")
 	localCmd.Flags().StringSliceVar(&cfg.Local.Tun.DnsHijack, "tun-dns-hijack", nil, "tun dns hijack")
 	localCmd.Flags().BoolVar(&cfg.Local.Tun.AutoRoute, "tun-dns-auto-route", true, "tun auto route configured")
@@ -59,7 +64,9 @@ func init() {
 	// fake dns mode
 	localCmd.Flags().StringVar(&cfg.Local.DNS.Listen, "fake-dns-listen", ":53", "fake-dns listening address")
 	localCmd.Flags().StringSliceVar(&cfg.Local.DNS.Nameservers, "fake-dns-nameservers", resolver.DefaultDnsNameservers, "fake-dns nameservers")
-	localCmd.Flags().StringSliceVar(&cfg.Local.DNS.DomainFilter, "fake-dns-domain-filter", nil, "fake-dns domain filter")
+	localCmd.Flags().StringSliceVar(&cfg.Local.DNS.DomainFilter, "fake-dns-domain-filter", nil, "fake-dns domain filter, supports *.lan, +.local, suffix:, keyword: and regex: entries")
+	localCmd.Flags().StringVar(&cfg.Local.DNS.DomainFilterFile, "fake-dns-domain-filter-file", "", "fake-dns domain filter list file, one entry per line")
+	localCmd.Flags().StringVar(&cfg.Local.DNS.FakeIPStore, "fake-dns-store", "", "fake-dns file to persist the fake ip records across restarts")
 	localCmd.Flags().BoolVar(&cfg.Local.DNS.DisableRewrite, "fake-dns-disable-rewrite", false, "fake-dns disable to rewrite dns to system config file")
 
 	// mitm mode
@@ -95,8 +102,13 @@ func startLocal() {
 	}()
 
 	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-interrupt
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	// reload the inbound users on SIGHUP
+	for sig := <-interrupt; sig == syscall.SIGHUP; sig = <-interrupt {
+		if err := srv.ReloadUsers(); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+	}
 
 	srv.Close()
 	time.Sleep(time.Millisecond * 300)
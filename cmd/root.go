@@ -28,12 +28,17 @@ var (
 	configFile string
 	cfg        = &config.Config{
 		Server: []*config.ServerConfig{{
-			Ws:   &config.WsOption{},
-			Quic: &config.QuicOption{},
-			Obfs: &config.ObfsOption{},
-			Grpc: &config.GrpcOption{},
-			Ssh:  &config.SshOption{},
-			SSR:  &config.SSROption{},
+			Tcp:   &config.TcpOption{},
+			Ws:    &config.WsOption{},
+			Quic:  &config.QuicOption{},
+			Kcp:   &config.KcpOption{},
+			Obfs:  &config.ObfsOption{},
+			Grpc:  &config.GrpcOption{},
+			Ssh:   &config.SshOption{},
+			Http2: &config.Http2Option{},
+			SSR:   &config.SSROption{},
+			Mux:   &config.MuxOption{},
+			Bind:  &config.BindOption{},
 		}},
 		Local: &config.LocalConfig{
 			Mitm: &config.MitmOption{},
@@ -68,10 +73,16 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Log.Color, "color", "C", false, "enable output color mode")
 	rootCmd.PersistentFlags().StringVarP(&cfg.Log.LogLevel, "level", "L", "info", "log level (trace, debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().IntVarP(&cfg.Log.VerboseLevel, "verbose-level", "V", 1, "verbose output level (0, 1, 2, 3)")
+	// tcp options
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Tcp.FastOpen, "tcp-fast-open", false, "enable tcp fast open for the default transport (only linux)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Tcp.Multipath, "mptcp", false, "enable multipath tcp for the default transport (only linux)")
 	// websocket options
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.Host, "ws-host", "www.baidu.com", "websocket host")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.Path, "ws-path", "/ws", "websocket request path")
 	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Ws.Compress, "ws-compress", false, "enable data compression")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.UserAgent, "ws-user-agent", "", "websocket user agent")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Ws.MaxEarlyData, "ws-max-early-data", 0, "the max size of the early data sent within the handshake (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.EarlyDataHeader, "ws-early-data-header", "", "the header which carries the early data, or \"path\" (default Sec-WebSocket-Protocol)")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.TLS.Mode, "ws-tls-mode", "", "ws tls mode(wss://) (tls, mtls)")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.TLS.KeyPath, "ws-tls-key", "", "ws tls key path")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.TLS.CertPath, "ws-tls-cert", "", "ws tls cert path")
@@ -79,6 +90,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ws.TLS.Hostname, "ws-tls-host", "", "ws tls common name")
 	// obfs options
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Obfs.Host, "obfs-host", "www.baidu.com", "obfs host")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Obfs.Mode, "obfs-mode", "http", "obfs mode (http, tls)")
 	// quic options
 	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Quic.Conns, "quic-max-conn", 3, "maximum number of quic connections")
 	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Quic.KeepAlive, "quic-keepalive", 0, "quic connection keep alive")
@@ -89,9 +101,28 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Quic.TLS.CertPath, "quic-tls-cert", "", "quic tls cert path")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Quic.TLS.CAPath, "quic-tls-ca", "", "quic tls ca path")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Quic.TLS.Hostname, "quic-tls-host", "", "quic tls common name")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Quic.Datagram, "quic-datagram", false, "relay udp packets with quic datagrams")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Quic.Migrate, "quic-migrate", false, "migrate quic connections to the new network instead of redialling them (client-only)")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.Server[0].Quic.StreamReceiveWindow, "quic-stream-window", 0, "quic initial stream receive window in bytes")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.Server[0].Quic.MaxStreamReceiveWindow, "quic-max-stream-window", 0, "quic max stream receive window in bytes")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.Server[0].Quic.ConnReceiveWindow, "quic-conn-window", 0, "quic initial connection receive window in bytes")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.Server[0].Quic.MaxConnReceiveWindow, "quic-max-conn-window", 0, "quic max connection receive window in bytes")
+	// kcp options
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.Mtu, "kcp-mtu", 1350, "kcp mtu")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.SndWnd, "kcp-sndwnd", 1024, "kcp send window size")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.RcvWnd, "kcp-rcvwnd", 1024, "kcp receive window size")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Kcp.NoDelay, "kcp-nodelay", true, "kcp nodelay mode")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.Interval, "kcp-interval", 20, "kcp update interval in milliseconds")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.Resend, "kcp-resend", 2, "kcp fast resend (0 disables)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Kcp.NoCongestion, "kcp-nc", true, "disable kcp congestion control")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.DataShards, "kcp-datashard", 10, "kcp fec data shards")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Kcp.ParityShards, "kcp-parityshard", 3, "kcp fec parity shards (0 disables fec)")
 	// grpc options
 	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Grpc.SendBufferSize, "grpc-send-buf", 0, "grpc send buffer size")
 	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Grpc.RecvBufferSize, "grpc-recv-buf", 0, "grpc recv buffer size")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Grpc.ServiceName, "grpc-service-name", "", "grpc service name (compatible with Xray's gun)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Grpc.Mode, "grpc-mode", "gun", "grpc mode (gun, multi)")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Grpc.Conns, "grpc-conns", 1, "maximum number of grpc connections")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Grpc.TLS.Mode, "grpc-tls-mode", "", "grpc tls mode (tls, mtls)")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Grpc.TLS.KeyPath, "grpc-tls-key", "", "grpc tls key path")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Grpc.TLS.CertPath, "grpc-tls-cert", "", "grpc tls cert path")
@@ -103,9 +134,28 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ssh.PrivateKey, "ssh-prikey", "", "ssh private key")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ssh.PublicKey, "ssh-pubkey", "", "ssh public key (only used for client)")
 	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Ssh.AuthorizedKey, "ssh-authorizedkey", "", "ssh authorized key (only used for server)")
+	// http2 options
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.Host, "http2-host", "www.baidu.com", "http2 host")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.Path, "http2-path", "/h2", "http2 request path (only used for POST)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.Method, "http2-method", "POST", "http2 request method (CONNECT, POST)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.TLS.Mode, "http2-tls-mode", "", "http2 tls mode (tls, mtls)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.TLS.KeyPath, "http2-tls-key", "", "http2 tls key path")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.TLS.CertPath, "http2-tls-cert", "", "http2 tls cert path")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.TLS.CAPath, "http2-tls-ca", "", "http2 tls ca path")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Http2.TLS.Hostname, "http2-tls-host", "", "http2 tls common name")
+	// mux options
+	rootCmd.PersistentFlags().BoolVar(&cfg.Server[0].Mux.Enable, "mux", false, "enable stream multiplexing (tcp, ws, obfs, kcp)")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Mux.Conns, "mux-conns", 2, "maximum number of mux connections")
+	rootCmd.PersistentFlags().IntVar(&cfg.Server[0].Mux.MaxStreams, "mux-max-streams", 64, "maximum number of streams per mux connection")
+	// SIP003 plugin
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Plugin, "plugin", "", "SIP003 plugin, such as v2ray-plugin")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].PluginOpts, "plugin-opts", "", "SIP003 plugin options")
 	// interface
 	rootCmd.PersistentFlags().StringVar(&cfg.Iface, "iface", "", "bind outbound interface")
 	rootCmd.PersistentFlags().BoolVar(&cfg.AutoDetectIface, "auto-detect-iface", false, "enable auto-detect interface")
+	rootCmd.PersistentFlags().IntVar(&cfg.RoutingMark, "routing-mark", 0, "the SO_MARK of all the outbound sockets (only linux)")
+	rootCmd.PersistentFlags().StringVar(&cfg.IPPrefer, "ip-prefer", "ipv6", "the address family which is dialed first (ipv6, ipv4)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Server[0].Bind.SourceIP, "source-ip", "", "the source ip of the connections to ss-server")
 }
 
 func initConfig() {
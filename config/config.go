@@ -23,14 +23,26 @@ type TlsOption struct {
 }
 
 type WsOption struct {
-	Path     string    `yaml:"path" json:"path"`
-	Host     string    `yaml:"host,omitempty" json:"host,omitempty"`
-	Compress bool      `yaml:"compress,omitempty" json:"compress,omitempty"`
-	TLS      TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
+	Path      string            `yaml:"path" json:"path"`
+	Host      string            `yaml:"host,omitempty" json:"host,omitempty"`
+	Compress  bool              `yaml:"compress,omitempty" json:"compress,omitempty"`
+	UserAgent string            `yaml:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// the first data up to the size is sent within the handshake request, only used for client
+	MaxEarlyData int `yaml:"max_early_data,omitempty" json:"max_early_data,omitempty"`
+	// the header which carries the early data, Sec-WebSocket-Protocol by default, or "path" to append it to the path on both sides
+	EarlyDataHeader string    `yaml:"early_data_header,omitempty" json:"early_data_header,omitempty"`
+	TLS             TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
+type TcpOption struct {
+	FastOpen  bool `yaml:"fast_open,omitempty" json:"fast_open,omitempty"` // only supported on linux
+	Multipath bool `yaml:"mptcp,omitempty" json:"mptcp,omitempty"`         // only supported on linux
 }
 
 type ObfsOption struct {
 	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"` // http (default) or tls
 }
 
 type QuicOption struct {
@@ -39,14 +51,46 @@ type QuicOption struct {
 	MaxIdleTimeout       int       `yaml:"max_idle_timeout" json:"max_idle_timeout"`
 	HandshakeIdleTimeout int       `yaml:"handshake_idle_timeout" json:"handshake_idle_timeout"`
 	TLS                  TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// relay the udp packets with the quic datagrams, both sides must enable it
+	Datagram bool `yaml:"datagram,omitempty" json:"datagram,omitempty"`
+	// migrate the client connections to the new network instead of redialling them
+	Migrate bool `yaml:"migrate,omitempty" json:"migrate,omitempty"`
+	// the flow control windows in bytes, the quic-go defaults are used if not set
+	StreamReceiveWindow    uint64 `yaml:"stream_receive_window,omitempty" json:"stream_receive_window,omitempty"`
+	MaxStreamReceiveWindow uint64 `yaml:"max_stream_receive_window,omitempty" json:"max_stream_receive_window,omitempty"`
+	ConnReceiveWindow      uint64 `yaml:"conn_receive_window,omitempty" json:"conn_receive_window,omitempty"`
+	MaxConnReceiveWindow   uint64 `yaml:"max_conn_receive_window,omitempty" json:"max_conn_receive_window,omitempty"`
+}
+
+// KcpOption the mtu and the fec shards must be the same for both sides, the defaults are used if not set
+type KcpOption struct {
+	Mtu          int  `yaml:"mtu,omitempty" json:"mtu,omitempty"`
+	SndWnd       int  `yaml:"sndwnd,omitempty" json:"sndwnd,omitempty"`
+	RcvWnd       int  `yaml:"rcvwnd,omitempty" json:"rcvwnd,omitempty"`
+	NoDelay      bool `yaml:"nodelay" json:"nodelay"`
+	Interval     int  `yaml:"interval,omitempty" json:"interval,omitempty"` // milliseconds
+	Resend       int  `yaml:"resend" json:"resend"`
+	NoCongestion bool `yaml:"nc" json:"nc"`
+	DataShards   int  `yaml:"datashard" json:"datashard"`
+	ParityShards int  `yaml:"parityshard" json:"parityshard"`
 }
 
 type GrpcOption struct {
 	SendBufferSize int       `yaml:"send_buffer_size,omitempty" json:"send_buffer_size,omitempty"`
 	RecvBufferSize int       `yaml:"receive_buffer_size,omitempty" json:"receive_buffer_size,omitempty"`
+	ServiceName    string    `yaml:"service_name,omitempty" json:"service_name,omitempty"` // compatible with Xray's gun service
+	Mode           string    `yaml:"mode,omitempty" json:"mode,omitempty"`                 // gun (default) or multi
+	Conns          int       `yaml:"conns,omitempty" json:"conns,omitempty"`               // only used for client
 	TLS            TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
 }
 
+type Http2Option struct {
+	Host   string    `yaml:"host,omitempty" json:"host,omitempty"`
+	Path   string    `yaml:"path,omitempty" json:"path,omitempty"`
+	Method string    `yaml:"method,omitempty" json:"method,omitempty"`
+	TLS    TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
+
 type SshOption struct {
 	User          string `yaml:"user" json:"user"`
 	Password      string `yaml:"password" json:"password"`
@@ -63,36 +107,89 @@ type SSROption struct {
 }
 
 type ServerConfig struct {
-	Disable   bool        `yaml:"disable,omitempty" json:"disable,omitempty"`
-	Type      string      `yaml:"type,omitempty" json:"type,omitempty"`
-	Name      string      `yaml:"name" json:"name"`
-	Addr      string      `yaml:"addr" json:"addr"`
-	Password  string      `yaml:"password" json:"password"`
-	Method    string      `yaml:"method" json:"method"`
-	Transport string      `yaml:"transport" json:"transport"`
-	Udp       bool        `yaml:"udp,omitempty" json:"udp,omitempty"`
-	Ws        *WsOption   `yaml:"ws,omitempty" json:"ws,omitempty"`
-	Obfs      *ObfsOption `yaml:"obfs,omitempty" json:"obfs,omitempty"`
-	Quic      *QuicOption `yaml:"quic,omitempty" json:"quic,omitempty"`
-	Grpc      *GrpcOption `yaml:"grpc,omitempty" json:"grpc,omitempty"`
-	Ssh       *SshOption  `yaml:"ssh,omitempty" json:"ssh,omitempty"`
-	SSR       *SSROption  `yaml:"ssr,omitempty" json:"ssr,omitempty"`
+	Disable     bool          `yaml:"disable,omitempty" json:"disable,omitempty"`
+	Type        string        `yaml:"type,omitempty" json:"type,omitempty"`
+	Name        string        `yaml:"name" json:"name"`
+	Addr        string        `yaml:"addr" json:"addr"`
+	Username    string        `yaml:"username,omitempty" json:"username,omitempty"` // only used for socks5 and http
+	Password    string        `yaml:"password" json:"password"`
+	Method      string        `yaml:"method" json:"method"`
+	Transport   string        `yaml:"transport" json:"transport"`
+	Udp         bool          `yaml:"udp,omitempty" json:"udp,omitempty"`
+	Tcp         *TcpOption    `yaml:"tcp,omitempty" json:"tcp,omitempty"`
+	Ws          *WsOption     `yaml:"ws,omitempty" json:"ws,omitempty"`
+	Obfs        *ObfsOption   `yaml:"obfs,omitempty" json:"obfs,omitempty"`
+	Quic        *QuicOption   `yaml:"quic,omitempty" json:"quic,omitempty"`
+	Kcp         *KcpOption    `yaml:"kcp,omitempty" json:"kcp,omitempty"`
+	Grpc        *GrpcOption   `yaml:"grpc,omitempty" json:"grpc,omitempty"`
+	Ssh         *SshOption    `yaml:"ssh,omitempty" json:"ssh,omitempty"`
+	Http2       *Http2Option  `yaml:"http2,omitempty" json:"http2,omitempty"`
+	SSR         *SSROption    `yaml:"ssr,omitempty" json:"ssr,omitempty"`
+	Mux         *MuxOption    `yaml:"mux,omitempty" json:"mux,omitempty"`
+	Trojan      *TrojanOption `yaml:"trojan,omitempty" json:"trojan,omitempty"`
+	TLS         *TlsOption    `yaml:"tls,omitempty" json:"tls,omitempty"`                   // only used for socks5 and http
+	DialerProxy string        `yaml:"dialer_proxy,omitempty" json:"dialer_proxy,omitempty"` // the node which this node is dialed through
+	Chain       []string      `yaml:"chain,omitempty" json:"chain,omitempty"`               // the nodes which this node is dialed through in order, prior to dialer_proxy
+	Plugin      string        `yaml:"plugin,omitempty" json:"plugin,omitempty"`             // SIP003 plugin, such as v2ray-plugin
+	PluginOpts  string        `yaml:"plugin_opts,omitempty" json:"plugin_opts,omitempty"`
+	Bind        *BindOption   `yaml:"bind,omitempty" json:"bind,omitempty"` // the outbound bind of the connections to this node
+	// the options of the transport registered with RegisterTransport
+	TransportOpts map[string]any `yaml:"transport_opts,omitempty" json:"transport_opts,omitempty"`
+}
+
+type BindOption struct {
+	Interface   string `yaml:"interface,omitempty" json:"interface,omitempty"`
+	SourceIP    string `yaml:"source_ip,omitempty" json:"source_ip,omitempty"`
+	RoutingMark int    `yaml:"routing_mark,omitempty" json:"routing_mark,omitempty"` // SO_MARK, only supported on linux
+}
+
+type TrojanOption struct {
+	// the tls mode defaults to tls, "none" disables it when the transport already provides tls
+	TLS      TlsOption `yaml:"tls,omitempty" json:"tls,omitempty"`
+	Fallback string    `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+}
+
+type MuxOption struct {
+	Enable     bool `yaml:"enable" json:"enable"`
+	Conns      int  `yaml:"conns,omitempty" json:"conns,omitempty"`
+	MaxStreams int  `yaml:"max_streams,omitempty" json:"max_streams,omitempty"`
 }
 
 type TunOption struct {
 	Enable    bool     `yaml:"enable" json:"enable"`
 	Name      string   `yaml:"name" json:"name"`
 	Cidr      string   `yaml:"cidr" json:"cidr"`
+	Cidr6     string   `yaml:"cidr6,omitempty" json:"cidr6,omitempty"`
 	Mtu       int      `yaml:"mtu" json:"mtu"`
 	AutoRoute bool     `yaml:"auto_route" json:"auto_route"`
 	DnsHijack []string `yaml:"dns_hijack,omitempty" json:"dns_hijack,omitempty"`
 }
 
 type DnsOption struct {
-	Listen         string   `yaml:"listen" json:"listen"`
-	DomainFilter   []string `yaml:"domain_filter" json:"domain_filter"`
-	Nameservers    []string `yaml:"nameservers" json:"nameservers"`
-	DisableRewrite bool     `yaml:"disable_rewrite" json:"disable_rewrite"`
+	Listen             string                `yaml:"listen" json:"listen"`
+	DomainFilter       []string              `yaml:"domain_filter" json:"domain_filter"`
+	DomainFilterFile   string                `yaml:"domain_filter_file,omitempty" json:"domain_filter_file,omitempty"`
+	Nameservers        []string              `yaml:"nameservers" json:"nameservers"`
+	DisableRewrite     bool                  `yaml:"disable_rewrite" json:"disable_rewrite"`
+	FakeIPStore        string                `yaml:"fakeip_store,omitempty" json:"fakeip_store,omitempty"`
+	Hosts              map[string]HostsValue `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	ClientSubnetPolicy map[string]string     `yaml:"client_subnet_policy,omitempty" json:"client_subnet_policy,omitempty"`
+}
+
+// HostsValue an ip address, a list of ip addresses or an alias domain
+type HostsValue []string
+
+func (v *HostsValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = HostsValue{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*v = values
+	return nil
 }
 
 type MitmFakeCertPool struct {
@@ -114,8 +211,12 @@ type LocalConfig struct {
 	HTTPAddr        string      `yaml:"http_addr,omitempty" json:"http_addr,omitempty"`
 	SocksAuth       string      `yaml:"socks_auth,omitempty" json:"socks_auth,omitempty"`
 	HTTPAuth        string      `yaml:"http_auth,omitempty" json:"http_auth,omitempty"`
+	Users           []string    `yaml:"users,omitempty" json:"users,omitempty"`           // "user:password" with a non-empty password, replace the socks_auth and http_auth
+	UsersFile       string      `yaml:"users_file,omitempty" json:"users_file,omitempty"` // htpasswd-style file with bcrypt passwords, reloaded by SIGHUP
 	MixedAddr       string      `yaml:"mixed_addr,omitempty" json:"mixed_addr,omitempty"`
 	TCPTunAddr      []string    `yaml:"tcp_tun_addr,omitempty" json:"tcp_tun_addr,omitempty"`
+	RedirAddr       string      `yaml:"redir_addr,omitempty" json:"redir_addr,omitempty"`   // linux-only, REDIRECT tcp
+	TProxyAddr      string      `yaml:"tproxy_addr,omitempty" json:"tproxy_addr,omitempty"` // linux-only, TPROXY tcp and udp
 	SystemProxy     bool        `yaml:"system_proxy,omitempty" json:"system_proxy,omitempty"`
 	LookupHostsFile bool        `yaml:"lookup_hostsfile,omitempty" json:"lookup_hostsfile,omitempty"`
 	Mitm            *MitmOption `yaml:"mitm,omitempty" json:"mitm,omitempty"`
@@ -183,6 +284,9 @@ type Config struct {
 	Log             *LogConfig      `yaml:"log,omitempty" json:"log,omitempty"`
 	Iface           string          `yaml:"iface,omitempty" json:"iface,omitempty"`
 	AutoDetectIface bool            `yaml:"auto_detect_iface,omitempty" json:"auto_detect_iface,omitempty"`
+	RoutingMark     int             `yaml:"routing_mark,omitempty" json:"routing_mark,omitempty"` // the default SO_MARK of all the outbound sockets, only supported on linux
+	DirectBind      *BindOption     `yaml:"direct_bind,omitempty" json:"direct_bind,omitempty"`   // the outbound bind of the direct connections
+	IPPrefer        string          `yaml:"ip_prefer,omitempty" json:"ip_prefer,omitempty"`       // the address family which is dialed first (ipv6, ipv4)
 	Rules           *Rules          `yaml:"rules,omitempty" json:"rules,omitempty"`
 }
 
@@ -323,10 +427,20 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 		var opts []ss.SSOption
 
 		switch opt.Transport {
-		case "ws":
+		case "ws", "websocket":
 			opts = append(opts, ss.WithWsTransport())
 			opts = append(opts, ss.WithWsHost(opt.Ws.Host))
 			opts = append(opts, ss.WithWsPath(opt.Ws.Path))
+			opts = append(opts, ss.WithWsUserAgent(opt.Ws.UserAgent))
+			opts = append(opts, ss.WithWsHeaders(opt.Ws.Headers))
+			switch opt.Ws.EarlyDataHeader {
+			case "":
+				opts = append(opts, ss.WithWsEarlyData(opt.Ws.MaxEarlyData, options.DefaultWsOptions.EarlyDataHeader))
+			case "path":
+				opts = append(opts, ss.WithWsEarlyData(opt.Ws.MaxEarlyData, ""))
+			default:
+				opts = append(opts, ss.WithWsEarlyData(opt.Ws.MaxEarlyData, opt.Ws.EarlyDataHeader))
+			}
 			opts = append(opts, ss.WithWsCertPath(opt.Ws.TLS.CertPath))
 			opts = append(opts, ss.WithWsKeyPath(opt.Ws.TLS.KeyPath))
 			opts = append(opts, ss.WithWsCAPath(opt.Ws.TLS.CAPath))
@@ -343,6 +457,12 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 		case "obfs":
 			opts = append(opts, ss.WithObfsTransport())
 			opts = append(opts, ss.WithObfsHost(opt.Obfs.Host))
+			switch opt.Obfs.Mode {
+			case "tls":
+				opts = append(opts, ss.WithObfsMode(options.ObfsTLS))
+			default:
+				opts = append(opts, ss.WithObfsMode(options.ObfsHTTP))
+			}
 		case "quic":
 			opts = append(opts, ss.WithQuicTransport())
 			opts = append(opts, ss.WithQuicConns(opt.Quic.Conns))
@@ -359,9 +479,24 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 			case "mtls":
 				opts = append(opts, ss.WithQuicTLS(options.MTLS))
 			}
+			opts = append(opts, ss.WithQuicDatagram(opt.Quic.Datagram))
+			opts = append(opts, ss.WithQuicMigrate(opt.Quic.Migrate))
+			opts = append(opts, ss.WithQuicStreamReceiveWindow(opt.Quic.StreamReceiveWindow, opt.Quic.MaxStreamReceiveWindow))
+			opts = append(opts, ss.WithQuicConnReceiveWindow(opt.Quic.ConnReceiveWindow, opt.Quic.MaxConnReceiveWindow))
+		case "kcp":
+			opts = append(opts, ss.WithKcpTransport())
+			if opt.Kcp != nil {
+				opts = append(opts, ss.WithKcpMtu(opt.Kcp.Mtu))
+				opts = append(opts, ss.WithKcpWindowSize(opt.Kcp.SndWnd, opt.Kcp.RcvWnd))
+				opts = append(opts, ss.WithKcpNoDelay(opt.Kcp.NoDelay, time.Millisecond*time.Duration(opt.Kcp.Interval), opt.Kcp.Resend, opt.Kcp.NoCongestion))
+				opts = append(opts, ss.WithKcpFEC(opt.Kcp.DataShards, opt.Kcp.ParityShards))
+			}
 		case "grpc":
 			opts = append(opts, ss.WithGrpcTransport())
 			opts = append(opts, ss.WithGrpcSndRevBuffer(opt.Grpc.SendBufferSize, opt.Grpc.RecvBufferSize))
+			opts = append(opts, ss.WithGrpcServiceName(opt.Grpc.ServiceName))
+			opts = append(opts, ss.WithGrpcMulti(opt.Grpc.Mode == "multi"))
+			opts = append(opts, ss.WithGrpcConns(opt.Grpc.Conns))
 			opts = append(opts, ss.WithGrpcCertPath(opt.Grpc.TLS.CertPath))
 			opts = append(opts, ss.WithGrpcKeyPath(opt.Grpc.TLS.KeyPath))
 			opts = append(opts, ss.WithGrpcCAPath(opt.Grpc.TLS.CAPath))
@@ -372,6 +507,21 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 			case "mtls":
 				opts = append(opts, ss.WithGrpcTLS(options.MTLS))
 			}
+		case "http2":
+			opts = append(opts, ss.WithHttp2Transport())
+			opts = append(opts, ss.WithHttp2Host(opt.Http2.Host))
+			opts = append(opts, ss.WithHttp2Path(opt.Http2.Path))
+			opts = append(opts, ss.WithHttp2Method(opt.Http2.Method))
+			opts = append(opts, ss.WithHttp2CertPath(opt.Http2.TLS.CertPath))
+			opts = append(opts, ss.WithHttp2KeyPath(opt.Http2.TLS.KeyPath))
+			opts = append(opts, ss.WithHttp2CAPath(opt.Http2.TLS.CAPath))
+			opts = append(opts, ss.WithHttp2Hostname(opt.Http2.TLS.Hostname))
+			switch opt.Http2.TLS.Mode {
+			case "tls":
+				opts = append(opts, ss.WithHttp2TLS(options.TLS))
+			case "mtls":
+				opts = append(opts, ss.WithHttp2TLS(options.MTLS))
+			}
 		case "ssh":
 			opts = append(opts, ss.WithSshTransport())
 			opts = append(opts, ss.WithSshUser(opt.Ssh.User))
@@ -379,7 +529,12 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 			opts = append(opts, ss.WithSshPrivateKey(opt.Ssh.PrivateKey))
 			opts = append(opts, ss.WithSshPublicKey(opt.Ssh.PublicKey))
 			opts = append(opts, ss.WithSshAuthorizedKey(opt.Ssh.AuthorizedKey))
-		case "default":
+		case "default", "tcp":
+			opts = append(opts, ss.WithDefaultTransport())
+			if opt.Tcp != nil {
+				opts = append(opts, ss.WithTcpFastOpen(opt.Tcp.FastOpen))
+				opts = append(opts, ss.WithTcpMultipath(opt.Tcp.Multipath))
+			}
 			// whether to support ssr
 			if opt.Type == "ssr" {
 				opts = append(opts, ss.WithEnableSSR())
@@ -388,6 +543,13 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 				opts = append(opts, ss.WithSSRObfs(opt.SSR.Obfs))
 				opts = append(opts, ss.WithObfsParam(opt.SSR.ObfsParam))
 			}
+		case "":
+		default:
+			typ, transportOpts, err := decodeTransport(opt.Transport, opt.TransportOpts)
+			if err != nil {
+				logger.Logger.Fatalf("server %q: %s", opt.Name, err)
+			}
+			opts = append(opts, ss.WithTransport(typ, transportOpts))
 		}
 
 		// default name
@@ -396,6 +558,63 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 		opts = append(opts, ss.WithMethod(opt.Method))
 		opts = append(opts, ss.WithPassword(opt.Password))
 		opts = append(opts, ss.WithUDPRelay(opt.Udp))
+		switch opt.Type {
+		case "trojan":
+			trojan := opt.Trojan
+			if trojan == nil {
+				trojan = &TrojanOption{}
+			}
+			opts = append(opts, ss.WithTrojan())
+			opts = append(opts, ss.WithTrojanCertPath(trojan.TLS.CertPath))
+			opts = append(opts, ss.WithTrojanKeyPath(trojan.TLS.KeyPath))
+			opts = append(opts, ss.WithTrojanCAPath(trojan.TLS.CAPath))
+			opts = append(opts, ss.WithTrojanHostname(trojan.TLS.Hostname))
+			opts = append(opts, ss.WithTrojanFallback(trojan.Fallback))
+			switch trojan.TLS.Mode {
+			case "none":
+				opts = append(opts, ss.WithTrojanTLS(options.None))
+			case "mtls":
+				opts = append(opts, ss.WithTrojanTLS(options.MTLS))
+			}
+		case "socks5", "http":
+			if opt.Type == "socks5" {
+				opts = append(opts, ss.WithSocks5Upstream())
+			} else {
+				opts = append(opts, ss.WithHttpUpstream())
+			}
+			opts = append(opts, ss.WithUpstreamUsername(opt.Username))
+			if opt.TLS != nil {
+				opts = append(opts, ss.WithUpstreamCertPath(opt.TLS.CertPath))
+				opts = append(opts, ss.WithUpstreamKeyPath(opt.TLS.KeyPath))
+				opts = append(opts, ss.WithUpstreamCAPath(opt.TLS.CAPath))
+				opts = append(opts, ss.WithUpstreamHostname(opt.TLS.Hostname))
+				switch opt.TLS.Mode {
+				case "tls":
+					opts = append(opts, ss.WithUpstreamTLS(options.TLS))
+				case "mtls":
+					opts = append(opts, ss.WithUpstreamTLS(options.MTLS))
+				}
+			}
+		}
+		if opt.Mux != nil && opt.Mux.Enable {
+			opts = append(opts, ss.WithMux())
+			opts = append(opts, ss.WithMuxConns(opt.Mux.Conns))
+			opts = append(opts, ss.WithMuxMaxStreams(opt.Mux.MaxStreams))
+		}
+		if opt.Plugin != "" {
+			opts = append(opts, ss.WithPlugin(opt.Plugin))
+			opts = append(opts, ss.WithPluginOpts(opt.PluginOpts))
+		}
+		if len(opt.Chain) > 0 {
+			opts = append(opts, ss.WithChain(opt.Chain...))
+		} else if opt.DialerProxy != "" {
+			opts = append(opts, ss.WithDialerProxy(opt.DialerProxy))
+		}
+		if opt.Bind != nil {
+			opts = append(opts, ss.WithBindInterface(opt.Bind.Interface))
+			opts = append(opts, ss.WithBindSourceIP(opt.Bind.SourceIP))
+			opts = append(opts, ss.WithBindRoutingMark(opt.Bind.RoutingMark))
+		}
 
 		res = append(res, ss.WithServerCompose(opts...))
 	}
@@ -404,6 +623,18 @@ func (cfg *Config) BuildServerOptions() []ss.SSOption {
 	res = append(res, ss.WithOutboundInterface(cfg.Iface))
 	// auto detect interface
 	res = append(res, ss.WithAutoDetectInterface(cfg.AutoDetectIface))
+	// routing mark
+	res = append(res, ss.WithRoutingMark(cfg.RoutingMark))
+	// happy eyeballs
+	switch cfg.IPPrefer {
+	case "ipv4":
+		res = append(res, ss.WithIPPreference(options.PreferIPv4))
+	default:
+		res = append(res, ss.WithIPPreference(options.PreferIPv6))
+	}
+	if cfg.DirectBind != nil {
+		res = append(res, ss.WithDirectBind(cfg.DirectBind.Interface, cfg.DirectBind.SourceIP, cfg.DirectBind.RoutingMark))
+	}
 	return res
 }
 
@@ -424,6 +655,14 @@ func (cfg *Config) BuildLocalOptions() []ss.SSOption {
 			opts = append(opts, ss.WithHttpUserInfo(splitAuthInfo(cfg.Local.HTTPAuth)))
 		}
 	}
+	if len(cfg.Local.Users) > 0 || cfg.Local.UsersFile != "" {
+		users := make(map[string]string, len(cfg.Local.Users))
+		for _, user := range cfg.Local.Users {
+			username, password := splitAuthInfo(user)
+			users[username] = password
+		}
+		opts = append(opts, ss.WithUsers(users, cfg.Local.UsersFile))
+	}
 
 	// simple tcp tun address
 	var tcpTunAddr [][]string
@@ -432,6 +671,12 @@ func (cfg *Config) BuildLocalOptions() []ss.SSOption {
 		tcpTunAddr = append(tcpTunAddr, lr)
 	}
 	opts = append(opts, ss.WithTcpTunAddr(tcpTunAddr))
+	if cfg.Local.RedirAddr != "" {
+		opts = append(opts, ss.WithRedirAddr(cfg.Local.RedirAddr))
+	}
+	if cfg.Local.TProxyAddr != "" {
+		opts = append(opts, ss.WithTProxyAddr(cfg.Local.TProxyAddr))
+	}
 	opts = append(opts, ss.WithRuler(cfg.BuildRuler()))
 
 	if cfg.Local.Mitm != nil && cfg.Local.Mitm.Enable {
@@ -454,6 +699,9 @@ func (cfg *Config) BuildLocalOptions() []ss.SSOption {
 		opts = append(opts, ss.WithEnableTun())
 		opts = append(opts, ss.WithTunName(cfg.Local.Tun.Name))
 		opts = append(opts, ss.WithTunCIDR(cfg.Local.Tun.Cidr))
+		if cfg.Local.Tun.Cidr6 != "" {
+			opts = append(opts, ss.WithTunCIDR(cfg.Local.Tun.Cidr6))
+		}
 		opts = append(opts, ss.WithTunMTU(uint32(cfg.Local.Tun.Mtu)))
 		opts = append(opts, ss.WithTunDnsHijack(cfg.Local.Tun.DnsHijack))
 		opts = append(opts, ss.WithTunAutoRoute(cfg.Local.Tun.AutoRoute))
@@ -462,6 +710,16 @@ func (cfg *Config) BuildLocalOptions() []ss.SSOption {
 		opts = append(opts, ss.WithFakeDnsServer(cfg.Local.DNS.Listen))
 		opts = append(opts, ss.WithFakeDnsDisableRewrite(cfg.Local.DNS.DisableRewrite))
 		opts = append(opts, ss.WithFakeDnsDomainFilter(cfg.Local.DNS.DomainFilter))
+		if cfg.Local.DNS.DomainFilterFile != "" {
+			opts = append(opts, ss.WithFakeDnsDomainFilterFile(cfg.Local.DNS.DomainFilterFile))
+		}
+		opts = append(opts, ss.WithFakeDnsStore(cfg.Local.DNS.FakeIPStore))
+		for host, values := range cfg.Local.DNS.Hosts {
+			opts = append(opts, ss.WithHosts(host, values))
+		}
+		for domain, subnet := range cfg.Local.DNS.ClientSubnetPolicy {
+			opts = append(opts, ss.WithDnsClientSubnetPolicy(domain, subnet))
+		}
 		opts = append(opts, ss.WithDefaultDnsNameservers(cfg.Local.DNS.Nameservers))
 	}
 
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/server"
+	"github.com/josexy/mini-ss/transport"
+	"gopkg.in/yaml.v3"
+)
+
+// TransportDecoder decodes the transport_opts of the server config into the transport options,
+// the unmarshal function decodes them into a struct with the yaml tags
+type TransportDecoder func(unmarshal func(any) error) (options.Options, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = make(map[transport.Type]TransportDecoder)
+)
+
+// RegisterTransport registers the transport which is implemented out of the core,
+// so that it can be used by the name in the `transport` field of the server config.
+// The transport_opts are ignored if the decoder is nil.
+func RegisterTransport(name string, newDialer transport.DialerFactory, newServer server.Factory, decode TransportDecoder) (transport.Type, error) {
+	// check the server factory before the transport is registered, the registration can't be undone
+	if newServer == nil {
+		return 0, errors.New("server factory must not be empty")
+	}
+	typ, err := transport.Register(name, newDialer)
+	if err != nil {
+		return 0, err
+	}
+	if err = server.Register(typ, newServer); err != nil {
+		return 0, err
+	}
+	if decode != nil {
+		decodersMu.Lock()
+		decoders[typ] = decode
+		decodersMu.Unlock()
+	}
+	return typ, nil
+}
+
+func decodeTransport(name string, transportOpts map[string]any) (transport.Type, options.Options, error) {
+	typ, ok := transport.ParseType(name)
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown transport %q", name)
+	}
+	decodersMu.RLock()
+	decode, ok := decoders[typ]
+	decodersMu.RUnlock()
+	if !ok {
+		return typ, nil, nil
+	}
+	opts, err := decode(func(v any) error {
+		data, err := yaml.Marshal(transportOpts)
+		if err != nil {
+			return err
+		}
+		return yaml.Unmarshal(data, v)
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("decode %s transport options: %w", name, err)
+	}
+	return typ, opts, nil
+}
@@ -0,0 +1,142 @@
+package config_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/config"
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/server"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixOptions the dummy transport sends the prefix before the payload
+type prefixOptions struct {
+	Prefix string `yaml:"prefix"`
+}
+
+func (opts *prefixOptions) Update() {}
+
+func newPrefixDialer(opt options.Options) transport.Dialer {
+	prefix := opt.(*prefixOptions).Prefix
+	return transport.DialFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = conn.Write([]byte(prefix)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// prefixHandler checks the prefix before serving the connections with the handler
+type prefixHandler struct {
+	server.Handler
+	prefix string
+}
+
+func (h prefixHandler) ServeTCP(conn net.Conn) {
+	buf := make([]byte, len(h.prefix))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != h.prefix {
+		return
+	}
+	h.Handler.ServeTCP(conn)
+}
+
+func newPrefixServer(addr string, handler server.Handler, opt options.Options) server.Server {
+	return server.NewTcpServer(addr, prefixHandler{Handler: handler, prefix: opt.(*prefixOptions).Prefix}, server.Tcp, nil)
+}
+
+func decodePrefixOptions(unmarshal func(any) error) (options.Options, error) {
+	opts := &prefixOptions{}
+	if err := unmarshal(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// echoHandler echoes the connections of all the transports
+type echoHandler struct{}
+
+func (echoHandler) echo(conn net.Conn) { io.Copy(conn, conn) }
+
+func (h echoHandler) ServeTCP(conn net.Conn)   { h.echo(conn) }
+func (h echoHandler) ServeWS(conn net.Conn)    { h.echo(conn) }
+func (h echoHandler) ServeOBFS(conn net.Conn)  { h.echo(conn) }
+func (h echoHandler) ServeQUIC(conn net.Conn)  { h.echo(conn) }
+func (h echoHandler) ServeGRPC(conn net.Conn)  { h.echo(conn) }
+func (h echoHandler) ServeSSH(conn net.Conn)   { h.echo(conn) }
+func (h echoHandler) ServeHTTP2(conn net.Conn) { h.echo(conn) }
+func (h echoHandler) ServeKCP(conn net.Conn)   { h.echo(conn) }
+
+func TestRegisterTransport(t *testing.T) {
+	typ, err := config.RegisterTransport("prefix", newPrefixDialer, newPrefixServer, decodePrefixOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, "prefix", typ.String())
+
+	// the transport is selected by the name of the transport field
+	decoded, opts, err := config.DecodeTransport("prefix", map[string]any{"prefix": "hello-prefix"})
+	assert.Nil(t, err)
+	assert.Equal(t, typ, decoded)
+	assert.Equal(t, &prefixOptions{Prefix: "hello-prefix"}, opts)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	srv, err := server.New(decoded, addr, echoHandler{}, opts)
+	assert.Nil(t, err)
+	go srv.Start(context.Background())
+	defer srv.Close()
+
+	dialer, err := transport.NewDialer(decoded, opts)
+	assert.Nil(t, err)
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		if conn, err = dialer.Dial(context.Background(), addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("hello"))
+	assert.Nil(t, err)
+	buf := make([]byte, len("hello"))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestRegisterTransportDuplicate(t *testing.T) {
+	typ, err := config.RegisterTransport("duplicate", newPrefixDialer, newPrefixServer, nil)
+	assert.Nil(t, err)
+	_, err = config.RegisterTransport("duplicate", newPrefixDialer, newPrefixServer, nil)
+	assert.NotNil(t, err)
+	_, err = config.RegisterTransport("ws", newPrefixDialer, newPrefixServer, nil)
+	assert.NotNil(t, err)
+
+	// the server factories can't be replaced including the built-in ones
+	assert.NotNil(t, server.Register(typ, newPrefixServer))
+	assert.NotNil(t, server.Register(transport.Tcp, newPrefixServer))
+	assert.NotNil(t, server.Register(transport.Websocket, newPrefixServer))
+
+	// the transport options are ignored without the decoder
+	_, opts, err := config.DecodeTransport("duplicate", map[string]any{"prefix": "ignored"})
+	assert.Nil(t, err)
+	assert.Nil(t, opts)
+
+	_, _, err = config.DecodeTransport("missing", nil)
+	assert.NotNil(t, err)
+}
@@ -29,6 +29,27 @@ func (c *ConnWithReader) Read(b []byte) (int, error) {
 	return c.reader.Read(b)
 }
 
+// ConnWithPrefix sends the prefix along with the first written data,
+// so that they can be carried by the same packet, such as the SYN of tcp fast open
+type ConnWithPrefix struct {
+	net.Conn
+	prefix []byte
+}
+
+func NewConnWithPrefix(conn net.Conn, prefix []byte) *ConnWithPrefix {
+	return &ConnWithPrefix{Conn: conn, prefix: prefix}
+}
+
+func (c *ConnWithPrefix) Write(b []byte) (int, error) {
+	if c.prefix == nil {
+		return c.Conn.Write(b)
+	}
+	buf := append(c.prefix[:len(c.prefix):len(c.prefix)], b...)
+	c.prefix = nil
+	n, err := c.Conn.Write(buf)
+	return max(n-(len(buf)-len(b)), 0), err
+}
+
 type BufioConn struct {
 	net.Conn
 	r *bufio.Reader
@@ -39,3 +60,5 @@ func NewBufioConn(c net.Conn) *BufioConn { return &BufioConn{Conn: c, r: bufio.N
 func (c *BufioConn) Peek(n int) ([]byte, error) { return c.r.Peek(n) }
 
 func (c *BufioConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *BufioConn) ReadByte() (byte, error) { return c.r.ReadByte() }
@@ -1,7 +1,10 @@
 package connection
 
 import (
+	"bytes"
+	"context"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/josexy/mini-ss/connection/proto"
@@ -18,34 +21,145 @@ Generate golang code from proto buffer file:
 
 var _ net.Conn = (*GrpcStreamConn)(nil)
 
+const grpcLegacyServiceName = "proto.StreamService"
+
+// GrpcServiceMethods the method names of the stream in single and multi mode, the gun naming of Xray is used
+// unless the service name is empty
+func GrpcServiceMethods(serviceName string) (service, tun, tunMulti string) {
+	if serviceName == "" {
+		return grpcLegacyServiceName, "Transfer", "TransferMulti"
+	}
+	return serviceName, "Tun", "TunMulti"
+}
+
 type grpcStream interface {
 	SendMsg(interface{}) error
 	RecvMsg(interface{}) error
 }
 
+const (
+	// the max size of the queued writes of the multi mode, the writes are blocked if exceeded
+	grpcMaxPendingSize = 256 << 10
+	// the timeout of sending the queued writes on close
+	grpcFlushTimeout = 5 * time.Second
+)
+
+// grpcMultiWriter sends the writes which are queued while the previous message is being sent
+// in one MultiPacketData message, so that the small writes share the per-message overhead
+type grpcMultiWriter struct {
+	stream  grpcStream
+	msg     *proto.MultiPacketData
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending [][]byte
+	size    int
+	sending bool
+	err     error
+}
+
+func newGrpcMultiWriter(stream grpcStream) *grpcMultiWriter {
+	w := &grpcMultiWriter{stream: stream, msg: new(proto.MultiPacketData)}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// Write queues the data, the error of sending the previous messages is returned
+func (w *grpcMultiWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.err == nil && w.size >= grpcMaxPendingSize {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.pending = append(w.pending, bytes.Clone(b))
+	w.size += len(b)
+	if !w.sending {
+		w.sending = true
+		go w.send()
+	}
+	return len(b), nil
+}
+
+func (w *grpcMultiWriter) send() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 && w.err == nil {
+		batch := w.pending
+		w.pending, w.size = nil, 0
+		w.cond.Broadcast()
+		w.mu.Unlock()
+		w.msg.Reset()
+		w.msg.Data = batch
+		err := w.stream.SendMsg(w.msg)
+		w.mu.Lock()
+		if err != nil {
+			w.err = err
+		}
+	}
+	w.sending = false
+	w.cond.Broadcast()
+}
+
+// flush waits until the queued writes are sent
+func (w *grpcMultiWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.sending {
+		w.cond.Wait()
+	}
+	return w.err
+}
+
 type grpcStreamReaderWriter struct {
 	grpcStream
-	reqMsg *proto.PacketData
-	rspMsg *proto.PacketData
-	rbuf   []byte // remaining buffer data
+	multi       bool
+	reqMsg      *proto.PacketData
+	rspMsg      *proto.PacketData
+	multiWriter *grpcMultiWriter
+	multiRspMsg *proto.MultiPacketData
+	rbuf        []byte   // remaining buffer data
+	rbufs       [][]byte // remaining chunks of the multi message
 }
 
-func newGrpcStreamReaderWriter(stream grpcStream) *grpcStreamReaderWriter {
-	return &grpcStreamReaderWriter{
-		grpcStream: stream,
-		reqMsg:     new(proto.PacketData),
-		rspMsg:     new(proto.PacketData),
+func newGrpcStreamReaderWriter(stream grpcStream, multi bool) *grpcStreamReaderWriter {
+	rw := &grpcStreamReaderWriter{grpcStream: stream, multi: multi}
+	if multi {
+		rw.multiWriter = newGrpcMultiWriter(stream)
+		rw.multiRspMsg = new(proto.MultiPacketData)
+	} else {
+		rw.reqMsg = new(proto.PacketData)
+		rw.rspMsg = new(proto.PacketData)
 	}
+	return rw
+}
+
+func (rw *grpcStreamReaderWriter) recv() error {
+	if !rw.multi {
+		rw.rspMsg.Reset()
+		if err := rw.RecvMsg(rw.rspMsg); err != nil {
+			return err
+		}
+		rw.rbuf = rw.rspMsg.Data
+		return nil
+	}
+	for len(rw.rbufs) == 0 {
+		rw.multiRspMsg.Reset()
+		if err := rw.RecvMsg(rw.multiRspMsg); err != nil {
+			return err
+		}
+		rw.rbufs = rw.multiRspMsg.Data
+	}
+	rw.rbuf, rw.rbufs = rw.rbufs[0], rw.rbufs[1:]
+	return nil
 }
 
 func (rw *grpcStreamReaderWriter) Read(b []byte) (int, error) {
 	if len(rw.rbuf) == 0 {
-		rw.rspMsg.Reset()
-		err := rw.RecvMsg(rw.rspMsg)
-		if err != nil {
+		if err := rw.recv(); err != nil {
 			return 0, err
 		}
-		rw.rbuf = rw.rspMsg.Data
 	}
 	n := copy(b, rw.rbuf)
 	rw.rbuf = rw.rbuf[n:]
@@ -53,6 +167,9 @@ func (rw *grpcStreamReaderWriter) Read(b []byte) (int, error) {
 }
 
 func (rw *grpcStreamReaderWriter) Write(b []byte) (int, error) {
+	if rw.multi {
+		return rw.multiWriter.Write(b)
+	}
 	rw.reqMsg.Reset()
 	rw.reqMsg.Data = b
 	return len(b), rw.SendMsg(rw.reqMsg)
@@ -62,13 +179,13 @@ type GrpcStreamConn struct {
 	*grpcStreamReaderWriter
 	sStream    grpc.ServerStream
 	cStream    grpc.ClientStream
-	clientConn *grpc.ClientConn
+	cancel     context.CancelFunc
 	localAddr  net.Addr
 	remoteAddr net.Addr
 	isServer   bool
 }
 
-func NewGrpcServerStreamConn(sStream grpc.ServerStream) *GrpcStreamConn {
+func NewGrpcServerStreamConn(sStream grpc.ServerStream, multi bool) *GrpcStreamConn {
 	var lAddr, rAddr net.Addr
 	if peerCtx, ok := peer.FromContext(sStream.Context()); ok {
 		lAddr = peerCtx.LocalAddr
@@ -79,11 +196,12 @@ func NewGrpcServerStreamConn(sStream grpc.ServerStream) *GrpcStreamConn {
 		localAddr:              lAddr,
 		remoteAddr:             rAddr,
 		isServer:               true,
-		grpcStreamReaderWriter: newGrpcStreamReaderWriter(sStream),
+		grpcStreamReaderWriter: newGrpcStreamReaderWriter(sStream, multi),
 	}
 }
 
-func NewGrpcClientStreamConn(cStream grpc.ClientStream, conn *grpc.ClientConn) *GrpcStreamConn {
+// NewGrpcClientStreamConn the stream is canceled on close, while the shared grpc connection is kept
+func NewGrpcClientStreamConn(cStream grpc.ClientStream, cancel context.CancelFunc, multi bool) *GrpcStreamConn {
 	var lAddr, rAddr net.Addr
 	if peerCtx, ok := peer.FromContext(cStream.Context()); ok {
 		lAddr = peerCtx.LocalAddr
@@ -91,19 +209,36 @@ func NewGrpcClientStreamConn(cStream grpc.ClientStream, conn *grpc.ClientConn) *
 	}
 	return &GrpcStreamConn{
 		cStream:                cStream,
-		clientConn:             conn,
+		cancel:                 cancel,
 		localAddr:              lAddr,
 		remoteAddr:             rAddr,
-		grpcStreamReaderWriter: newGrpcStreamReaderWriter(cStream),
+		grpcStreamReaderWriter: newGrpcStreamReaderWriter(cStream, multi),
 	}
 }
 
+// flush sends the queued writes of the multi mode
+func (rw *grpcStreamReaderWriter) flush() error {
+	if rw.multi {
+		return rw.multiWriter.flush()
+	}
+	return nil
+}
+
+// Close the queued writes of the multi mode are sent before the stream is closed
 func (c *GrpcStreamConn) Close() error {
 	if !c.isServer {
-		_ = c.cStream.CloseSend()
-		return c.clientConn.Close()
+		// the stream is canceled if the queued writes are blocked
+		timer := time.AfterFunc(grpcFlushTimeout, c.cancel)
+		defer timer.Stop()
 	}
-	return nil
+	err := c.flush()
+	if !c.isServer {
+		if closeErr := c.cStream.CloseSend(); err == nil {
+			err = closeErr
+		}
+		c.cancel()
+	}
+	return err
 }
 
 func (c *GrpcStreamConn) LocalAddr() net.Addr { return c.localAddr }
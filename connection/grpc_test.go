@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/connection/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGrpcStream records the sent messages and returns them for the reads
+type fakeGrpcStream struct {
+	mu    sync.Mutex
+	sent  []*proto.MultiPacketData
+	delay time.Duration
+	err   error
+}
+
+func (s *fakeGrpcStream) SendMsg(m any) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	msg := m.(*proto.MultiPacketData)
+	s.sent = append(s.sent, &proto.MultiPacketData{Data: append([][]byte(nil), msg.Data...)})
+	return nil
+}
+
+func (s *fakeGrpcStream) RecvMsg(m any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sent) == 0 {
+		return io.EOF
+	}
+	m.(*proto.MultiPacketData).Data = s.sent[0].Data
+	s.sent = s.sent[1:]
+	return nil
+}
+
+func TestGrpcMultiWriterBatch(t *testing.T) {
+	stream := &fakeGrpcStream{delay: time.Millisecond}
+	rw := newGrpcStreamReaderWriter(stream, true)
+
+	var expected bytes.Buffer
+	buf := make([]byte, 8)
+	for i := 0; i < 200; i++ {
+		chunk := []byte(fmt.Sprintf("chunk%03d", i))
+		expected.Write(chunk)
+		copy(buf, chunk)
+		// the written buffer is reused by the caller
+		n, err := rw.Write(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, len(buf), n)
+	}
+	assert.Nil(t, rw.flush())
+
+	// the writes queued while sending are batched into one message
+	stream.mu.Lock()
+	messages := len(stream.sent)
+	stream.mu.Unlock()
+	assert.Less(t, messages, 200)
+	t.Logf("200 writes are sent with %d messages", messages)
+
+	got, err := io.ReadAll(rw)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.String(), string(got))
+}
+
+func TestGrpcMultiWriterError(t *testing.T) {
+	errSend := errors.New("send failed")
+	stream := &fakeGrpcStream{err: errSend}
+	rw := newGrpcStreamReaderWriter(stream, true)
+
+	_, err := rw.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.ErrorIs(t, rw.flush(), errSend)
+	_, err = rw.Write([]byte("world"))
+	assert.ErrorIs(t, err, errSend)
+}
+
+func TestGrpcMultiWriterBackpressure(t *testing.T) {
+	stream := &fakeGrpcStream{delay: 20 * time.Millisecond}
+	rw := newGrpcStreamReaderWriter(stream, true)
+
+	chunk := make([]byte, grpcMaxPendingSize/4)
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		_, err := rw.Write(chunk)
+		assert.Nil(t, err)
+	}
+	// the writes are blocked once the queued writes exceed the limit
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Nil(t, rw.flush())
+
+	var total int
+	for _, msg := range stream.sent {
+		for _, data := range msg.Data {
+			total += len(data)
+		}
+	}
+	assert.Equal(t, 12*len(chunk), total)
+}
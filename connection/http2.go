@@ -0,0 +1,161 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ net.Conn = (*Http2Conn)(nil)
+
+// Http2Conn a bidirectional http2 stream, the request body is the upstream and the response body is the downstream
+type Http2Conn struct {
+	reader     io.ReadCloser
+	writer     io.Writer
+	flusher    http.Flusher
+	controller *http.ResponseController // only used for server
+	cancel     context.CancelFunc       // only used for client
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	// the client deadlines abort the stream once expired, since the response body can't be interrupted otherwise
+	deadlineMu   sync.Mutex
+	readTimer    *time.Timer
+	writeTimer   *time.Timer
+	readExpired  atomic.Bool
+	writeExpired atomic.Bool
+}
+
+func NewHttp2ServerConn(w http.ResponseWriter, r *http.Request) *Http2Conn {
+	var lAddr, rAddr net.Addr
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		lAddr = addr
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		rAddr = addr
+	}
+	flusher, _ := w.(http.Flusher)
+	return &Http2Conn{
+		reader:     r.Body,
+		writer:     w,
+		flusher:    flusher,
+		controller: http.NewResponseController(w),
+		localAddr:  lAddr,
+		remoteAddr: rAddr,
+	}
+}
+
+func NewHttp2ClientConn(body io.ReadCloser, pw *io.PipeWriter, cancel context.CancelFunc, laddr, raddr net.Addr) *Http2Conn {
+	return &Http2Conn{
+		reader:     body,
+		writer:     pw,
+		cancel:     cancel,
+		localAddr:  laddr,
+		remoteAddr: raddr,
+	}
+}
+
+func (c *Http2Conn) Read(b []byte) (int, error) {
+	if c.readExpired.Load() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n, err := c.reader.Read(b)
+	if err != nil && c.expired() {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+func (c *Http2Conn) Write(b []byte) (int, error) {
+	if c.writeExpired.Load() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n, err := c.writer.Write(b)
+	if err == nil && c.flusher != nil {
+		c.flusher.Flush()
+	}
+	if err != nil && c.expired() {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// expired either deadline aborts the whole client stream
+func (c *Http2Conn) expired() bool { return c.readExpired.Load() || c.writeExpired.Load() }
+
+func (c *Http2Conn) Close() error {
+	c.deadlineMu.Lock()
+	stopTimer(c.readTimer)
+	stopTimer(c.writeTimer)
+	c.deadlineMu.Unlock()
+	if pw, ok := c.writer.(*io.PipeWriter); ok {
+		pw.Close()
+	}
+	err := c.reader.Close()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return err
+}
+
+func (c *Http2Conn) LocalAddr() net.Addr { return c.localAddr }
+
+func (c *Http2Conn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *Http2Conn) SetReadDeadline(t time.Time) error {
+	if c.controller != nil {
+		return c.controller.SetReadDeadline(t)
+	}
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readTimer = c.resetTimer(c.readTimer, t, &c.readExpired)
+	return nil
+}
+
+func (c *Http2Conn) SetWriteDeadline(t time.Time) error {
+	if c.controller != nil {
+		return c.controller.SetWriteDeadline(t)
+	}
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.writeTimer = c.resetTimer(c.writeTimer, t, &c.writeExpired)
+	return nil
+}
+
+// resetTimer aborts the client stream when the deadline t is exceeded, the zero t means no deadline
+func (c *Http2Conn) resetTimer(timer *time.Timer, t time.Time, expired *atomic.Bool) *time.Timer {
+	stopTimer(timer)
+	if t.IsZero() || expired.Load() {
+		return nil
+	}
+	abort := func() {
+		expired.Store(true)
+		if pw, ok := c.writer.(*io.PipeWriter); ok {
+			pw.CloseWithError(os.ErrDeadlineExceeded)
+		}
+		c.cancel()
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		abort()
+		return nil
+	}
+	return time.AfterFunc(d, abort)
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (c *Http2Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
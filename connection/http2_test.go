@@ -0,0 +1,80 @@
+package connection
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPipeHttp2ClientConn the response body is aborted with the stream, like the http2 transport does
+func newPipeHttp2ClientConn() (conn *Http2Conn, body *io.PipeWriter, upstream *io.PipeReader) {
+	br, bw := io.Pipe()
+	ur, uw := io.Pipe()
+	cancel := func() { bw.CloseWithError(errors.New("http2: stream canceled")) }
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}
+	return NewHttp2ClientConn(br, uw, cancel, addr, addr), bw, ur
+}
+
+func TestHttp2ClientConn(t *testing.T) {
+	conn, body, upstream := newPipeHttp2ClientConn()
+	defer conn.Close()
+
+	go body.Write([]byte("hello"))
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	go conn.Write([]byte("world"))
+	n, err = upstream.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+
+	// the request body is finished once closed
+	assert.Nil(t, conn.Close())
+	_, err = upstream.Read(buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestHttp2ClientConnReadDeadline(t *testing.T) {
+	conn, _, _ := newPipeHttp2ClientConn()
+	defer conn.Close()
+
+	// the cleared deadline never expires
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	assert.Nil(t, conn.SetReadDeadline(time.Time{}))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, conn.readExpired.Load())
+
+	start := time.Now()
+	assert.Nil(t, conn.SetReadDeadline(start.Add(100*time.Millisecond)))
+	_, err := conn.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	// the aborted stream can't be read anymore
+	_, err = conn.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestHttp2ClientConnWriteDeadline(t *testing.T) {
+	conn, _, _ := newPipeHttp2ClientConn()
+	defer conn.Close()
+
+	// the past deadline aborts the stream immediately
+	assert.Nil(t, conn.SetWriteDeadline(time.Now().Add(-time.Second)))
+	_, err := conn.Write([]byte("hello"))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.False(t, conn.readExpired.Load())
+
+	conn, _, _ = newPipeHttp2ClientConn()
+	defer conn.Close()
+	// nobody reads the request body, so the write is blocked until the deadline
+	assert.Nil(t, conn.SetDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = conn.Write([]byte("hello"))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
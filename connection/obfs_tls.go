@@ -0,0 +1,403 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	tlsRecordTypeChangeCipherSpec = 0x14
+	tlsRecordTypeHandshake        = 0x16
+	tlsRecordTypeApplicationData  = 0x17
+
+	tlsHandshakeTypeClientHello = 0x01
+	tlsHandshakeTypeServerHello = 0x02
+
+	tlsExtServerName    = 0x0000
+	tlsExtSessionTicket = 0x0023
+
+	tlsRecordHeaderSize = 5
+	tlsMaxRecordSize    = 16 * 1024
+	// the first payload is sent as the session ticket of the ClientHello, the remaining is sent as application data
+	obfsTlsMaxTicketSize = tlsMaxRecordSize - 512
+)
+
+var (
+	errObfsTlsBadRecord      = errors.New("obfs-tls: bad record")
+	errObfsTlsBadClientHello = errors.New("obfs-tls: bad client hello")
+	errObfsTlsBadServerName  = errors.New("obfs-tls: bad server name")
+)
+
+var (
+	// TLS_ECDHE_*, TLS_DHE_* and TLS_RSA_* cipher suites used by simple-obfs
+	obfsTlsCipherSuites = []byte{
+		0xc0, 0x2c, 0xc0, 0x30, 0x00, 0x9f, 0xcc, 0xa9, 0xcc, 0xa8, 0xcc, 0xaa, 0xc0, 0x2b, 0xc0, 0x2f,
+		0x00, 0x9e, 0xc0, 0x24, 0xc0, 0x28, 0x00, 0x6b, 0xc0, 0x23, 0xc0, 0x27, 0x00, 0x67, 0xc0, 0x0a,
+		0xc0, 0x14, 0x00, 0x39, 0xc0, 0x09, 0xc0, 0x13, 0x00, 0x33, 0x00, 0x9d, 0x00, 0x9c, 0x00, 0x3d,
+		0x00, 0x3c, 0x00, 0x35, 0x00, 0x2f, 0x00, 0xff,
+	}
+	// ec_point_formats, supported_groups, signature_algorithms, encrypt_then_mac and extended_master_secret
+	obfsTlsClientExtensions = []byte{
+		0x00, 0x0b, 0x00, 0x04, 0x03, 0x01, 0x00, 0x02,
+		0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x19, 0x00, 0x18,
+		0x00, 0x0d, 0x00, 0x20, 0x00, 0x1e,
+		0x06, 0x01, 0x06, 0x02, 0x06, 0x03, 0x05, 0x01, 0x05, 0x02, 0x05, 0x03, 0x04, 0x01, 0x04, 0x02,
+		0x04, 0x03, 0x03, 0x01, 0x03, 0x02, 0x03, 0x03, 0x02, 0x01, 0x02, 0x02, 0x02, 0x03,
+		0x00, 0x16, 0x00, 0x00,
+		0x00, 0x17, 0x00, 0x00,
+	}
+	// renegotiation_info, extended_master_secret and ec_point_formats
+	obfsTlsServerExtensions = []byte{
+		0xff, 0x01, 0x00, 0x01, 0x00,
+		0x00, 0x17, 0x00, 0x00,
+		0x00, 0x0b, 0x00, 0x02, 0x01, 0x00,
+	}
+	obfsTlsChangeCipherSpec = []byte{tlsRecordTypeChangeCipherSpec, 0x03, 0x03, 0x00, 0x01, 0x01}
+)
+
+var _ net.Conn = (*ObfsTlsConn)(nil)
+
+// ObfsTlsConn the simple-obfs tls mode, which looks like a tls 1.2 session resumption.
+// The first payload of the client is sent as the session ticket of the fake ClientHello,
+// and the others are framed as the tls application data records.
+type ObfsTlsConn struct {
+	net.Conn
+	host         string
+	isServer     bool
+	sessionID    []byte
+	rbuf         bytes.Buffer
+	remain       int // the unread payload size of the current application data record
+	handshakeMux sync.Mutex
+	handshaked   bool
+	writeMux     sync.Mutex
+	writeStage   int
+}
+
+func NewObfsTlsConn(c net.Conn, host string, server bool) *ObfsTlsConn {
+	return &ObfsTlsConn{
+		Conn:     c,
+		host:     host,
+		isServer: server,
+	}
+}
+
+// Handshake the server reads the ClientHello and takes the session ticket as the first payload,
+// while the client sends the ClientHello along with the first written payload.
+func (c *ObfsTlsConn) Handshake() (err error) {
+	if !c.isServer {
+		return nil
+	}
+	c.handshakeMux.Lock()
+	defer c.handshakeMux.Unlock()
+
+	if c.handshaked {
+		return nil
+	}
+	if err = c.serverHandshake(); err != nil {
+		return
+	}
+	c.handshaked = true
+	return
+}
+
+func (c *ObfsTlsConn) serverHandshake() error {
+	typ, record, err := c.readRecord()
+	if err != nil {
+		return err
+	}
+	if typ != tlsRecordTypeHandshake {
+		return errObfsTlsBadClientHello
+	}
+	sessionID, serverName, ticket, err := parseClientHello(record)
+	if err != nil {
+		return err
+	}
+	if c.host != "" && serverName != c.host {
+		return errObfsTlsBadServerName
+	}
+	c.sessionID = sessionID
+	c.rbuf.Write(ticket)
+	return nil
+}
+
+func (c *ObfsTlsConn) readRecordHeader() (byte, int, error) {
+	var header [tlsRecordHeaderSize]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return 0, 0, err
+	}
+	size := int(binary.BigEndian.Uint16(header[3:]))
+	if header[1] != 0x03 || size > tlsMaxRecordSize+2048 {
+		return 0, 0, errObfsTlsBadRecord
+	}
+	return header[0], size, nil
+}
+
+func (c *ObfsTlsConn) readRecord() (byte, []byte, error) {
+	typ, size, err := c.readRecordHeader()
+	if err != nil {
+		return 0, nil, err
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, record); err != nil {
+		return 0, nil, err
+	}
+	return typ, record, nil
+}
+
+func (c *ObfsTlsConn) Read(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if c.rbuf.Len() > 0 {
+		return c.rbuf.Read(b)
+	}
+	// skip the handshake and change cipher spec records until the application data
+	for c.remain == 0 {
+		var typ byte
+		var size int
+		if typ, size, err = c.readRecordHeader(); err != nil {
+			return
+		}
+		switch typ {
+		case tlsRecordTypeApplicationData:
+			c.remain = size
+		case tlsRecordTypeHandshake, tlsRecordTypeChangeCipherSpec:
+			if _, err = io.CopyN(io.Discard, c.Conn, int64(size)); err != nil {
+				return
+			}
+		default:
+			return 0, errObfsTlsBadRecord
+		}
+	}
+	if len(b) > c.remain {
+		b = b[:c.remain]
+	}
+	n, err = c.Conn.Read(b)
+	c.remain -= n
+	return
+}
+
+func (c *ObfsTlsConn) Write(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	var buf bytes.Buffer
+	payload := b
+	if c.isServer {
+		if c.writeStage == 0 {
+			c.writeServerHello(&buf)
+			c.writeStage++
+		}
+	} else {
+		switch c.writeStage {
+		case 0:
+			ticket := payload
+			if len(ticket) > obfsTlsMaxTicketSize {
+				ticket = ticket[:obfsTlsMaxTicketSize]
+			}
+			c.writeClientHello(&buf, ticket)
+			payload = payload[len(ticket):]
+			c.writeStage++
+			if len(payload) == 0 {
+				break
+			}
+			fallthrough
+		case 1:
+			buf.Write(obfsTlsChangeCipherSpec)
+			writeFinished(&buf)
+			c.writeStage++
+		}
+	}
+	writeApplicationData(&buf, payload)
+	if _, err = c.Conn.Write(buf.Bytes()); err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+func (c *ObfsTlsConn) writeClientHello(buf *bytes.Buffer, ticket []byte) {
+	var ext []byte
+	// session_ticket must be the first extension for simple-obfs
+	ext = binary.BigEndian.AppendUint16(ext, tlsExtSessionTicket)
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(ticket)))
+	ext = append(ext, ticket...)
+	ext = binary.BigEndian.AppendUint16(ext, tlsExtServerName)
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(c.host)+5))
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(c.host)+3))
+	ext = append(ext, 0x00) // host_name
+	ext = binary.BigEndian.AppendUint16(ext, uint16(len(c.host)))
+	ext = append(ext, c.host...)
+	ext = append(ext, obfsTlsClientExtensions...)
+
+	c.sessionID = make([]byte, 32)
+	rand.Read(c.sessionID)
+
+	hello := []byte{0x03, 0x03}
+	hello = appendRandom(hello)
+	hello = append(hello, byte(len(c.sessionID)))
+	hello = append(hello, c.sessionID...)
+	hello = binary.BigEndian.AppendUint16(hello, uint16(len(obfsTlsCipherSuites)))
+	hello = append(hello, obfsTlsCipherSuites...)
+	hello = append(hello, 0x01, 0x00) // null compression
+	hello = binary.BigEndian.AppendUint16(hello, uint16(len(ext)))
+	hello = append(hello, ext...)
+
+	writeHandshake(buf, 0x0301, tlsHandshakeTypeClientHello, hello)
+}
+
+func (c *ObfsTlsConn) writeServerHello(buf *bytes.Buffer) {
+	hello := []byte{0x03, 0x03}
+	hello = appendRandom(hello)
+	hello = append(hello, byte(len(c.sessionID)))
+	hello = append(hello, c.sessionID...)
+	hello = append(hello, 0xcc, 0xa8) // TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256
+	hello = append(hello, 0x00)       // null compression
+	hello = binary.BigEndian.AppendUint16(hello, uint16(len(obfsTlsServerExtensions)))
+	hello = append(hello, obfsTlsServerExtensions...)
+
+	writeHandshake(buf, 0x0301, tlsHandshakeTypeServerHello, hello)
+	buf.Write(obfsTlsChangeCipherSpec)
+	writeFinished(buf)
+}
+
+func parseClientHello(record []byte) (sessionID []byte, serverName string, ticket []byte, err error) {
+	// handshake type(1) + length(3) + version(2) + random(32) + session id length(1)
+	if len(record) < 39 || record[0] != tlsHandshakeTypeClientHello {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	s := tlsReader(record[39:])
+	var ok bool
+	var suites, methods, exts tlsReader
+	if sessionID, ok = s.readBytes(int(record[38])); !ok {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	if suites, ok = s.readUint16Prefixed(); !ok || len(suites) == 0 {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	if methods, ok = s.readUint8Prefixed(); !ok || len(methods) == 0 {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	if exts, ok = s.readUint16Prefixed(); !ok {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	var hasTicket bool
+	for len(exts) > 0 {
+		var typ uint16
+		var data tlsReader
+		if typ, ok = exts.readUint16(); !ok {
+			return nil, "", nil, errObfsTlsBadClientHello
+		}
+		if data, ok = exts.readUint16Prefixed(); !ok {
+			return nil, "", nil, errObfsTlsBadClientHello
+		}
+		switch typ {
+		case tlsExtSessionTicket:
+			ticket, hasTicket = data, true
+		case tlsExtServerName:
+			var list, name tlsReader
+			if list, ok = data.readUint16Prefixed(); !ok {
+				return nil, "", nil, errObfsTlsBadClientHello
+			}
+			for len(list) > 0 {
+				var nameType []byte
+				if nameType, ok = list.readBytes(1); !ok {
+					return nil, "", nil, errObfsTlsBadClientHello
+				}
+				if name, ok = list.readUint16Prefixed(); !ok {
+					return nil, "", nil, errObfsTlsBadClientHello
+				}
+				if nameType[0] == 0x00 {
+					serverName = string(name)
+				}
+			}
+		}
+	}
+	if !hasTicket {
+		return nil, "", nil, errObfsTlsBadClientHello
+	}
+	return sessionID, serverName, ticket, nil
+}
+
+func appendRandom(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(time.Now().Unix()))
+	random := make([]byte, 28)
+	rand.Read(random)
+	return append(b, random...)
+}
+
+func writeHandshake(buf *bytes.Buffer, version uint16, typ byte, body []byte) {
+	var header [tlsRecordHeaderSize + 4]byte
+	header[0] = tlsRecordTypeHandshake
+	binary.BigEndian.PutUint16(header[1:], version)
+	binary.BigEndian.PutUint16(header[3:], uint16(len(body)+4))
+	header[5] = typ
+	header[6] = byte(len(body) >> 16)
+	binary.BigEndian.PutUint16(header[7:], uint16(len(body)))
+	buf.Write(header[:])
+	buf.Write(body)
+}
+
+// writeFinished the fake encrypted Finished message
+func writeFinished(buf *bytes.Buffer) {
+	finished := make([]byte, 32)
+	rand.Read(finished)
+	buf.Write([]byte{tlsRecordTypeHandshake, 0x03, 0x03, 0x00, byte(len(finished))})
+	buf.Write(finished)
+}
+
+func writeApplicationData(buf *bytes.Buffer, b []byte) {
+	for len(b) > 0 {
+		n := min(len(b), tlsMaxRecordSize)
+		buf.Write([]byte{tlsRecordTypeApplicationData, 0x03, 0x03, byte(n >> 8), byte(n)})
+		buf.Write(b[:n])
+		b = b[n:]
+	}
+}
+
+// tlsReader a minimal reader of the length-prefixed tls structures
+type tlsReader []byte
+
+func (s *tlsReader) readBytes(n int) ([]byte, bool) {
+	if len(*s) < n {
+		return nil, false
+	}
+	b := (*s)[:n]
+	*s = (*s)[n:]
+	return b, true
+}
+
+func (s *tlsReader) readUint16() (uint16, bool) {
+	b, ok := s.readBytes(2)
+	if !ok {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b), true
+}
+
+func (s *tlsReader) readUint8Prefixed() (tlsReader, bool) {
+	n, ok := s.readBytes(1)
+	if !ok {
+		return nil, false
+	}
+	return s.readBytes(int(n[0]))
+}
+
+func (s *tlsReader) readUint16Prefixed() (tlsReader, bool) {
+	n, ok := s.readUint16()
+	if !ok {
+		return nil, false
+	}
+	return s.readBytes(int(n))
+}
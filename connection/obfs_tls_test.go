@@ -0,0 +1,146 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newObfsTlsPipe(t *testing.T, clientHost, serverHost string) (client, server *ObfsTlsConn) {
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+	c1.SetDeadline(time.Now().Add(5 * time.Second))
+	c2.SetDeadline(time.Now().Add(5 * time.Second))
+	return NewObfsTlsConn(c1, clientHost, false), NewObfsTlsConn(c2, serverHost, true)
+}
+
+// assertObfsTlsTransfer writes the random payload to w and reads it back from r
+func assertObfsTlsTransfer(t *testing.T, w, r net.Conn, size int) {
+	payload := make([]byte, size)
+	rand.Read(payload)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := w.Write(payload)
+		errCh <- err
+	}()
+	got := make([]byte, size)
+	_, err := io.ReadFull(r, got)
+	assert.Nil(t, err, "size %d", size)
+	assert.Nil(t, <-errCh, "size %d", size)
+	assert.True(t, bytes.Equal(payload, got), "size %d", size)
+}
+
+func TestObfsTlsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		first int
+	}{
+		{name: "ticket only", first: 100},
+		{name: "max ticket", first: obfsTlsMaxTicketSize},
+		{name: "larger than ticket", first: obfsTlsMaxTicketSize + 1},
+		{name: "multiple records", first: 3*tlsMaxRecordSize + 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newObfsTlsPipe(t, "www.example.com", "www.example.com")
+			assertObfsTlsTransfer(t, client, server, tt.first)
+
+			// the reads and writes are interleaved after the handshake
+			for _, size := range []int{1, 1024, tlsMaxRecordSize, 2*tlsMaxRecordSize + 1} {
+				assertObfsTlsTransfer(t, server, client, size)
+				assertObfsTlsTransfer(t, client, server, size)
+			}
+		})
+	}
+}
+
+func TestObfsTlsConcurrentReadWrite(t *testing.T) {
+	client, server := newObfsTlsPipe(t, "www.example.com", "")
+	assertObfsTlsTransfer(t, client, server, 64)
+
+	// both sides write while reading
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			assertObfsTlsTransfer(t, server, client, 4096)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assertObfsTlsTransfer(t, client, server, 4096)
+	}
+	<-done
+}
+
+func TestObfsTlsServerNameMismatch(t *testing.T) {
+	client, server := newObfsTlsPipe(t, "www.example.com", "www.other.com")
+	go client.Write([]byte("hello"))
+	_, err := server.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, errObfsTlsBadServerName)
+}
+
+// clientHelloRecord returns the handshake record of the ClientHello without the record header
+func clientHelloRecord(t *testing.T, host string, ticket []byte) []byte {
+	var buf bytes.Buffer
+	NewObfsTlsConn(nil, host, false).writeClientHello(&buf, ticket)
+	assert.Equal(t, byte(tlsRecordTypeHandshake), buf.Bytes()[0])
+	return buf.Bytes()[tlsRecordHeaderSize:]
+}
+
+func TestParseClientHello(t *testing.T) {
+	record := clientHelloRecord(t, "www.example.com", []byte("ticket"))
+	sessionID, serverName, ticket, err := parseClientHello(record)
+	assert.Nil(t, err)
+	assert.Len(t, sessionID, 32)
+	assert.Equal(t, "www.example.com", serverName)
+	assert.Equal(t, []byte("ticket"), ticket)
+
+	// the empty ticket is allowed
+	_, _, ticket, err = parseClientHello(clientHelloRecord(t, "www.example.com", nil))
+	assert.Nil(t, err)
+	assert.Empty(t, ticket)
+}
+
+func TestParseClientHelloTruncated(t *testing.T) {
+	record := clientHelloRecord(t, "www.example.com", []byte("ticket"))
+	for n := 0; n < len(record); n++ {
+		_, _, _, err := parseClientHello(record[:n])
+		assert.ErrorIs(t, err, errObfsTlsBadClientHello, "truncated to %d bytes", n)
+	}
+}
+
+func TestParseClientHelloMissingTicket(t *testing.T) {
+	record := clientHelloRecord(t, "www.example.com", []byte("ticket"))
+	// handshake header(4) + version(2) + random(32) + session id + cipher suites + compression methods + extensions length(2)
+	offset := 4 + 2 + 32 + 1 + 32 + 2 + len(obfsTlsCipherSuites) + 2 + 2
+	// the session ticket is the first extension, rename it to padding
+	assert.Equal(t, []byte{0x00, 0x23}, record[offset:offset+2])
+	record[offset], record[offset+1] = 0x00, 0x15
+	_, _, _, err := parseClientHello(record)
+	assert.ErrorIs(t, err, errObfsTlsBadClientHello)
+
+	// not a ClientHello
+	record = clientHelloRecord(t, "www.example.com", []byte("ticket"))
+	record[0] = tlsHandshakeTypeServerHello
+	_, _, _, err = parseClientHello(record)
+	assert.ErrorIs(t, err, errObfsTlsBadClientHello)
+}
+
+func TestObfsTlsBadRecord(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	server := NewObfsTlsConn(c2, "", true)
+	defer server.Close()
+	// the application data record instead of the ClientHello
+	go c1.Write([]byte{tlsRecordTypeApplicationData, 0x03, 0x03, 0x00, 0x01, 0x00})
+	_, err := server.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, errObfsTlsBadClientHello)
+}
@@ -1,7 +1,13 @@
 package connection
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/quic-go/quic-go"
 )
@@ -25,3 +31,147 @@ func NewQuicConn(stream quic.Stream, laddr, raddr net.Addr) *QuicConn {
 func (c *QuicConn) LocalAddr() net.Addr { return c.laddr }
 
 func (c *QuicConn) RemoteAddr() net.Addr { return c.raddr }
+
+// quicDatagramHeaderSize the session id is prefixed to each quic datagram,
+// so that the udp packets of multiple sessions can share the same quic connection
+const quicDatagramHeaderSize = 4
+
+var errQuicDatagramAddr = errors.New("invalid quic datagram address")
+
+// QuicDatagramAddr the address of the udp session over the quic connection
+type QuicDatagramAddr struct {
+	net.Addr
+	ID uint32
+}
+
+func (a *QuicDatagramAddr) String() string {
+	return a.Addr.String() + "#" + strconv.FormatUint(uint64(a.ID), 10)
+}
+
+func PackQuicDatagram(id uint32, b []byte) []byte {
+	buf := make([]byte, quicDatagramHeaderSize+len(b))
+	binary.BigEndian.PutUint32(buf, id)
+	copy(buf[quicDatagramHeaderSize:], b)
+	return buf
+}
+
+func UnpackQuicDatagram(b []byte) (uint32, []byte, bool) {
+	if len(b) < quicDatagramHeaderSize {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(b), b[quicDatagramHeaderSize:], true
+}
+
+// the max size of the udp packet which is sent over the unidirectional stream
+const maxQuicStreamDatagramSize = quicDatagramHeaderSize + 65535
+
+// quicStreamDatagramTimeout the timeout of reading the udp packet from the unidirectional stream
+const quicStreamDatagramTimeout = 10 * time.Second
+
+// SendQuicDatagram sends the udp packet of the session with a quic datagram frame,
+// the packet which does not fit into a datagram frame is sent over a new unidirectional stream instead
+func SendQuicDatagram(conn quic.Connection, id uint32, b []byte) error {
+	data := PackQuicDatagram(id, b)
+	err := conn.SendDatagram(data)
+	var tooLarge *quic.DatagramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		return err
+	}
+	stream, err := conn.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	if _, err = stream.Write(data); err != nil {
+		stream.CancelWrite(0)
+		return err
+	}
+	return stream.Close()
+}
+
+// ReceiveQuicDatagrams dispatches the udp packets of the datagram frames and the unidirectional streams
+// until the quic connection is closed, the deliver may be called concurrently
+func ReceiveQuicDatagrams(conn quic.Connection, deliver func(id uint32, payload []byte)) {
+	go func() {
+		for {
+			stream, err := conn.AcceptUniStream(conn.Context())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream.SetReadDeadline(time.Now().Add(quicStreamDatagramTimeout))
+				data, err := io.ReadAll(io.LimitReader(stream, maxQuicStreamDatagramSize+1))
+				if err != nil || len(data) > maxQuicStreamDatagramSize {
+					stream.CancelRead(0)
+					return
+				}
+				if id, payload, ok := UnpackQuicDatagram(data); ok {
+					deliver(id, payload)
+				}
+			}()
+		}
+	}()
+	for {
+		data, err := conn.ReceiveDatagram(conn.Context())
+		if err != nil {
+			return
+		}
+		if id, payload, ok := UnpackQuicDatagram(data); ok {
+			deliver(id, payload)
+		}
+	}
+}
+
+type quicDatagram struct {
+	id      uint32
+	payload []byte
+}
+
+var _ net.PacketConn = (*QuicDatagramConn)(nil)
+
+// QuicDatagramConn the server side udp packets of all the sessions over the quic connection,
+// the remote address of each packet is a *QuicDatagramAddr. The quic connection is not closed by it.
+type QuicDatagramConn struct {
+	conn quic.Connection
+	ch   chan quicDatagram
+}
+
+func NewQuicDatagramConn(conn quic.Connection) *QuicDatagramConn {
+	c := &QuicDatagramConn{conn: conn, ch: make(chan quicDatagram)}
+	go ReceiveQuicDatagrams(conn, func(id uint32, payload []byte) {
+		select {
+		case c.ch <- quicDatagram{id: id, payload: payload}:
+		case <-conn.Context().Done():
+		}
+	})
+	return c
+}
+
+func (c *QuicDatagramConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case data := <-c.ch:
+		return copy(b, data.payload), &QuicDatagramAddr{Addr: c.conn.RemoteAddr(), ID: data.id}, nil
+	case <-c.conn.Context().Done():
+		return 0, nil, context.Cause(c.conn.Context())
+	}
+}
+
+func (c *QuicDatagramConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	daddr, ok := addr.(*QuicDatagramAddr)
+	if !ok {
+		return 0, errQuicDatagramAddr
+	}
+	if err := SendQuicDatagram(c.conn, daddr.ID, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *QuicDatagramConn) Close() error { return nil }
+
+func (c *QuicDatagramConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+func (c *QuicDatagramConn) SetDeadline(time.Time) error { return nil }
+
+func (c *QuicDatagramConn) SetReadDeadline(time.Time) error { return nil }
+
+func (c *QuicDatagramConn) SetWriteDeadline(time.Time) error { return nil }
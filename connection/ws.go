@@ -16,6 +16,11 @@ type WebsocketConn struct {
 
 func NewWebsocketConn(c *websocket.Conn) *WebsocketConn { return &WebsocketConn{conn: c} }
 
+// NewWebsocketConnWithEarlyData the early data received within the handshake request is read first
+func NewWebsocketConnWithEarlyData(c *websocket.Conn, earlyData []byte) *WebsocketConn {
+	return &WebsocketConn{conn: c, rbuf: earlyData}
+}
+
 func (c *WebsocketConn) Read(b []byte) (int, error) {
 	var err error
 	if len(c.rbuf) == 0 {
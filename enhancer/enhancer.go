@@ -40,12 +40,19 @@ func (eh *Enhancer) Start() (err error) {
 		return
 	}
 
+	var tunCIDR6 netip.Prefix
+	if len(eh.config.Tun.Inet6Address) > 0 {
+		tunCIDR6 = eh.config.Tun.Inet6Address[0]
+	}
 	// init fake ip pool and cache
-	if err = resolver.DefaultResolver.EnableEnhancerMode(eh.config.Tun.Inet4Address[0]); err != nil {
+	if err = resolver.DefaultResolver.EnableEnhancerMode(eh.config.Tun.Inet4Address[0], tunCIDR6); err != nil {
 		return
 	}
 
 	eh.config.Tun.Inet4Address[0] = resolver.DefaultResolver.GetAllocatedTunPrefix()
+	if tunCIDR6.IsValid() {
+		eh.config.Tun.Inet6Address[0] = resolver.DefaultResolver.GetAllocatedTunPrefix6()
+	}
 	eh.config.Tun.IPRoute2TableIndex = 10086
 	eh.config.Tun.IPRoute2RuleIndex = 5000
 
@@ -82,6 +89,7 @@ func (eh *Enhancer) Start() (err error) {
 	logger.Logger.Info("create tun device",
 		logx.String("name", eh.config.Tun.Name),
 		logx.String("address", eh.config.Tun.Inet4Address[0].String()),
+		logx.Slice3("address6", eh.config.Tun.Inet6Address),
 		logx.UInt32("mtu", eh.config.Tun.MTU),
 		logx.Slice3("dns-hijack", eh.config.DnsHijack),
 		logx.Bool("auto-route", eh.config.Tun.AutoRoute))
@@ -98,6 +106,9 @@ func (eh *Enhancer) Close() error {
 		eh.stack.TunDevice().TeardownDNS()
 	}
 	eh.fakeDns.Close()
+	if err := resolver.DefaultResolver.CloseEnhancerMode(); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
 	err := eh.stack.Close()
 	eh.running.Store(false)
 	return err
@@ -12,7 +12,10 @@ import (
 )
 
 func main() {
-	dialer := transport.NewDialer(transport.Grpc, options.DefaultGrpcOptions)
+	dialer, err := transport.NewDialer(transport.Grpc, options.DefaultGrpcOptions)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	conn, err := dialer.Dial(context.Background(), "127.0.0.1:10086")
 	if err != nil {
 		log.Fatalln(err)
@@ -17,14 +17,7 @@ import (
 
 type echoSrv struct{}
 
-var dialer = transport.NewDialer(transport.Quic, &options.QuicOptions{
-	Conns: 3,
-	// TlsOptions: options.TlsOptions{
-	// 	Mode:     options.TLS,
-	// 	Hostname: "127.0.0.1",
-	// 	CAFile:   "certs/ca.crt",
-	// },
-})
+var dialer transport.Dialer
 
 func (echoSrv) ServeTCP(conn net.Conn) {
 	log.Println(conn.RemoteAddr().String())
@@ -38,7 +31,20 @@ func (echoSrv) ServeTCP(conn net.Conn) {
 }
 
 func main() {
-	srv := server.NewTcpServer(":10000", &echoSrv{}, server.Tcp)
+	var err error
+	dialer, err = transport.NewDialer(transport.Quic, &options.QuicOptions{
+		Conns: 3,
+		// TlsOptions: options.TlsOptions{
+		// 	Mode:     options.TLS,
+		// 	Hostname: "127.0.0.1",
+		// 	CAFile:   "certs/ca.crt",
+		// },
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	srv := server.NewTcpServer(":10000", &echoSrv{}, server.Tcp, nil)
 	go func() {
 		err := srv.Start(context.Background())
 		log.Println("close server with err:", err)
@@ -14,12 +14,15 @@ import (
 )
 
 func main() {
-	dialer := transport.NewDialer(transport.Ssh, &options.SshOptions{
+	dialer, err := transport.NewDialer(transport.Ssh, &options.SshOptions{
 		User:       "test",
 		Password:   "test",
 		PrivateKey: "ssh-keys/test-key",
 		PublicKey:  "ssh-keys/test-key.pub",
 	})
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	request := func() {
 		time.Sleep(time.Millisecond * 20)
@@ -37,7 +37,7 @@ func (echoSrv) ServeTCP(conn net.Conn) {
 // tcp client <-> quic client <-> quic server <-> tcp server
 
 func echoMain() {
-	srv := server.NewTcpServer(":10002", &echoSrv{}, server.Tcp)
+	srv := server.NewTcpServer(":10002", &echoSrv{}, server.Tcp, nil)
 
 	go func() {
 		err := srv.Start(context.Background())
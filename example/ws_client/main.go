@@ -31,7 +31,10 @@ func main() {
 		// 	CAFile:   "certs/ca.crt",
 		// },
 	}
-	dialer := transport.NewDialer(transport.Websocket, options)
+	dialer, err := transport.NewDialer(transport.Websocket, options)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	conn, err := dialer.Dial(context.Background(), "127.0.0.1:8080")
 	if err != nil {
 		log.Fatalln(err)
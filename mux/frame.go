@@ -0,0 +1,62 @@
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const version = 1
+
+const (
+	cmdSYN byte = iota // open a new stream
+	cmdFIN             // close the stream
+	cmdPSH             // stream data
+	cmdNOP             // keepalive
+	cmdUPD             // stream window update
+)
+
+const (
+	// version(1) + cmd(1) + length(2) + stream id(4)
+	headerSize = 8
+	// the max payload size of a data frame
+	maxFrameSize = 32 * 1024
+	// the receive window of each stream, the peer stops sending data once the window is exhausted
+	streamWindow = 256 * 1024
+)
+
+// Preface the magic bytes sent by the client at the beginning of a session,
+// which allows the server to serve both the mux and the plain connections on the same port
+var Preface = []byte("MSS-MUX1")
+
+var (
+	errInvalidProtocol = errors.New("mux: invalid protocol")
+	errSessionClosed   = errors.New("mux: session closed")
+	errStreamClosed    = errors.New("mux: stream closed")
+	errTimeout         = &timeoutError{}
+)
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "mux: i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+
+type frameHeader [headerSize]byte
+
+func (h *frameHeader) version() byte { return h[0] }
+
+func (h *frameHeader) cmd() byte { return h[1] }
+
+func (h *frameHeader) length() uint16 { return binary.BigEndian.Uint16(h[2:]) }
+
+func (h *frameHeader) streamID() uint32 { return binary.BigEndian.Uint32(h[4:]) }
+
+func encodeFrame(cmd byte, sid uint32, payload []byte) []byte {
+	buf := make([]byte, headerSize+len(payload))
+	buf[0] = version
+	buf[1] = cmd
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], sid)
+	copy(buf[headerSize:], payload)
+	return buf
+}
@@ -0,0 +1,166 @@
+package mux
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSessionPair(t *testing.T) (*Session, *Session) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	serverCh := make(chan *Session, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn, ok, err := Detect(conn)
+		if err != nil || !ok {
+			conn.Close()
+			return
+		}
+		serverCh <- Server(conn, DefaultConfig)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	client, err := Client(conn, DefaultConfig)
+	assert.Nil(t, err)
+	server := <-serverCh
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestSessionEcho(t *testing.T) {
+	client, server := newSessionPair(t)
+	go func() {
+		for {
+			stream, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer stream.Close()
+				io.Copy(stream, stream)
+			}()
+		}
+	}()
+
+	// the payload is larger than the stream window to exercise the flow control
+	payload := make([]byte, 3*streamWindow+123)
+	rand.Read(payload)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.OpenStream()
+			assert.Nil(t, err)
+			defer stream.Close()
+			go stream.Write(payload)
+			got := make([]byte, len(payload))
+			_, err = io.ReadFull(stream, got)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(payload, got))
+		}()
+	}
+	wg.Wait()
+
+	// the closed streams are removed
+	assert.Eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamCloseAndDeadline(t *testing.T) {
+	client, server := newSessionPair(t)
+
+	stream, err := client.OpenStream()
+	assert.Nil(t, err)
+	remote, err := server.AcceptStream()
+	assert.Nil(t, err)
+
+	stream.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = stream.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, errTimeout)
+	stream.SetReadDeadline(time.Time{})
+
+	_, err = stream.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Close())
+
+	// the data sent before FIN is still readable
+	data, err := io.ReadAll(remote)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+	_, err = remote.Write([]byte("x"))
+	assert.NotNil(t, err)
+
+	// all streams are closed with the session
+	stream, err = client.OpenStream()
+	assert.Nil(t, err)
+	client.Close()
+	_, err = stream.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	_, err = client.OpenStream()
+	assert.NotNil(t, err)
+}
+
+func TestDetectPlainConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go c1.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	conn, ok, err := Detect(c2)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	buf := make([]byte, 16)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(buf))
+}
+
+func TestDetectServerSpeaksFirst(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	// the client sends a short request and waits for the response
+	go c1.Write([]byte{0x01})
+
+	conn, ok, err := Detect(c2)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x01), buf[0])
+}
+
+func TestDetectTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	timeout := DetectTimeout
+	DetectTimeout = 50 * time.Millisecond
+	defer func() { DetectTimeout = timeout }()
+	_, ok, err := Detect(c2)
+	assert.False(t, ok)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+}
@@ -0,0 +1,269 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	// the interval of sending keepalive frames
+	KeepAliveInterval time.Duration
+	// the session is closed if nothing is received within the timeout
+	KeepAliveTimeout time.Duration
+	// the max number of the pending streams to be accepted
+	AcceptBacklog int
+}
+
+var DefaultConfig = Config{
+	KeepAliveInterval: 10 * time.Second,
+	KeepAliveTimeout:  30 * time.Second,
+	AcceptBacklog:     1024,
+}
+
+// Session multiplexes many logical streams over a single physical connection.
+// Only the client side opens streams, and the server side accepts them.
+type Session struct {
+	conn     net.Conn
+	config   Config
+	nextID   uint32
+	mu       sync.Mutex
+	streams  map[uint32]*Stream
+	acceptCh chan *Stream
+	writeMu  sync.Mutex
+	received atomic.Bool
+	die      chan struct{}
+	dieOnce  sync.Once
+}
+
+func newSession(conn net.Conn, config Config) *Session {
+	if config.AcceptBacklog <= 0 {
+		config.AcceptBacklog = DefaultConfig.AcceptBacklog
+	}
+	s := &Session{
+		conn:     conn,
+		config:   config,
+		streams:  make(map[uint32]*Stream),
+		acceptCh: make(chan *Stream, config.AcceptBacklog),
+		die:      make(chan struct{}),
+	}
+	go s.recvLoop()
+	if config.KeepAliveInterval > 0 && config.KeepAliveTimeout > 0 {
+		go s.keepalive()
+	}
+	return s
+}
+
+// Client creates the client side session and sends the preface
+func Client(conn net.Conn, config Config) (*Session, error) {
+	if _, err := conn.Write(Preface); err != nil {
+		return nil, err
+	}
+	return newSession(conn, config), nil
+}
+
+// Server creates the server side session, the preface must be consumed already
+func Server(conn net.Conn, config Config) *Session {
+	return newSession(conn, config)
+}
+
+// DetectTimeout the max time to wait for the preface
+var DetectTimeout = 10 * time.Second
+
+// Detect reads the preface from the connection, and returns whether it is a mux connection.
+// The returned connection must be used instead, since the bytes read are replayed for a plain connection.
+// A plain connection is detected by its first byte, so that the server-speaks-first protocols are not blocked.
+func Detect(conn net.Conn) (net.Conn, bool, error) {
+	conn.SetReadDeadline(time.Now().Add(DetectTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, len(Preface))
+	if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+		return conn, false, err
+	}
+	if buf[0] != Preface[0] {
+		return &prefixConn{Conn: conn, prefix: buf[:1]}, false, nil
+	}
+	n, err := io.ReadFull(conn, buf[1:])
+	if err == nil && bytes.Equal(buf, Preface) {
+		return conn, true, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return conn, false, err
+	}
+	return &prefixConn{Conn: conn, prefix: buf[:1+n]}, false, nil
+}
+
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (s *Session) OpenStream() (*Stream, error) {
+	if s.IsClosed() {
+		return nil, errSessionClosed
+	}
+	s.mu.Lock()
+	s.nextID++
+	stream := newStream(s.nextID, s)
+	s.streams[stream.id] = stream
+	s.mu.Unlock()
+
+	if err := s.writeFrame(cmdSYN, stream.id, nil); err != nil {
+		s.removeStream(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.acceptCh:
+		return stream, nil
+	case <-s.die:
+		return nil, errSessionClosed
+	}
+}
+
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) Close() error {
+	var err error = errSessionClosed
+	s.dieOnce.Do(func() {
+		close(s.die)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *Session) LocalAddr() net.Addr { return s.conn.LocalAddr() }
+
+func (s *Session) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+func (s *Session) getStream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) writeFrame(cmd byte, sid uint32, payload []byte) error {
+	if s.IsClosed() {
+		return errSessionClosed
+	}
+	frame := encodeFrame(cmd, sid, payload)
+	s.writeMu.Lock()
+	_, err := s.conn.Write(frame)
+	s.writeMu.Unlock()
+	if err != nil {
+		s.Close()
+	}
+	return err
+}
+
+func (s *Session) recvLoop() {
+	defer s.Close()
+	var hdr frameHeader
+	for {
+		if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+			return
+		}
+		s.received.Store(true)
+		if hdr.version() != version {
+			return
+		}
+		sid := hdr.streamID()
+		var payload []byte
+		if length := hdr.length(); length > 0 {
+			payload = make([]byte, length)
+			if _, err := io.ReadFull(s.conn, payload); err != nil {
+				return
+			}
+		}
+		switch hdr.cmd() {
+		case cmdNOP:
+		case cmdSYN:
+			s.mu.Lock()
+			if _, ok := s.streams[sid]; ok {
+				s.mu.Unlock()
+				continue
+			}
+			stream := newStream(sid, s)
+			s.streams[sid] = stream
+			s.mu.Unlock()
+			select {
+			case s.acceptCh <- stream:
+			case <-s.die:
+				return
+			}
+		case cmdFIN:
+			if stream := s.getStream(sid); stream != nil {
+				stream.remoteClose()
+			}
+		case cmdPSH:
+			if stream := s.getStream(sid); stream != nil && len(payload) > 0 {
+				stream.pushBytes(payload)
+			}
+		case cmdUPD:
+			if len(payload) != 4 {
+				return
+			}
+			if stream := s.getStream(sid); stream != nil {
+				stream.updateWindow(binary.BigEndian.Uint32(payload))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Session) keepalive() {
+	ping := time.NewTicker(s.config.KeepAliveInterval)
+	timeout := time.NewTicker(s.config.KeepAliveTimeout)
+	defer ping.Stop()
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ping.C:
+			s.writeFrame(cmdNOP, 0, nil)
+		case <-timeout.C:
+			if !s.received.Swap(false) {
+				s.Close()
+				return
+			}
+		case <-s.die:
+			return
+		}
+	}
+}
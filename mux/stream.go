@@ -0,0 +1,210 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ net.Conn = (*Stream)(nil)
+
+// Stream a logical connection in the session, it implements net.Conn
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	consumed  uint32
+	remoteFin bool
+
+	// the remaining bytes allowed to send
+	window     atomic.Int32
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newStream(id uint32, sess *Session) *Stream {
+	s := &Stream{
+		id:         id,
+		sess:       sess,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	s.window.Store(streamWindow)
+	return s
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func deadlineTimer(v *atomic.Value) (<-chan time.Time, func()) {
+	deadline, _ := v.Load().(time.Time)
+	if deadline.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, func() { timer.Stop() }
+}
+
+func (s *Stream) ID() uint32 { return s.id }
+
+func (s *Stream) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, _ := s.buf.Read(b)
+			// return the consumed bytes to the peer once half of the window is consumed
+			s.consumed += uint32(n)
+			var inc uint32
+			if s.consumed >= streamWindow/2 {
+				inc, s.consumed = s.consumed, 0
+			}
+			s.mu.Unlock()
+			if inc > 0 {
+				var payload [4]byte
+				binary.BigEndian.PutUint32(payload[:], inc)
+				s.sess.writeFrame(cmdUPD, s.id, payload[:])
+			}
+			return n, nil
+		}
+		remoteFin := s.remoteFin
+		s.mu.Unlock()
+		if remoteFin {
+			return 0, io.EOF
+		}
+
+		timeout, stop := deadlineTimer(&s.readDeadline)
+		select {
+		case <-s.readEvent:
+			stop()
+		case <-s.closed:
+			stop()
+			return 0, errStreamClosed
+		case <-s.sess.die:
+			stop()
+			// drain the data received before the session is closed
+			s.mu.Lock()
+			empty := s.buf.Len() == 0
+			s.mu.Unlock()
+			if empty {
+				return 0, io.EOF
+			}
+		case <-timeout:
+			return 0, errTimeout
+		}
+	}
+}
+
+func (s *Stream) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		select {
+		case <-s.closed:
+			return written, errStreamClosed
+		default:
+		}
+		s.mu.Lock()
+		remoteFin := s.remoteFin
+		s.mu.Unlock()
+		if remoteFin {
+			return written, io.ErrClosedPipe
+		}
+
+		window := int(s.window.Load())
+		if window <= 0 {
+			timeout, stop := deadlineTimer(&s.writeDeadline)
+			select {
+			case <-s.writeEvent:
+				stop()
+				continue
+			case <-s.closed:
+				stop()
+				return written, errStreamClosed
+			case <-s.sess.die:
+				stop()
+				return written, errSessionClosed
+			case <-timeout:
+				return written, errTimeout
+			}
+		}
+		n := min(len(b), maxFrameSize, window)
+		if err := s.sess.writeFrame(cmdPSH, s.id, b[:n]); err != nil {
+			return written, err
+		}
+		s.window.Add(-int32(n))
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (s *Stream) Close() error {
+	var err error = errStreamClosed
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.sess.removeStream(s.id)
+		err = s.sess.writeFrame(cmdFIN, s.id, nil)
+	})
+	return err
+}
+
+func (s *Stream) LocalAddr() net.Addr { return s.sess.LocalAddr() }
+
+func (s *Stream) RemoteAddr() net.Addr { return s.sess.RemoteAddr() }
+
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	s.SetWriteDeadline(t)
+	return nil
+}
+
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.readDeadline.Store(t)
+	notify(s.readEvent)
+	return nil
+}
+
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.writeDeadline.Store(t)
+	notify(s.writeEvent)
+	return nil
+}
+
+func (s *Stream) pushBytes(b []byte) {
+	s.mu.Lock()
+	s.buf.Write(b)
+	s.mu.Unlock()
+	notify(s.readEvent)
+}
+
+func (s *Stream) remoteClose() {
+	s.mu.Lock()
+	s.remoteFin = true
+	s.mu.Unlock()
+	notify(s.readEvent)
+	notify(s.writeEvent)
+}
+
+func (s *Stream) updateWindow(inc uint32) {
+	s.window.Add(int32(inc))
+	notify(s.writeEvent)
+}
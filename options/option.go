@@ -49,15 +49,28 @@ func (o *TlsOptions) GetClientTlsConfig() (*tls.Config, error) {
 
 type Options interface{ Update() }
 
+// IPPreference the address family which is attempted first when dialing the dual stack hosts
+type IPPreference uint8
+
+const (
+	PreferIPv6 IPPreference = iota // default, RFC 8305
+	PreferIPv4
+)
+
 type defaultOptions struct {
 	OutboundInterface   string
 	AutoDetectInterface bool
+	// the SO_MARK of all the outbound sockets on linux, 0 means disabled
+	RoutingMark int
+	IPPreference
 }
 
 func (defaultOptions) Update() {}
 
 var DefaultOptions = &defaultOptions{}
 
+var DefaultTcpOptions = &TcpOptions{}
+
 var DefaultQuicOptions = &QuicOptions{
 	HandshakeIdleTimeout: 5 * time.Second,
 	KeepAlivePeriod:      30 * time.Second,
@@ -65,6 +78,18 @@ var DefaultQuicOptions = &QuicOptions{
 	Conns:                3,
 }
 
+var DefaultKcpOptions = &KcpOptions{
+	Mtu:          1350,
+	SndWnd:       1024,
+	RcvWnd:       1024,
+	NoDelay:      true,
+	Interval:     20 * time.Millisecond,
+	Resend:       2,
+	NoCongestion: true,
+	DataShards:   10,
+	ParityShards: 3,
+}
+
 var DefaultWsOptions = &WsOptions{
 	Host:       "www.baidu.com",
 	Path:       "/ws",
@@ -73,6 +98,8 @@ var DefaultWsOptions = &WsOptions{
 	Compress:   false,
 	TlsOptions: TlsOptions{Mode: None},
 	UserAgent:  "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/106.0.0.0 Safari/537.36",
+
+	EarlyDataHeader: "Sec-WebSocket-Protocol",
 }
 
 var DefaultObfsOptions = &ObfsOptions{
@@ -81,10 +108,29 @@ var DefaultObfsOptions = &ObfsOptions{
 
 var DefaultGrpcOptions = &GrpcOptions{
 	TlsOptions: TlsOptions{Mode: None},
+	Conns:      1,
 }
 
 var DefaultSshOptions = &SshOptions{}
 
+var DefaultHttp2Options = &Http2Options{
+	Host:       "www.baidu.com",
+	Path:       "/h2",
+	Method:     "POST",
+	TlsOptions: TlsOptions{Mode: None},
+}
+
+var DefaultTrojanOptions = &TrojanOptions{
+	TlsOptions: TlsOptions{Mode: TLS},
+}
+
+var DefaultMuxOptions = &MuxOptions{
+	Conns:             2,
+	MaxStreams:        64,
+	KeepAliveInterval: 10 * time.Second,
+	KeepAliveTimeout:  30 * time.Second,
+}
+
 type WsOptions struct {
 	TlsOptions
 	Host      string
@@ -93,30 +139,81 @@ type WsOptions struct {
 	RevBuffer int
 	Compress  bool
 	UserAgent string
+	Headers   map[string]string // the extra request headers, only used for client
+	// the first data up to the size is sent within the handshake request, 0 means disabled, only used for client
+	MaxEarlyData int
+	// the header which carries the base64 encoded early data
+	EarlyDataHeader string
+	// the early data is appended to the path instead of the header, the server only serves the path mode if it's set
+	EarlyDataPath bool
 }
 
 func (opts *WsOptions) Update() {}
 
+// EarlyDataEnabled the client sends the first data within the handshake request
+func (opts *WsOptions) EarlyDataEnabled() bool {
+	return opts.MaxEarlyData > 0 && (opts.EarlyDataHeader != "" || opts.EarlyDataPath)
+}
+
+type ObfsMode byte
+
+const (
+	ObfsHTTP ObfsMode = iota
+	ObfsTLS
+)
+
 type ObfsOptions struct {
 	Host string
+	Mode ObfsMode
 }
 
 func (opts *ObfsOptions) Update() {}
 
+// QuicOptions the congestion control is always the quic-go default (cubic/new reno), quic-go does not expose it
 type QuicOptions struct {
 	TlsOptions
 	HandshakeIdleTimeout time.Duration
 	KeepAlivePeriod      time.Duration
 	MaxIdleTimeout       time.Duration
 	Conns                int
+	// the flow control windows in bytes, 0 means the quic-go defaults
+	InitialStreamReceiveWindow     uint64
+	MaxStreamReceiveWindow         uint64
+	InitialConnectionReceiveWindow uint64
+	MaxConnectionReceiveWindow     uint64
+	// Datagram carries the udp packets with the quic datagram frames (RFC 9221),
+	// the packets which are larger than a datagram frame are sent over the unidirectional streams
+	Datagram bool
+	// Migrate moves the pooled client connections to a new udp socket when the network changes instead of redialling them
+	Migrate bool
 }
 
 func (opts *QuicOptions) Update() {}
 
+// KcpOptions both sides must use the same mtu and fec shards, the fec is disabled if either of the shards is zero
+type KcpOptions struct {
+	Mtu          int
+	SndWnd       int
+	RcvWnd       int
+	NoDelay      bool
+	Interval     time.Duration
+	Resend       int // fast resend after skipped by the number of the acks, 0 means disabled
+	NoCongestion bool
+	DataShards   int
+	ParityShards int
+}
+
+func (opts *KcpOptions) Update() {}
+
 type GrpcOptions struct {
 	TlsOptions
 	SndBuffer int
 	RevBuffer int
+	// the methods are /<ServiceName>/Tun and /<ServiceName>/TunMulti like Xray's gun,
+	// the legacy /proto.StreamService/Transfer is used if empty
+	ServiceName string
+	Multi       bool // send the writes queued while sending in one repeated bytes message
+	Conns       int  // the number of the pooled grpc connections shared by the streams, only used for client
 }
 
 func (opts *GrpcOptions) Update() {}
@@ -130,3 +227,70 @@ type SshOptions struct {
 }
 
 func (opts *SshOptions) Update() {}
+
+type Http2Options struct {
+	TlsOptions
+	Host   string
+	Path   string // only used for POST
+	Method string // CONNECT or POST
+}
+
+func (opts *Http2Options) Update() {
+	if opts.Method != "CONNECT" {
+		opts.Method = "POST"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+}
+
+// TrojanOptions the tls layer of the trojan protocol, which is on top of the transport
+type TrojanOptions struct {
+	TlsOptions
+	Fallback string // only used for server, the http backend address on authentication failure
+}
+
+func (opts *TrojanOptions) Update() {}
+
+// UpstreamOptions the upstream socks5 or http proxy server, the password is shared
+type UpstreamOptions struct {
+	TlsOptions
+	Type     string // socks5 or http
+	Username string
+}
+
+func (opts *UpstreamOptions) Update() {}
+
+// TcpOptions the socket options of the tcp transport
+type TcpOptions struct {
+	// FastOpen sends the first data within the SYN on linux. It is only used when the host resolves to a single address,
+	// since the connect returns before the handshake and the happy eyeballs race could not fall back to another address
+	FastOpen bool
+	// Multipath enables multipath tcp on linux, it falls back to tcp if not supported
+	Multipath bool
+	// Transparent accepts the connections of the tproxy rules with IP_TRANSPARENT on linux, only used for server
+	Transparent bool
+}
+
+func (opts *TcpOptions) Update() {}
+
+// BindOptions binds the outbound sockets to the interface and the source ip, and marks them with SO_MARK on linux.
+// The global outbound interface and routing mark are used if not set.
+type BindOptions struct {
+	Interface string
+	SourceIP  string
+	Mark      int
+}
+
+func (opts *BindOptions) Update() {}
+
+// MuxOptions multiplexes the proxied connections over the pooled physical connections,
+// only the tcp, websocket, obfs and kcp transports are supported
+type MuxOptions struct {
+	Conns             int // the number of the physical connections
+	MaxStreams        int // the max number of the streams per physical connection, 0 means unlimited
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+}
+
+func (opts *MuxOptions) Update() {}
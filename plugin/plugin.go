@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/josexy/logx"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+const (
+	minRestartInterval = time.Second
+	maxRestartInterval = 30 * time.Second
+	// the restart interval is reset if the plugin has been running for this long
+	stableDuration = time.Minute
+	killTimeout    = 3 * time.Second
+)
+
+var errPluginClosed = errors.New("plugin: closed")
+
+// Plugin the SIP003 plugin process, which is restarted when it exits unexpectedly.
+//
+// Client: ss-local -> SS_LOCAL (plugin) -> SS_REMOTE (server)
+// Server: client -> SS_REMOTE (plugin) -> SS_LOCAL (ss-server)
+type Plugin struct {
+	name       string
+	opts       string
+	remoteAddr string
+	localAddr  string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	started bool
+	closed  chan struct{}
+	done    chan struct{}
+}
+
+// New the local address is allocated on the loopback interface if empty
+func New(name, opts, remoteAddr, localAddr string) (*Plugin, error) {
+	if _, _, err := net.SplitHostPort(remoteAddr); err != nil {
+		return nil, err
+	}
+	if localAddr == "" {
+		var err error
+		if localAddr, err = freeLocalAddr(); err != nil {
+			return nil, err
+		}
+	}
+	return &Plugin{
+		name:       name,
+		opts:       opts,
+		remoteAddr: remoteAddr,
+		localAddr:  localAddr,
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+func freeLocalAddr() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+func (p *Plugin) Name() string { return p.name }
+
+// LocalAddr the address which the traffic of the node is routed through
+func (p *Plugin) LocalAddr() string { return p.localAddr }
+
+func (p *Plugin) RemoteAddr() string { return p.remoteAddr }
+
+func (p *Plugin) env() []string {
+	remoteHost, remotePort, _ := net.SplitHostPort(p.remoteAddr)
+	localHost, localPort, _ := net.SplitHostPort(p.localAddr)
+	return append(os.Environ(),
+		"SS_REMOTE_HOST="+remoteHost,
+		"SS_REMOTE_PORT="+remotePort,
+		"SS_LOCAL_HOST="+localHost,
+		"SS_LOCAL_PORT="+localPort,
+		"SS_PLUGIN_OPTIONS="+p.opts,
+	)
+}
+
+func (p *Plugin) spawn() (*exec.Cmd, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		return nil, errPluginClosed
+	default:
+	}
+	cmd := exec.Command(p.name)
+	cmd.Env = p.env()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.cmd = cmd
+	logger.Logger.Info("start plugin",
+		logx.String("plugin", p.name),
+		logx.String("opts", p.opts),
+		logx.String("local", p.localAddr),
+		logx.String("remote", p.remoteAddr),
+		logx.Int("pid", cmd.Process.Pid),
+	)
+	return cmd, nil
+}
+
+// Start starts the plugin process and supervises it in the background
+func (p *Plugin) Start() error {
+	p.mu.Lock()
+	if p.started {
+		p.mu.Unlock()
+		return nil
+	}
+	p.started = true
+	p.mu.Unlock()
+
+	cmd, err := p.spawn()
+	if err != nil {
+		close(p.done)
+		return err
+	}
+	go p.supervise(cmd)
+	return nil
+}
+
+func (p *Plugin) supervise(cmd *exec.Cmd) {
+	defer close(p.done)
+	interval := minRestartInterval
+	for {
+		startTime := time.Now()
+		err := cmd.Wait()
+		select {
+		case <-p.closed:
+			return
+		default:
+		}
+		if time.Since(startTime) >= stableDuration {
+			interval = minRestartInterval
+		}
+		logger.Logger.Warn("plugin exited unexpectedly, restarting",
+			logx.String("plugin", p.name),
+			logx.Error("error", err),
+			logx.Duration("interval", interval),
+		)
+		for {
+			select {
+			case <-p.closed:
+				return
+			case <-time.After(interval):
+			}
+			interval = min(interval*2, maxRestartInterval)
+			if cmd, err = p.spawn(); err == nil {
+				break
+			}
+			if errors.Is(err, errPluginClosed) {
+				return
+			}
+			logger.Logger.Error("restart plugin failed", logx.String("plugin", p.name), logx.Error("error", err))
+		}
+	}
+}
+
+// Close stops the plugin process gracefully, and kills it after a timeout
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	select {
+	case <-p.closed:
+		p.mu.Unlock()
+		return nil
+	default:
+	}
+	close(p.closed)
+	cmd, started := p.cmd, p.started
+	p.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+	if cmd != nil {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			cmd.Process.Kill()
+		}
+		select {
+		case <-p.done:
+			return nil
+		case <-time.After(killTimeout):
+			cmd.Process.Kill()
+		}
+	}
+	<-p.done
+	return nil
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPluginEnv = "MINI_SS_TEST_PLUGIN"
+
+// TestMain the test binary acts as a pass-through plugin if the environment variable is set
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) == "1" {
+		runPassThroughPlugin()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runPassThroughPlugin() {
+	localAddr := net.JoinHostPort(os.Getenv("SS_LOCAL_HOST"), os.Getenv("SS_LOCAL_PORT"))
+	remoteAddr := net.JoinHostPort(os.Getenv("SS_REMOTE_HOST"), os.Getenv("SS_REMOTE_PORT"))
+	ln, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		os.Exit(1)
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			dst, err := net.Dial("tcp", remoteAddr)
+			if err != nil {
+				return
+			}
+			defer dst.Close()
+			go io.Copy(dst, conn)
+			io.Copy(conn, dst)
+		}()
+	}
+}
+
+func startEchoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func echo(addr string) (string, error) {
+	var conn net.Conn
+	var err error
+	// wait for the plugin to listen
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Write([]byte("ping")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	return string(buf), err
+}
+
+func TestPluginEnv(t *testing.T) {
+	p, err := New("v2ray-plugin", "tls;host=example.com", "1.2.3.4:443", "127.0.0.1:10000")
+	assert.Nil(t, err)
+	env := p.env()
+	assert.Contains(t, env, "SS_REMOTE_HOST=1.2.3.4")
+	assert.Contains(t, env, "SS_REMOTE_PORT=443")
+	assert.Contains(t, env, "SS_LOCAL_HOST=127.0.0.1")
+	assert.Contains(t, env, "SS_LOCAL_PORT=10000")
+	assert.Contains(t, env, "SS_PLUGIN_OPTIONS=tls;host=example.com")
+
+	_, err = New("v2ray-plugin", "", "1.2.3.4", "")
+	assert.NotNil(t, err)
+}
+
+func TestPluginRestart(t *testing.T) {
+	t.Setenv(testPluginEnv, "1")
+	remoteAddr := startEchoServer(t)
+
+	p, err := New(os.Args[0], "", remoteAddr, "")
+	assert.Nil(t, err)
+	assert.Nil(t, p.Start())
+
+	reply, err := echo(p.LocalAddr())
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", reply)
+
+	// the plugin is restarted after it exits unexpectedly
+	p.mu.Lock()
+	pid := p.cmd.Process.Pid
+	p.cmd.Process.Kill()
+	p.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.cmd.Process.Pid != pid
+	}, 5*time.Second, 100*time.Millisecond)
+
+	reply, err = echo(p.LocalAddr())
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", reply)
+
+	assert.Nil(t, p.Close())
+	_, err = net.DialTimeout("tcp", p.LocalAddr(), time.Second)
+	assert.NotNil(t, err)
+}
@@ -42,6 +42,8 @@ type ReqContext struct {
 	Port       string
 	Addr       string
 	Request    *http.Request
+	// the authenticated username of the inbound proxy request
+	User string
 }
 
 type MitmHandler interface {
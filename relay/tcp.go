@@ -1,9 +1,11 @@
 package relay
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/josexy/logx"
@@ -14,7 +16,11 @@ import (
 	"github.com/josexy/mini-ss/util/logger"
 )
 
-const dialTimeout = time.Second * 30
+const (
+	dialTimeout = time.Second * 30
+	// the delay before the target address is sent alone with the websocket early data
+	earlyAddrFlushDelay = 200 * time.Millisecond
+)
 
 var (
 	tcpPool    = bufferpool.NewBufferPool(bufferpool.MaxTcpBufferSize)
@@ -50,10 +56,27 @@ func ioCopyWithBuffer(dst io.Writer, src io.Reader) error {
 	return err
 }
 
+// errDialer the connections always fail with the error, such as the unsupported transport or bind options
+func errDialer(err error) transport.Dialer {
+	return transport.DialFunc(func(context.Context, string) (net.Conn, error) { return nil, err })
+}
+
 type TCPDirectRelayer struct{ transport.Dialer }
 
 func NewTCPDirectRelayer() *TCPDirectRelayer {
-	return &TCPDirectRelayer{Dialer: transport.NewDialer(transport.Tcp, nil)}
+	dialer, err := transport.NewDialer(transport.Tcp, nil)
+	if err != nil {
+		dialer = errDialer(err)
+	}
+	return &TCPDirectRelayer{Dialer: dialer}
+}
+
+// WithBind binds the outbound connections to the interface, source ip and routing mark
+func (r *TCPDirectRelayer) WithBind(opts *options.BindOptions) *TCPDirectRelayer {
+	if err := transport.SetDialerBind(r.Dialer, opts); err != nil {
+		r.Dialer = errDialer(err)
+	}
+	return r
 }
 
 func (r *TCPDirectRelayer) RelayToServer(conn net.Conn, remoteServerAddr string) error {
@@ -76,41 +99,163 @@ func (r *TCPDirectRelayer) RelayToServer(conn net.Conn, remoteServerAddr string)
 type ProxyTCPRelayer struct {
 	transport.Dialer
 	typ             transport.Type
+	opts            options.Options
 	inbound         transport.TcpConnBound
 	outbound        transport.TcpConnBound
 	proxyServerAddr string
+	// the streams are carried by the physical connections wrapped with the outbound already
+	muxed bool
+	// the target address is sent with the first payload within the websocket handshake
+	earlyData bool
 }
 
 func NewProxyTCPRelayer(proxyServerAddr string, typ transport.Type, opts options.Options,
 	inbound, outbound transport.TcpConnBound) *ProxyTCPRelayer {
+	dialer, err := transport.NewDialer(typ, opts)
+	if err != nil {
+		dialer = errDialer(err)
+	}
+	wsOpts, ok := opts.(*options.WsOptions)
 	return &ProxyTCPRelayer{
+		earlyData:       ok && wsOpts.EarlyDataEnabled(),
 		typ:             typ,
+		opts:            opts,
 		inbound:         inbound,
 		outbound:        outbound,
-		Dialer:          transport.NewDialer(typ, opts),
+		Dialer:          dialer,
 		proxyServerAddr: proxyServerAddr,
 	}
 }
 
-func (r *ProxyTCPRelayer) RelayToProxyServer(conn net.Conn, remoteServerAddr string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
-	defer cancel()
+// WithForward dials the proxy server through the forward dialer, it must be called before WithMux
+func (r *ProxyTCPRelayer) WithForward(forward transport.Dialer) *ProxyTCPRelayer {
+	dialer, err := transport.NewDialerWithForward(r.typ, r.opts, forward)
+	if err != nil {
+		dialer = errDialer(err)
+	}
+	r.Dialer = dialer
+	return r
+}
+
+// WithBind binds the outbound connections to the proxy server, it must be called after WithForward and before WithMux
+func (r *ProxyTCPRelayer) WithBind(opts *options.BindOptions) *ProxyTCPRelayer {
+	if err := transport.SetDialerBind(r.Dialer, opts); err != nil {
+		r.Dialer = errDialer(err)
+	}
+	return r
+}
+
+// WithMux multiplexes the connections to the proxy server over the pooled physical connections,
+// the whole session including the mux preface and frames is wrapped with the outbound
+func (r *ProxyTCPRelayer) WithMux(opts options.Options) *ProxyTCPRelayer {
+	physical := r.Dialer
+	dialer := physical
+	if r.outbound != nil {
+		dialer = transport.DialFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := physical.Dial(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			return r.outbound.TcpConn(conn), nil
+		})
+	}
+	r.Dialer = transport.NewMuxDialer(dialer, opts)
+	r.muxed = true
+	return r
+}
 
+// DialRemote connects to the remote server through the proxy server
+func (r *ProxyTCPRelayer) DialRemote(ctx context.Context, remoteServerAddr string) (net.Conn, error) {
 	dstConn, err := r.Dial(ctx, r.proxyServerAddr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if r.outbound != nil {
+	if r.outbound != nil && !r.muxed {
 		dstConn = r.outbound.TcpConn(dstConn)
 	}
 	buf := addrPool.Get()
+	defer addrPool.Put(buf)
 	addr, err := address.ParseAddress(remoteServerAddr, *buf)
 	if err != nil {
-		addrPool.Put(buf)
+		dstConn.Close()
+		return nil, err
+	}
+	if r.earlyData && !r.muxed {
+		return newEarlyAddrConn(dstConn, addr), nil
+	}
+	if _, err = dstConn.Write(addr); err != nil {
+		dstConn.Close()
+		return nil, err
+	}
+	return dstConn, nil
+}
+
+// earlyAddrConn sends the target address with the first payload in one write, so that both of them are
+// carried by the early data, the address is sent alone if the remote speaks first
+type earlyAddrConn struct {
+	net.Conn
+	mu    sync.Mutex
+	addr  []byte
+	timer *time.Timer
+}
+
+func newEarlyAddrConn(conn net.Conn, addr []byte) *earlyAddrConn {
+	return &earlyAddrConn{Conn: conn, addr: bytes.Clone(addr)}
+}
+
+func (c *earlyAddrConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.addr == nil {
+		c.mu.Unlock()
+		return c.Conn.Write(b)
+	}
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	addr := c.addr
+	c.addr = nil
+	n, err := c.Conn.Write(append(addr, b...))
+	return max(n-len(addr), 0), err
+}
+
+// Read the address is flushed after a while if there is no payload to send, since the handshake
+// is delayed until the first write
+func (c *earlyAddrConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.addr != nil && c.timer == nil {
+		c.timer = time.AfterFunc(earlyAddrFlushDelay, c.flush)
+	}
+	c.mu.Unlock()
+	return c.Conn.Read(b)
+}
+
+func (c *earlyAddrConn) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.addr != nil {
+		c.Conn.Write(c.addr)
+		c.addr = nil
+	}
+}
+
+func (c *earlyAddrConn) Close() error {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (r *ProxyTCPRelayer) RelayToProxyServer(conn net.Conn, remoteServerAddr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	dstConn, err := r.DialRemote(ctx, remoteServerAddr)
+	if err != nil {
 		return err
 	}
-	dstConn.Write(addr)
-	addrPool.Put(buf)
 
 	logger.Logger.Info("tcp-relay",
 		logx.String("type", r.typ.String()),
@@ -123,10 +268,20 @@ func (r *ProxyTCPRelayer) RelayToProxyServer(conn net.Conn, remoteServerAddr str
 	return IoCopyBidirectionalForStream(dstConn, conn)
 }
 
-func (r *ProxyTCPRelayer) RelayToServer(conn net.Conn) error {
+// WrapInbound wraps the connection from the proxy client with the inbound
+func (r *ProxyTCPRelayer) WrapInbound(conn net.Conn) net.Conn {
 	if r.inbound != nil {
-		conn = r.inbound.TcpConn(conn)
+		return r.inbound.TcpConn(conn)
 	}
+	return conn
+}
+
+func (r *ProxyTCPRelayer) RelayToServer(conn net.Conn) error {
+	return r.RelayInboundToServer(r.WrapInbound(conn))
+}
+
+// RelayInboundToServer relays the connection which is wrapped with the inbound already, such as the mux streams
+func (r *ProxyTCPRelayer) RelayInboundToServer(conn net.Conn) error {
 	buf := addrPool.Get()
 	addr, err := address.ParseAddressFromReader(conn, *buf)
 	if err != nil {
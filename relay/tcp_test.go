@@ -0,0 +1,228 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/server"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordConn records the writes and blocks the reads until it's closed
+type recordConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes [][]byte
+	done   chan struct{}
+}
+
+func newRecordConn() *recordConn { return &recordConn{done: make(chan struct{})} }
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes = append(c.writes, bytes.Clone(b))
+	return len(b), nil
+}
+
+func (c *recordConn) Read([]byte) (int, error) {
+	<-c.done
+	return 0, io.EOF
+}
+
+func (c *recordConn) Close() error {
+	close(c.done)
+	return nil
+}
+
+func (c *recordConn) recorded() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.writes...)
+}
+
+func TestEarlyAddrConnCoalesce(t *testing.T) {
+	rc := newRecordConn()
+	conn := newEarlyAddrConn(rc, []byte("addr"))
+	defer conn.Close()
+
+	go conn.Read(make([]byte, 16))
+	n, err := conn.Write([]byte("payload"))
+	assert.Nil(t, err)
+	assert.Equal(t, len("payload"), n)
+	n, err = conn.Write([]byte("next"))
+	assert.Nil(t, err)
+	assert.Equal(t, len("next"), n)
+
+	// the timer of the read is stopped by the first write
+	time.Sleep(2 * earlyAddrFlushDelay)
+	assert.Equal(t, [][]byte{[]byte("addrpayload"), []byte("next")}, rc.recorded())
+}
+
+func TestEarlyAddrConnFlush(t *testing.T) {
+	rc := newRecordConn()
+	conn := newEarlyAddrConn(rc, []byte("addr"))
+	defer conn.Close()
+
+	// the remote speaks first, so the address is sent alone
+	go conn.Read(make([]byte, 16))
+	assert.Eventually(t, func() bool { return len(rc.recorded()) == 1 }, time.Second, 10*time.Millisecond)
+	conn.Write([]byte("payload"))
+	assert.Equal(t, [][]byte{[]byte("addr"), []byte("payload")}, rc.recorded())
+}
+
+// startCaptureProxy forwards the connections to the target and records the handshake requests
+func startCaptureProxy(t *testing.T, target string) (string, func() []*http.Request) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var requests []*http.Request
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				remote, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer remote.Close()
+				var raw bytes.Buffer
+				req, err := http.ReadRequest(bufio.NewReader(io.TeeReader(conn, &raw)))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				requests = append(requests, req)
+				mu.Unlock()
+				// the handshake request has no body, and the client waits for the response before sending frames
+				remote.Write(raw.Bytes())
+				go io.Copy(remote, conn)
+				io.Copy(conn, remote)
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), requests...)
+	}
+}
+
+// startWsEchoServer echoes the data after the target address which must be the expected one
+func startWsEchoServer(t *testing.T, opts *options.WsOptions, target string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	srv := server.NewWsServer(addr, server.WsHandlerFunc(func(conn net.Conn) {
+		got, err := address.ParseAddressFromReader(conn, make([]byte, 259))
+		if err != nil || got.String() != target {
+			return
+		}
+		io.Copy(conn, conn)
+	}), opts)
+	go srv.Start(context.Background())
+	t.Cleanup(func() { srv.Close() })
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return addr
+}
+
+func TestWsEarlyDataRelay(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	const target = "example.com:443"
+	targetAddr, err := address.ParseAddress(target, make([]byte, 259))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(*options.WsOptions)
+		early  func(*http.Request) string
+	}{
+		{
+			name:   "header",
+			modify: func(o *options.WsOptions) {},
+			early:  func(r *http.Request) string { return r.Header.Get("Sec-WebSocket-Protocol") },
+		},
+		{
+			name:   "path",
+			modify: func(o *options.WsOptions) { o.EarlyDataHeader, o.EarlyDataPath = "", true },
+			early:  func(r *http.Request) string { return strings.TrimPrefix(r.URL.Path, "/ws") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *options.DefaultWsOptions
+			opts.Host = ""
+			opts.MaxEarlyData = 2048
+			tt.modify(&opts)
+			proxyAddr, requests := startCaptureProxy(t, startWsEchoServer(t, &opts, target))
+
+			relayer := NewProxyTCPRelayer(proxyAddr, transport.Websocket, &opts, nil, nil)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := relayer.DialRemote(ctx, target)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			_, err = conn.Write([]byte("hello early data"))
+			assert.Nil(t, err)
+			buf := make([]byte, len("hello early data"))
+			_, err = io.ReadFull(conn, buf)
+			assert.Nil(t, err)
+			assert.Equal(t, "hello early data", string(buf))
+
+			// both the address and the first payload are carried by the handshake request
+			if assert.Len(t, requests(), 1) {
+				early, err := base64.RawURLEncoding.DecodeString(tt.early(requests()[0]))
+				assert.Nil(t, err)
+				assert.Equal(t, append(bytes.Clone(targetAddr), "hello early data"...), early)
+			}
+		})
+	}
+}
+
+func TestWsEarlyDataPathNotServed(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	serverOpts := *options.DefaultWsOptions
+	serverOpts.Host = ""
+	addr := startWsEchoServer(t, &serverOpts, "example.com:443")
+
+	// the server without the path mode only serves the exact path
+	clientOpts := serverOpts
+	clientOpts.MaxEarlyData = 2048
+	clientOpts.EarlyDataHeader, clientOpts.EarlyDataPath = "", true
+	relayer := NewProxyTCPRelayer(addr, transport.Websocket, &clientOpts, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := relayer.DialRemote(ctx, "example.com:443")
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	assert.NotNil(t, err)
+}
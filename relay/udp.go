@@ -9,7 +9,9 @@ import (
 
 	"github.com/josexy/mini-ss/address"
 	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/options"
 	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/util/logger"
 )
 
 const udpPacketTimeout = 30 * time.Second
@@ -50,7 +52,9 @@ func IoCopyBidirectionalForPacket(srcConn, dstConn net.PacketConn, serverAddr st
 			if err != nil {
 				continue
 			}
-			dstConn.WriteTo(b, targetAddr)
+			if _, err = dstConn.WriteTo(b, targetAddr); err != nil {
+				logger.Logger.ErrorBy(err)
+			}
 		}
 	}()
 
@@ -82,16 +86,24 @@ func IoCopyBidirectionalForPacket(srcConn, dstConn net.PacketConn, serverAddr st
 			if err != nil {
 				continue
 			}
-			srcConn.WriteTo(b, srcAddr)
+			if _, err = srcConn.WriteTo(b, srcAddr); err != nil {
+				logger.Logger.ErrorBy(err)
+			}
 		}
 	}()
 	return <-errCh
 }
 
-type UDPDirectRelayer struct{}
+type UDPDirectRelayer struct{ bind *options.BindOptions }
 
 func NewUDPDirectRelayer() *UDPDirectRelayer { return new(UDPDirectRelayer) }
 
+// WithBind binds the outbound udp sockets to the interface, source ip and routing mark
+func (r *UDPDirectRelayer) WithBind(opts *options.BindOptions) *UDPDirectRelayer {
+	r.bind = opts
+	return r
+}
+
 func (r *UDPDirectRelayer) RelayToServer(conn net.PacketConn, remoteServerAddr string) error {
 	var udpReadFromSrc udpProxyReadFromSrcFunc
 	var udpWriteToSrc udpProxyWriteToSrcFunc
@@ -145,7 +157,7 @@ func (r *UDPDirectRelayer) RelayToServer(conn net.PacketConn, remoteServerAddr s
 		}
 	}
 
-	dstConn, err := transport.ListenLocalUDP(context.Background())
+	dstConn, err := transport.ListenUDPWithBind(context.Background(), "", r.bind)
 	if err != nil {
 		return err
 	}
@@ -155,6 +167,8 @@ func (r *UDPDirectRelayer) RelayToServer(conn net.PacketConn, remoteServerAddr s
 type ProxyUDPRelayer struct {
 	proxyServerAddr   string
 	inbound, outbound transport.UdpConnBound
+	bind              *options.BindOptions
+	dialer            transport.PacketDialer
 }
 
 func NewProxyUDPRelayer(proxyServerAddr string, inbound, outbound transport.UdpConnBound) *ProxyUDPRelayer {
@@ -165,13 +179,33 @@ func NewProxyUDPRelayer(proxyServerAddr string, inbound, outbound transport.UdpC
 	}
 }
 
+// WithBind binds the outbound udp sockets to the interface, source ip and routing mark
+func (r *ProxyUDPRelayer) WithBind(opts *options.BindOptions) *ProxyUDPRelayer {
+	r.bind = opts
+	return r
+}
+
+// WithPacketDialer relays the udp packets over the transport of the dialer instead of the plain udp
+func (r *ProxyUDPRelayer) WithPacketDialer(dialer transport.PacketDialer) *ProxyUDPRelayer {
+	r.dialer = dialer
+	return r
+}
+
 func (r *ProxyUDPRelayer) RelayToProxyServer(conn net.PacketConn, remoteServerAddr string) error {
 	targetAddr, err := net.ResolveUDPAddr("udp", r.proxyServerAddr)
 	if err != nil {
 		return err
 	}
 
-	dstConn, err := transport.ListenLocalUDP(context.Background())
+	var dstConn net.PacketConn
+	serverAddr := r.proxyServerAddr
+	if r.dialer != nil {
+		// all the packets are received from the proxy server over the transport
+		serverAddr = ""
+		dstConn, err = r.dialer.ListenPacket(context.Background(), r.proxyServerAddr)
+	} else {
+		dstConn, err = transport.ListenUDPWithBind(context.Background(), "", r.bind)
+	}
 	if err != nil {
 		return err
 	}
@@ -200,12 +234,10 @@ func (r *ProxyUDPRelayer) RelayToProxyServer(conn net.PacketConn, remoteServerAd
 			return buf[:n+len(addr)], targetAddr, nil
 		}
 		// UDP Server -> SS Server -> [SS Client] -> UDP Client
-		udpWriteToSrc = func(src net.Addr, buf []byte, n int) ([]byte, error) {
+		udpWriteToSrc = func(_ net.Addr, buf []byte, n int) ([]byte, error) {
 			// buf: {remote address} {UDP data}
-			b := addrPool.Get()
-			addr, err := address.ParseAddress(src.String(), *b)
+			addr, err := address.ParseAddressFromBuffer(buf[:n])
 			if err != nil {
-				addrPool.Put(b)
 				return nil, err
 			}
 			// return: {UDP data}
@@ -235,5 +267,5 @@ func (r *ProxyUDPRelayer) RelayToProxyServer(conn net.PacketConn, remoteServerAd
 		}
 	}
 
-	return IoCopyBidirectionalForPacket(conn, dstConn, r.proxyServerAddr, udpReadFromSrc, udpWriteToSrc)
+	return IoCopyBidirectionalForPacket(conn, dstConn, serverAddr, udpReadFromSrc, udpWriteToSrc)
 }
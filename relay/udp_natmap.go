@@ -129,7 +129,9 @@ func (r *NatmapUDPRelayer) relayUDP(conn net.PacketConn, udpReadFromSrc udpProxy
 				logger.Logger.ErrorBy(err)
 				continue
 			}
-			conn.WriteTo(b, srcAddr)
+			if _, err = conn.WriteTo(b, srcAddr); err != nil {
+				logger.Logger.ErrorBy(err)
+			}
 		}
 	}
 
@@ -172,6 +174,8 @@ func (r *NatmapUDPRelayer) relayUDP(conn net.PacketConn, udpReadFromSrc udpProxy
 			go handleDstToRelayer(srcAddr, dstConn, targetAddr.String())
 		}
 
-		dstConn.WriteTo(b, targetAddr)
+		if _, err = dstConn.WriteTo(b, targetAddr); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
 	}
 }
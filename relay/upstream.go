@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/josexy/logx"
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/client"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+type upstreamDialFunc func(context.Context, string) (net.Conn, error)
+
+// UpstreamTCPRelayer relays the connections through the upstream socks5 or http proxy server
+type UpstreamTCPRelayer struct {
+	typ             string
+	dial            upstreamDialFunc
+	proxyServerAddr string
+}
+
+func newSocks5Client(proxyServerAddr string, auth *url.Userinfo, tlsConfig *tls.Config) *client.Socks5Client {
+	cli := client.NewSocks5Client(proxyServerAddr)
+	if auth != nil {
+		password, _ := auth.Password()
+		cli.SetSocksAuth(auth.Username(), password)
+	}
+	cli.SetTLSConfig(tlsConfig)
+	return cli
+}
+
+func NewSocks5TCPRelayer(proxyServerAddr string, auth *url.Userinfo, tlsConfig *tls.Config) *UpstreamTCPRelayer {
+	return &UpstreamTCPRelayer{
+		typ:             "socks5",
+		proxyServerAddr: proxyServerAddr,
+		dial: func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := newSocks5Client(proxyServerAddr, auth, tlsConfig).Dial(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		},
+	}
+}
+
+func NewHttpTCPRelayer(proxyServerAddr string, auth *url.Userinfo, tlsConfig *tls.Config) *UpstreamTCPRelayer {
+	cli := client.NewHttpClient(proxyServerAddr)
+	if auth != nil {
+		password, _ := auth.Password()
+		cli.SetHttpAuth(auth.Username(), password)
+	}
+	cli.SetTLSConfig(tlsConfig)
+	return &UpstreamTCPRelayer{
+		typ:             "http",
+		proxyServerAddr: proxyServerAddr,
+		dial:            cli.Dial,
+	}
+}
+
+// DialRemote connects to the remote server through the upstream proxy server
+func (r *UpstreamTCPRelayer) DialRemote(ctx context.Context, remoteServerAddr string) (net.Conn, error) {
+	return r.dial(ctx, remoteServerAddr)
+}
+
+func (r *UpstreamTCPRelayer) RelayToProxyServer(conn net.Conn, remoteServerAddr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	dstConn, err := r.dial(ctx, remoteServerAddr)
+	if err != nil {
+		return err
+	}
+
+	logger.Logger.Info("tcp-relay",
+		logx.String("type", r.typ),
+		logx.Any("client", conn.RemoteAddr()),
+		logx.Any("relayer", conn.LocalAddr()),
+		logx.String("server", r.proxyServerAddr),
+		logx.String("remote", remoteServerAddr),
+	)
+
+	return IoCopyBidirectionalForStream(dstConn, conn)
+}
+
+// Socks5UDPRelayer relays the udp packets through the udp association of the upstream socks5 proxy server
+type Socks5UDPRelayer struct {
+	proxyServerAddr string
+	auth            *url.Userinfo
+	tlsConfig       *tls.Config
+}
+
+func NewSocks5UDPRelayer(proxyServerAddr string, auth *url.Userinfo, tlsConfig *tls.Config) *Socks5UDPRelayer {
+	return &Socks5UDPRelayer{
+		proxyServerAddr: proxyServerAddr,
+		auth:            auth,
+		tlsConfig:       tlsConfig,
+	}
+}
+
+func (r *Socks5UDPRelayer) RelayToProxyServer(conn net.PacketConn, remoteServerAddr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	// the association is alive as long as the control connection
+	cli := newSocks5Client(r.proxyServerAddr, r.auth, r.tlsConfig)
+	defer cli.Close()
+	relayAddr, err := cli.UDPAssociate(ctx)
+	if err != nil {
+		return err
+	}
+
+	dstConn, err := transport.ListenLocalUDP(context.Background())
+	if err != nil {
+		return err
+	}
+
+	var udpReadFromSrc udpProxyReadFromSrcFunc
+	var udpWriteToSrc udpProxyWriteToSrcFunc
+
+	if remoteServerAddr != "" {
+		addr, err := address.ParseAddress(remoteServerAddr, make([]byte, bufferpool.MaxAddressBufferSize))
+		if err != nil {
+			return err
+		}
+		// UDP Client -> [Relayer] -> Socks5 Server -> UDP Server
+		udpReadFromSrc = func(_ net.Addr, buf []byte, n int) ([]byte, net.Addr, error) {
+			// buf: {UDP data}
+			copy(buf[3+len(addr):], buf[:n])
+			copy(buf[3:], addr)
+			buf[0], buf[1], buf[2] = 0x00, 0x00, 0x00
+			// return: {0x00,0x00,0x00} {remote address} {UDP data}
+			return buf[:3+len(addr)+n], relayAddr, nil
+		}
+		// UDP Server -> Socks5 Server -> [Relayer] -> UDP Client
+		udpWriteToSrc = func(_ net.Addr, buf []byte, n int) ([]byte, error) {
+			if n < 3 {
+				return nil, io.ErrShortBuffer
+			}
+			// buf: {0x00,0x00,0x00} {remote address} {UDP data}
+			addr, err := address.ParseAddressFromBuffer(buf[3:n])
+			if err != nil {
+				return nil, err
+			}
+			// return: {UDP data}
+			return buf[3+len(addr) : n], nil
+		}
+	} else {
+		// the socks5 udp datagrams are relayed as is
+		// UDP Client -> Socks5 Client -> [Socks5 Server + Relayer] -> Socks5 Server -> UDP Server
+		udpReadFromSrc = func(_ net.Addr, buf []byte, n int) ([]byte, net.Addr, error) {
+			return buf[:n], relayAddr, nil
+		}
+		udpWriteToSrc = func(_ net.Addr, buf []byte, n int) ([]byte, error) {
+			return buf[:n], nil
+		}
+	}
+
+	return IoCopyBidirectionalForPacket(conn, dstConn, relayAddr.String(), udpReadFromSrc, udpWriteToSrc)
+}
@@ -0,0 +1,273 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func acceptLoop(t *testing.T, serve func(net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func startStreamEcho(t *testing.T) string {
+	return acceptLoop(t, func(conn net.Conn) { io.Copy(conn, conn) })
+}
+
+func startPacketEcho(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, bufferpool.MaxUdpBufferSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func socks5Datagram(target string, data []byte) []byte {
+	addr, _ := address.ParseAddress(target, make([]byte, bufferpool.MaxAddressBufferSize))
+	return append(append([]byte{0x00, 0x00, 0x00}, addr...), data...)
+}
+
+// startUpstreamSocks5 a minimal socks5 server with the username/password authentication,
+// which supports CONNECT and UDP ASSOCIATE
+func startUpstreamSocks5(t *testing.T, user, password string) string {
+	return acceptLoop(t, func(conn net.Conn) {
+		buf := make([]byte, bufferpool.MaxSocksBufferSize)
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		io.ReadFull(conn, buf[:buf[1]])
+		conn.Write([]byte{0x05, 0x02})
+		io.ReadFull(conn, buf[:2])
+		uname := make([]byte, buf[1])
+		io.ReadFull(conn, uname)
+		io.ReadFull(conn, buf[:1])
+		passwd := make([]byte, buf[0])
+		io.ReadFull(conn, passwd)
+		if string(uname) != user || string(passwd) != password {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		if _, err := io.ReadFull(conn, buf[:3]); err != nil {
+			return
+		}
+		cmd := buf[1]
+		addr, err := address.ParseAddressFromReader(conn, buf[3:])
+		if err != nil {
+			return
+		}
+		reply := func(bindAddr string) {
+			bind, _ := address.ParseAddress(bindAddr, make([]byte, bufferpool.MaxAddressBufferSize))
+			conn.Write(append([]byte{0x05, 0x00, 0x00}, bind...))
+		}
+		switch cmd {
+		case 0x01:
+			dst, err := net.Dial("tcp", addr.String())
+			if err != nil {
+				return
+			}
+			defer dst.Close()
+			reply(dst.LocalAddr().String())
+			go io.Copy(dst, conn)
+			io.Copy(conn, dst)
+		case 0x03:
+			relay, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				return
+			}
+			defer relay.Close()
+			port := relay.LocalAddr().(*net.UDPAddr).Port
+			reply(net.JoinHostPort("0.0.0.0", strconv.Itoa(port)))
+			go func() {
+				io.Copy(io.Discard, conn)
+				relay.Close()
+			}()
+			var client net.Addr
+			b := make([]byte, bufferpool.MaxUdpBufferSize)
+			for {
+				n, from, err := relay.ReadFrom(b)
+				if err != nil {
+					return
+				}
+				if client == nil || from.String() == client.String() {
+					client = from
+					target, err := address.ParseAddressFromBuffer(b[3:n])
+					if err != nil {
+						continue
+					}
+					targetAddr, _ := net.ResolveUDPAddr("udp", target.String())
+					relay.WriteTo(b[3+len(target):n], targetAddr)
+					continue
+				}
+				relay.WriteTo(socks5Datagram(from.String(), b[:n]), client)
+			}
+		}
+	})
+}
+
+// startUpstreamHttpProxy a minimal http proxy server with the basic authentication, which supports CONNECT
+func startUpstreamHttpProxy(t *testing.T, user, password string) string {
+	return acceptLoop(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)) {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		dst, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer dst.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(dst, br)
+		io.Copy(conn, dst)
+	})
+}
+
+func TestUpstreamTCPRelayer(t *testing.T) {
+	target := startStreamEcho(t)
+	auth := url.UserPassword("user", "pass")
+	tests := []struct {
+		name    string
+		relayer *UpstreamTCPRelayer
+	}{
+		{name: "socks5", relayer: NewSocks5TCPRelayer(startUpstreamSocks5(t, "user", "pass"), auth, nil)},
+		{name: "http", relayer: NewHttpTCPRelayer(startUpstreamHttpProxy(t, "user", "pass"), auth, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := tt.relayer.DialRemote(ctx, target)
+			if !assert.Nil(t, err) {
+				return
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			assertStreamRoundTrip(t, conn)
+			conn.Close()
+
+			// the inbound connection is relayed until it's closed
+			src, inbound := net.Pipe()
+			errCh := make(chan error, 1)
+			go func() { errCh <- tt.relayer.RelayToProxyServer(inbound, target) }()
+			src.SetDeadline(time.Now().Add(5 * time.Second))
+			assertStreamRoundTrip(t, src)
+			src.Close()
+			select {
+			case <-errCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the relay is not finished")
+			}
+		})
+	}
+}
+
+func assertStreamRoundTrip(t *testing.T, conn net.Conn) {
+	for _, payload := range []string{"hello", "world"} {
+		go conn.Write([]byte(payload))
+		got := make([]byte, len(payload))
+		_, err := io.ReadFull(conn, got)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, string(got))
+	}
+}
+
+func TestUpstreamTCPRelayerAuthFailure(t *testing.T) {
+	target := startStreamEcho(t)
+	auth := url.UserPassword("user", "wrong")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := NewSocks5TCPRelayer(startUpstreamSocks5(t, "user", "pass"), auth, nil).DialRemote(ctx, target)
+	assert.EqualError(t, err, "socks authentication failure")
+	_, err = NewHttpTCPRelayer(startUpstreamHttpProxy(t, "user", "pass"), auth, nil).DialRemote(ctx, target)
+	assert.ErrorContains(t, err, "407 Proxy Authentication Required")
+	// the connection to the inbound is not relayed
+	src, inbound := net.Pipe()
+	defer src.Close()
+	assert.NotNil(t, NewHttpTCPRelayer(startUpstreamHttpProxy(t, "user", "pass"), nil, nil).RelayToProxyServer(inbound, target))
+}
+
+func TestSocks5UDPRelayer(t *testing.T) {
+	target := startPacketEcho(t)
+	relayer := NewSocks5UDPRelayer(startUpstreamSocks5(t, "user", "pass"), url.UserPassword("user", "pass"), nil)
+	tests := []struct {
+		name   string
+		remote string
+		packet func([]byte) []byte
+	}{
+		// the raw udp data is wrapped for the fixed remote address
+		{name: "remote", remote: target, packet: func(b []byte) []byte { return b }},
+		// the socks5 udp datagrams are relayed as is
+		{name: "socks5", packet: func(b []byte) []byte { return socks5Datagram(target, b) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			errCh := make(chan error, 1)
+			go func() { errCh <- relayer.RelayToProxyServer(inbound, tt.remote) }()
+
+			src, err := net.Dial("udp", inbound.LocalAddr().String())
+			assert.Nil(t, err)
+			defer src.Close()
+			src.SetDeadline(time.Now().Add(5 * time.Second))
+			for _, payload := range []string{"hello", "world"} {
+				_, err = src.Write(tt.packet([]byte(payload)))
+				assert.Nil(t, err)
+				buf := make([]byte, 512)
+				n, err := src.Read(buf)
+				if !assert.Nil(t, err) {
+					break
+				}
+				assert.Equal(t, tt.packet([]byte(payload)), buf[:n])
+			}
+			inbound.Close()
+			select {
+			case <-errCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the relay is not finished")
+			}
+		})
+	}
+}
@@ -13,12 +13,13 @@ import (
 	"net/url"
 	"time"
 
-	"github.com/josexy/cropstun/bind"
 	"github.com/josexy/mini-ss/bufferpool"
-	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/sockopt"
 	"github.com/josexy/mini-ss/util/dnsutil"
 	"github.com/josexy/mini-ss/util/logger"
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 )
 
 const dohMimeType = "application/dns-message"
@@ -29,7 +30,10 @@ type DnsClient struct {
 	addr   string
 	dnsC   *dns.Client
 	httpC  *http.Client
+	doqC   *doqClient
 	pool   *bufferpool.BufferPool
+	// edns client subnet sent to the nameserver, may be invalid
+	ecs netip.Prefix
 }
 
 func NewDnsClient(dnsNet string, addr string, defaultDnsTimeout time.Duration) *DnsClient {
@@ -38,7 +42,41 @@ func NewDnsClient(dnsNet string, addr string, defaultDnsTimeout time.Duration) *
 		pool: bufferpool.NewBufferPool(4096 * 2),
 	}
 
-	if dnsNet == "https" {
+	switch dnsNet {
+	case "quic":
+		client.host, _, _ = net.SplitHostPort(addr)
+		client.doqC = newDoQClient(addr, client.host, defaultDnsTimeout)
+	case "h3":
+		urlres, _ := url.Parse(addr)
+		client.host = urlres.Hostname()
+		// GET requests over HTTP/3 can be sent with 0-RTT
+		client.method = http3.MethodGet0RTT
+		client.httpC = &http.Client{
+			Timeout: defaultDnsTimeout,
+			Transport: &http3.Transport{
+				TLSClientConfig: &tls.Config{
+					ServerName:         client.host,
+					ClientSessionCache: tls.NewLRUClientSessionCache(32),
+				},
+				QUICConfig: &quic.Config{
+					HandshakeIdleTimeout: defaultDnsTimeout,
+					MaxIdleTimeout:       30 * time.Second,
+				},
+				Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+					conn, err := dialEarly(ctx, addr, tlsCfg, cfg)
+					if err != nil {
+						return nil, err
+					}
+					// release the udp socket once the connection is closed
+					go func() {
+						<-conn.Context().Done()
+						conn.pconn.Close()
+					}()
+					return conn.EarlyConnection, nil
+				},
+			},
+		}
+	case "https":
 		urlres, _ := url.Parse(addr)
 		client.host = urlres.Hostname()
 		client.method = http.MethodGet
@@ -47,9 +85,9 @@ func NewDnsClient(dnsNet string, addr string, defaultDnsTimeout time.Duration) *
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
 					dialer := &net.Dialer{Timeout: defaultDnsTimeout}
-					if options.DefaultOptions.OutboundInterface != "" {
-						ip, _ := netip.ParseAddr(client.host)
-						bind.BindToDeviceForConn(options.DefaultOptions.OutboundInterface, dialer, "tcp", ip)
+					ip, _ := netip.ParseAddr(client.host)
+					if err := setupDialer(dialer, network, ip); err != nil {
+						return nil, err
 					}
 					return dialer.DialContext(ctx, network, addr)
 				},
@@ -57,17 +95,17 @@ func NewDnsClient(dnsNet string, addr string, defaultDnsTimeout time.Duration) *
 				IdleConnTimeout:     time.Second * 5,
 			},
 		}
-	} else {
+	default:
 		client.host, _, _ = net.SplitHostPort(addr)
 
 		dialer := &net.Dialer{Timeout: defaultDnsTimeout}
-		if options.DefaultOptions.OutboundInterface != "" {
-			ip, _ := netip.ParseAddr(client.host)
-			network := "tcp"
-			if dnsNet == "udp" {
-				network = "udp"
-			}
-			bind.BindToDeviceForConn(options.DefaultOptions.OutboundInterface, dialer, network, ip)
+		ip, _ := netip.ParseAddr(client.host)
+		network := "tcp"
+		if dnsNet == "udp" {
+			network = "udp"
+		}
+		if err := setupDialer(dialer, network, ip); err != nil {
+			logger.Logger.ErrorBy(err)
 		}
 
 		client.dnsC = &dns.Client{
@@ -86,6 +124,15 @@ func NewDnsClient(dnsNet string, addr string, defaultDnsTimeout time.Duration) *
 	return client
 }
 
+// setupDialer binds the sockets to the global outbound interface and routing mark
+func setupDialer(dialer *net.Dialer, network string, dst netip.Addr) error {
+	b := sockopt.NewBind(nil)
+	if b.Empty() {
+		return nil
+	}
+	return b.SetupDialer(dialer, network, dst)
+}
+
 func (c *DnsClient) ExchangeContext(ctx context.Context, request *dns.Msg) (reply *dns.Msg, err error) {
 	defer func() {
 		if err != nil {
@@ -93,11 +140,35 @@ func (c *DnsClient) ExchangeContext(ctx context.Context, request *dns.Msg) (repl
 		}
 	}()
 	domain := dnsutil.TrimDomain(request.Question[0].Name)
-	if c.dnsC != nil {
-		logger.Logger.Tracef("dns exchange: %s for domain: %s", c.addr, domain)
+	logger.Logger.Tracef("dns exchange: %s for domain: %s", c.addr, domain)
+
+	// the domain policy takes precedence over the client subnet of the nameserver
+	subnet, ok := DefaultClientSubnetPolicy.Lookup(domain)
+	if !ok && c.ecs.IsValid() {
+		subnet, ok = c.ecs, true
+	}
+	var ednsAdded bool
+	if ok {
+		// the request may be shared with other nameservers
+		request = request.Copy()
+		if subnet.IsValid() {
+			ednsAdded = setClientSubnet(request, subnet)
+		} else {
+			stripClientSubnet(request)
+		}
+	}
+	defer func() {
+		if err == nil && reply != nil && ednsAdded {
+			removeEdns0(reply)
+		}
+	}()
+
+	switch {
+	case c.dnsC != nil:
 		reply, _, err = c.dnsC.ExchangeContext(ctx, request, c.addr)
-	} else {
-		logger.Logger.Tracef("dns exchange: %s for domain: %s", c.addr, domain)
+	case c.doqC != nil:
+		reply, err = c.doqC.ExchangeContext(ctx, request)
+	default:
 		reply, err = c.exchangeDoH(ctx, request)
 	}
 	return
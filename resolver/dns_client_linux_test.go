@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/sockopt"
+	"github.com/josexy/mini-ss/util/dnsutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func getMark(c syscall.RawConn) (mark int, err error) {
+	var innerErr error
+	if err = c.Control(func(fd uintptr) {
+		mark, innerErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK)
+	}); err != nil {
+		return
+	}
+	return mark, innerErr
+}
+
+func setRoutingMark(t *testing.T, mark int) {
+	old := options.DefaultOptions.RoutingMark
+	options.DefaultOptions.RoutingMark = mark
+	t.Cleanup(func() { options.DefaultOptions.RoutingMark = old })
+}
+
+func startLocalDnsServer(t *testing.T, network string) string {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reply := new(dns.Msg)
+		reply.SetReply(req)
+		reply.Answer = append(reply.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.IPv4(1, 2, 3, 4),
+		})
+		w.WriteMsg(reply)
+	})
+	srv := &dns.Server{Net: network, Handler: handler}
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		srv.PacketConn = pc
+	} else {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		srv.Listener = ln
+	}
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	if srv.PacketConn != nil {
+		return srv.PacketConn.LocalAddr().String()
+	}
+	return srv.Listener.Addr().String()
+}
+
+func TestDnsClientRoutingMark(t *testing.T) {
+	setRoutingMark(t, 0x1234)
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			client := NewDnsClient(network, startLocalDnsServer(t, network), 3*time.Second)
+			marks := make(chan int, 1)
+			// the control runs after the ones of the routing mark
+			sockopt.AddDialerControl(client.dnsC.Dialer, func(c syscall.RawConn) error {
+				mark, err := getMark(c)
+				marks <- mark
+				return err
+			})
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeA)
+			reply, err := client.ExchangeContext(context.Background(), req)
+			if errors.Is(err, unix.EPERM) {
+				t.Skip("CAP_NET_ADMIN is required to set the routing mark")
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "1.2.3.4", dnsutil.MsgToAddrs(reply)[0].String())
+			assert.Equal(t, 0x1234, <-marks)
+		})
+	}
+}
+
+func TestDoQClientRoutingMark(t *testing.T) {
+	setRoutingMark(t, 0x1234)
+	addr, _ := startLocalDoQServer(t)
+
+	client := NewDnsClient("quic", addr, 5*time.Second)
+	client.doqC.tlsConfig.InsecureSkipVerify = true
+	defer client.doqC.Close()
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeA)
+	_, err := client.ExchangeContext(context.Background(), req)
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("CAP_NET_ADMIN is required to set the routing mark")
+	}
+	assert.Nil(t, err)
+
+	rc, err := client.doqC.conn.pconn.(*net.UDPConn).SyscallConn()
+	assert.Nil(t, err)
+	mark, err := getMark(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, 0x1234, mark)
+}
@@ -16,7 +16,8 @@ var (
 		"8.8.8.8",
 	}
 
-	DefaultDomainFilter []string
+	// DefaultDomainFilter the domains which are resolved to real ip addresses in fake ip mode
+	DefaultDomainFilter = NewDomainFilter()
 )
 
 type DnsServer struct {
@@ -0,0 +1,136 @@
+package resolver
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/josexy/mini-ss/util/trie"
+)
+
+const (
+	filterPrefixSuffix  = "suffix:"
+	filterPrefixKeyword = "keyword:"
+	filterPrefixRegex   = "regex:"
+)
+
+var errInvalidFilterEntry = errors.New("invalid domain filter entry")
+
+// DomainFilter matches the domains which should be resolved to real ip addresses instead of fake ones.
+// The supported entries are:
+//
+//	www.example.com      exact domain
+//	*.lan                one level subdomain
+//	+.local              the domain itself and all subdomains
+//	.example.com         all subdomains
+//	suffix:example.com   the same as +.example.com
+//	keyword:ntp          domain contains the keyword
+//	regex:^time\d*\.     domain matches the regular expression
+type DomainFilter struct {
+	mu       sync.RWMutex
+	trie     *trie.DomainTrie
+	keywords []string
+	regexps  []*regexp.Regexp
+	size     int
+}
+
+func NewDomainFilter() *DomainFilter {
+	return &DomainFilter{trie: trie.New()}
+}
+
+// Add compiles and adds the entries to the filter
+func (f *DomainFilter) Add(entries ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, entry := range entries {
+		if err := f.add(strings.TrimSpace(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *DomainFilter) add(entry string) error {
+	if entry == "" {
+		return errInvalidFilterEntry
+	}
+	switch {
+	case strings.HasPrefix(entry, filterPrefixSuffix):
+		if err := f.trie.Insert("+."+strings.TrimPrefix(entry, filterPrefixSuffix), struct{}{}); err != nil {
+			return err
+		}
+	case strings.HasPrefix(entry, filterPrefixKeyword):
+		keyword := strings.TrimPrefix(entry, filterPrefixKeyword)
+		if keyword == "" {
+			return errInvalidFilterEntry
+		}
+		f.keywords = append(f.keywords, keyword)
+	case strings.HasPrefix(entry, filterPrefixRegex):
+		re, err := regexp.Compile(strings.TrimPrefix(entry, filterPrefixRegex))
+		if err != nil {
+			return err
+		}
+		f.regexps = append(f.regexps, re)
+	default:
+		if err := f.trie.Insert(entry, struct{}{}); err != nil {
+			return err
+		}
+	}
+	f.size++
+	return nil
+}
+
+// LoadFile adds the entries of the list file to the filter, one entry per line,
+// empty lines and lines starting with '#' are ignored
+func (f *DomainFilter) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return f.Add(entries...)
+}
+
+func (f *DomainFilter) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.size
+}
+
+func (f *DomainFilter) Match(domain string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.size == 0 || domain == "" {
+		return false
+	}
+	if f.trie.Search(domain) != nil {
+		return true
+	}
+	for _, keyword := range f.keywords {
+		if strings.Contains(domain, keyword) {
+			return true
+		}
+	}
+	for _, re := range f.regexps {
+		if re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainFilter(t *testing.T) {
+	f := NewDomainFilter()
+	assert.False(t, f.Match("www.example.com"))
+	assert.Nil(t, f.Add(
+		"www.example.com",
+		"*.lan",
+		"+.local",
+		"suffix:pool.ntp.org",
+		"keyword:playstation",
+		`regex:^time\d*\.apple\.com$`,
+	))
+	assert.Equal(t, 6, f.Len())
+
+	for _, domain := range []string{
+		"www.example.com",
+		"router.lan",
+		"local",
+		"printer.office.local",
+		"pool.ntp.org",
+		"0.pool.ntp.org",
+		"auth.np.ac.playstation.net",
+		"time1.apple.com",
+	} {
+		assert.True(t, f.Match(domain), domain)
+	}
+	for _, domain := range []string{
+		"example.com",
+		"a.b.lan",
+		"ntp.org",
+		"time.apple.com.cn",
+		"",
+	} {
+		assert.False(t, f.Match(domain), domain)
+	}
+
+	assert.NotNil(t, f.Add("regex:("))
+	assert.NotNil(t, f.Add("keyword:"))
+}
+
+func TestDomainFilterLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.list")
+	assert.Nil(t, os.WriteFile(path, []byte("# game consoles\n+.xboxlive.com\n\n  *.lan  \n"), 0644))
+
+	f := NewDomainFilter()
+	assert.Nil(t, f.LoadFile(path))
+	assert.Equal(t, 2, f.Len())
+	assert.True(t, f.Match("xboxlive.com"))
+	assert.True(t, f.Match("user.auth.xboxlive.com"))
+	assert.True(t, f.Match("nas.lan"))
+	assert.NotNil(t, f.LoadFile(filepath.Join(t.TempDir(), "missing.list")))
+}
@@ -0,0 +1,198 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/josexy/mini-ss/sockopt"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQ ALPN token, see https://datatracker.ietf.org/doc/html/rfc9250#section-4.1.1
+const doqALPN = "doq"
+
+var errDoQShortMsg = errors.New("doq: short dns message")
+
+// earlyConn bundles a quic connection with the udp socket it was dialed on,
+// since quic-go does not close a user-provided net.PacketConn
+type earlyConn struct {
+	quic.EarlyConnection
+	pconn net.PacketConn
+}
+
+func (c *earlyConn) close() {
+	c.EarlyConnection.CloseWithError(0, "")
+	c.pconn.Close()
+}
+
+func (c *earlyConn) alive() bool {
+	select {
+	case <-c.Context().Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// dialEarly dials a quic connection to addr, optionally bound to the outbound interface and routing mark.
+// Early connections allow to send data with 0-RTT if a session ticket is cached.
+func dialEarly(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*earlyConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	laddr := ""
+	if b := sockopt.NewBind(nil); !b.Empty() {
+		if laddr, err = b.SetupListenConfig(&lc, "udp", laddr); err != nil {
+			return nil, err
+		}
+	}
+	pconn, err := lc.ListenPacket(ctx, "udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.DialEarly(ctx, pconn, raddr, tlsConfig, quicConfig)
+	if err != nil {
+		pconn.Close()
+		return nil, err
+	}
+	return &earlyConn{EarlyConnection: conn, pconn: pconn}, nil
+}
+
+// doqClient DNS over QUIC client (RFC 9250)
+// All queries share a single quic connection, and each query is sent over a new stream
+type doqClient struct {
+	addr       string
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	mu         sync.Mutex
+	conn       *earlyConn
+}
+
+func newDoQClient(addr, serverName string, timeout time.Duration) *doqClient {
+	return &doqClient{
+		addr: addr,
+		tlsConfig: &tls.Config{
+			ServerName:         serverName,
+			NextProtos:         []string{doqALPN},
+			ClientSessionCache: tls.NewLRUClientSessionCache(32),
+		},
+		quicConfig: &quic.Config{
+			HandshakeIdleTimeout: timeout,
+			MaxIdleTimeout:       30 * time.Second,
+			KeepAlivePeriod:      15 * time.Second,
+		},
+	}
+}
+
+func (c *doqClient) getConn(ctx context.Context) (*earlyConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && c.conn.alive() {
+		return c.conn, nil
+	}
+	if c.conn != nil {
+		c.conn.close()
+		c.conn = nil
+	}
+	conn, err := dialEarly(ctx, c.addr, c.tlsConfig, c.quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *doqClient) resetConn(conn *earlyConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn.close()
+		c.conn = nil
+	}
+}
+
+func (c *doqClient) ExchangeContext(ctx context.Context, request *dns.Msg) (*dns.Msg, error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.exchange(ctx, conn, request)
+	if err == nil {
+		return reply, nil
+	}
+	// the cached connection may be broken, redial and try again
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	c.resetConn(conn)
+	if conn, err = c.getConn(ctx); err != nil {
+		return nil, err
+	}
+	return c.exchange(ctx, conn, request)
+}
+
+func (c *doqClient) exchange(ctx context.Context, conn *earlyConn, request *dns.Msg) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CancelRead(0)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	// the DNS Message ID MUST be set to 0 when sending queries over DoQ
+	id := request.Id
+	msg := request.Copy()
+	msg.Id = 0
+	data, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(buf, uint16(len(data)))
+	copy(buf[2:], data)
+	if _, err = stream.Write(buf); err != nil {
+		return nil, err
+	}
+	// indicate through the STREAM FIN mechanism that no further data will be sent
+	stream.Close()
+
+	if _, err = io.ReadFull(stream, buf[:2]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(buf[:2]))
+	if n < 12 {
+		return nil, errDoQShortMsg
+	}
+	data = make([]byte, n)
+	if _, err = io.ReadFull(stream, data); err != nil {
+		return nil, err
+	}
+	reply := new(dns.Msg)
+	if err = reply.Unpack(data); err != nil {
+		return nil, err
+	}
+	reply.Id = id
+	return reply, nil
+}
+
+func (c *doqClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.close()
+		c.conn = nil
+	}
+	return nil
+}
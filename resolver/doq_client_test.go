@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/util/cert"
+	"github.com/josexy/mini-ss/util/dnsutil"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func startLocalDoQServer(t *testing.T) (addr string, accepted func() int) {
+	privateKey, err := cert.GeneratePrivateKey()
+	assert.Nil(t, err)
+	serverCert, err := cert.GenerateCertificate(pkix.Name{CommonName: "localhost"},
+		[]string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)}, nil, nil, privateKey)
+	assert.Nil(t, err)
+
+	ln, err := quic.ListenAddrEarly("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		NextProtos:   []string{doqALPN},
+	}, &quic.Config{Allow0RTT: true})
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	conns := make(chan struct{}, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			conns <- struct{}{}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go serveDoQStream(stream)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() int { return len(conns) }
+}
+
+func serveDoQStream(stream quic.Stream) {
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if err != nil || len(data) < 2 {
+		return
+	}
+	req := new(dns.Msg)
+	if err = req.Unpack(data[2:]); err != nil || req.Id != 0 {
+		return
+	}
+	reply := new(dns.Msg)
+	reply.SetReply(req)
+	reply.Answer = append(reply.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.IPv4(1, 2, 3, 4),
+	})
+	out, _ := reply.Pack()
+	buf := make([]byte, 2+len(out))
+	binary.BigEndian.PutUint16(buf, uint16(len(out)))
+	copy(buf[2:], out)
+	stream.Write(buf)
+}
+
+func TestDoQClient_ExchangeContext(t *testing.T) {
+	addr, accepted := startLocalDoQServer(t)
+
+	client := NewDnsClient("quic", addr, 5*time.Second)
+	client.doqC.tlsConfig.InsecureSkipVerify = true
+	defer client.doqC.Close()
+
+	for i := 0; i < 3; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeA)
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		reply, err := client.ExchangeContext(ctx, req)
+		cancel()
+		assert.Nil(t, err)
+		assert.Equal(t, req.Id, reply.Id)
+		assert.Equal(t, "1.2.3.4", dnsutil.MsgToAddrs(reply)[0].String())
+	}
+	// all queries are sent over the same quic connection
+	assert.Equal(t, 1, accepted())
+
+	// the broken connection is redialed
+	client.doqC.conn.close()
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeA)
+	_, err := client.ExchangeContext(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, accepted())
+}
+
+func TestParseNameserverQuic(t *testing.T) {
+	list := parseNameserver([]string{"quic://dns.adguard-dns.com", "h3://dns.google/dns-query"})
+	assert.Equal(t, []nameserverExt{
+		{addr: "dns.adguard-dns.com:853", dnsNet: "quic"},
+		{addr: "https://dns.google:443/dns-query", dnsNet: "h3"},
+	}, list)
+}
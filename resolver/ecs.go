@@ -0,0 +1,139 @@
+package resolver
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/josexy/mini-ss/util/trie"
+	"github.com/miekg/dns"
+)
+
+// the default source prefix length of a bare ip address, see https://datatracker.ietf.org/doc/html/rfc7871#section-11.1
+const (
+	defaultClientSubnetBits4 = 24
+	defaultClientSubnetBits6 = 56
+)
+
+var errInvalidClientSubnet = errors.New("invalid edns client subnet")
+
+// DefaultClientSubnetPolicy overrides the edns client subnet of the nameservers for the matched domains
+var DefaultClientSubnetPolicy = NewClientSubnetPolicy()
+
+// parseClientSubnet parses a prefix such as 1.2.3.0/24 or a bare ip address,
+// "none" means that the edns client subnet is disabled and an invalid prefix is returned
+func parseClientSubnet(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return netip.Prefix{}, nil
+	}
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, errInvalidClientSubnet
+	}
+	ip = ip.Unmap()
+	if ip.Is4() {
+		return netip.PrefixFrom(ip, defaultClientSubnetBits4).Masked(), nil
+	}
+	return netip.PrefixFrom(ip, defaultClientSubnetBits6).Masked(), nil
+}
+
+// ClientSubnetPolicy the edns client subnet per domain, the domain can be an exact or wildcard domain
+type ClientSubnetPolicy struct {
+	mu   sync.RWMutex
+	trie *trie.DomainTrie
+	size int
+}
+
+func NewClientSubnetPolicy() *ClientSubnetPolicy {
+	return &ClientSubnetPolicy{trie: trie.New()}
+}
+
+// Add sets the client subnet for the domain, "none" disables the client subnet for the domain
+func (p *ClientSubnetPolicy) Add(domain, subnet string) error {
+	prefix, err := parseClientSubnet(subnet)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err = p.trie.Insert(strings.TrimSpace(domain), prefix); err != nil {
+		return err
+	}
+	p.size++
+	return nil
+}
+
+// Lookup returns the client subnet of the domain, ok is false if the domain is not matched,
+// and the returned prefix is invalid if the client subnet is disabled for the domain
+func (p *ClientSubnetPolicy) Lookup(domain string) (prefix netip.Prefix, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.size == 0 {
+		return
+	}
+	if node := p.trie.Search(domain); node != nil {
+		return node.Data.(netip.Prefix), true
+	}
+	return
+}
+
+// setClientSubnet replaces the edns client subnet option of the message,
+// the OPT record is created if not exists and added is true
+func setClientSubnet(msg *dns.Msg, prefix netip.Prefix) (added bool) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt = msg.IsEdns0()
+		added = true
+	}
+	removeClientSubnetOption(opt)
+	ecs := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		SourceNetmask: uint8(prefix.Bits()),
+		Address:       prefix.Addr().AsSlice(),
+	}
+	if prefix.Addr().Is4() {
+		ecs.Family = 1
+	} else {
+		ecs.Family = 2
+	}
+	opt.Option = append(opt.Option, ecs)
+	return
+}
+
+// stripClientSubnet removes the edns client subnet option from the message
+func stripClientSubnet(msg *dns.Msg) {
+	if opt := msg.IsEdns0(); opt != nil {
+		removeClientSubnetOption(opt)
+	}
+}
+
+// removeEdns0 removes the OPT record from the message
+func removeEdns0(msg *dns.Msg) {
+	extra := msg.Extra[:0]
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	msg.Extra = extra
+}
+
+func removeClientSubnetOption(opt *dns.OPT) {
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0SUBNET {
+			options = append(options, o)
+		}
+	}
+	opt.Option = options
+}
@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClientSubnet(t *testing.T) {
+	for s, want := range map[string]netip.Prefix{
+		"1.2.3.4":        netip.MustParsePrefix("1.2.3.0/24"),
+		"1.2.3.4/16":     netip.MustParsePrefix("1.2.0.0/16"),
+		"2001:db8::1":    netip.MustParsePrefix("2001:db8::/56"),
+		"2001:db8::/32":  netip.MustParsePrefix("2001:db8::/32"),
+		"::ffff:1.2.3.4": netip.MustParsePrefix("1.2.3.0/24"),
+		"none":           {},
+	} {
+		prefix, err := parseClientSubnet(s)
+		assert.Nil(t, err)
+		assert.Equal(t, want, prefix, s)
+	}
+	_, err := parseClientSubnet("example.com")
+	assert.NotNil(t, err)
+}
+
+// startLocalEcsDnsServer starts a dns server which answers the received client subnet as the A record
+func startLocalEcsDnsServer(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		reply := new(dns.Msg)
+		reply.SetReply(r)
+		ip := net.IPv4zero
+		if opt := r.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+					ip = ecs.Address
+				}
+			}
+			reply.SetEdns0(dns.DefaultMsgSize, false)
+			reply.IsEdns0().Option = append(reply.IsEdns0().Option, opt.Option...)
+		}
+		reply.Answer = append(reply.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   ip,
+		})
+		w.WriteMsg(reply)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestDnsClientClientSubnet(t *testing.T) {
+	old := DefaultClientSubnetPolicy
+	defer func() { DefaultClientSubnetPolicy = old }()
+	DefaultClientSubnetPolicy = NewClientSubnetPolicy()
+	assert.Nil(t, DefaultClientSubnetPolicy.Add("+.cdn.example.com", "198.51.100.1"))
+	assert.Nil(t, DefaultClientSubnetPolicy.Add("+.corp.internal", "none"))
+
+	list := parseNameserver([]string{"udp://" + startLocalEcsDnsServer(t) + "?ecs=203.0.113.0/24"})
+	assert.Len(t, list, 1)
+	assert.Equal(t, netip.MustParsePrefix("203.0.113.0/24"), list[0].ecs)
+	client := NewDnsClient(list[0].dnsNet, list[0].addr, 2*time.Second)
+	client.ecs = list[0].ecs
+
+	exchange := func(domain string, edns bool) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+		if edns {
+			req.SetEdns0(dns.DefaultMsgSize, false)
+		}
+		reply, err := client.ExchangeContext(context.Background(), req)
+		assert.Nil(t, err)
+		// the request is not modified
+		assert.Equal(t, edns, req.IsEdns0() != nil)
+		return reply
+	}
+
+	reply := exchange("www.example.com", false)
+	assert.Equal(t, "203.0.113.0", reply.Answer[0].(*dns.A).A.String())
+	// the OPT record added by the client is removed
+	assert.Nil(t, reply.IsEdns0())
+
+	reply = exchange("img.cdn.example.com", true)
+	assert.Equal(t, "198.51.100.0", reply.Answer[0].(*dns.A).A.String())
+	assert.NotNil(t, reply.IsEdns0())
+	stripClientSubnet(reply)
+	assert.Empty(t, reply.IsEdns0().Option)
+
+	reply = exchange("git.corp.internal", false)
+	assert.Equal(t, "0.0.0.0", reply.Answer[0].(*dns.A).A.String())
+}
@@ -27,12 +27,19 @@ type Record struct {
 type fakeIPResolver struct {
 	// fake ip pool
 	pool *ipPool
+	// fake ipv6 pool, may be nil
+	pool6 *ipPool
 	// host:record
 	cache cache.Cache[string, *Record]
+	// host:record for AAAA records
+	cache6 cache.Cache[string, *Record]
 	// ip:host
-	ipCache   cache.Cache[netip.Addr, *Record]
-	dnsIP     netip.Addr
-	tunPrefix netip.Prefix
+	ipCache    cache.Cache[netip.Addr, *Record]
+	dnsIP      netip.Addr
+	tunPrefix  netip.Prefix
+	tunPrefix6 netip.Prefix
+	// persisted host:ip mappings, may be nil
+	store *fakeIPStore
 }
 
 func newFakeIPResolver(cidr netip.Prefix) (*fakeIPResolver, error) {
@@ -57,77 +64,192 @@ func newFakeIPResolver(cidr netip.Prefix) (*fakeIPResolver, error) {
 		dnsIP:     dnsIP,
 		tunPrefix: netip.PrefixFrom(tunIP, pool.Bits()),
 	}
-	r.cache = cache.NewCache[string, *Record](
+	r.cache = r.newRecordCache()
+	r.ipCache = cache.NewCache[netip.Addr, *Record](
 		cache.WithMaxSize(4096),
 		cache.WithInterval(DefaultFakeIPCacheInterval),
 		cache.WithExpiration(DefaultFakeIPDnsRecordTTL),
-		cache.WithEvictCallback(r.onReleaseFakeIP),
 		cache.WithDeleteExpiredCacheOnGet(),
 		cache.WithBackgroundCheckCache(),
 	)
-	r.ipCache = cache.NewCache[netip.Addr, *Record](
+	return r, nil
+}
+
+func (r *fakeIPResolver) newRecordCache() cache.Cache[string, *Record] {
+	return cache.NewCache[string, *Record](
 		cache.WithMaxSize(4096),
 		cache.WithInterval(DefaultFakeIPCacheInterval),
 		cache.WithExpiration(DefaultFakeIPDnsRecordTTL),
+		cache.WithEvictCallback(r.onReleaseFakeIP),
 		cache.WithDeleteExpiredCacheOnGet(),
 		cache.WithBackgroundCheckCache(),
 	)
-	return r, nil
+}
+
+// enableIPv6 allocates AAAA fake records from the ipv6 prefix,
+// the first address of the prefix is pre-allocated for the tun device
+func (r *fakeIPResolver) enableIPv6(cidr netip.Prefix) error {
+	if !cidr.Addr().Is6() {
+		return errors.New("fake ip prefix is not ipv6")
+	}
+	pool, err := newIPPool(cidr)
+	if err != nil {
+		return err
+	}
+	tunIP, ok := pool.allocateFor(cidr.Addr())
+	if !ok {
+		return errors.New("can not allocate ipv6 for tun device")
+	}
+	logger.Logger.Infof("pre-allocated ipv6 for tun device: %s", tunIP.String())
+	r.pool6 = pool
+	r.tunPrefix6 = netip.PrefixFrom(tunIP, pool.Bits())
+	r.cache6 = r.newRecordCache()
+	return nil
+}
+
+// attachStore restores the persisted fake ip records and
+// keeps the records allocated afterwards in the store
+func (r *fakeIPResolver) attachStore(path string) error {
+	store, err := openFakeIPStore(path, DefaultFakeIPStoreCompactInterval)
+	if err != nil {
+		return err
+	}
+	var restored int
+	store.Range(func(domain string, ip netip.Addr) {
+		pool := r.poolFor(ip.Is6())
+		if pool == nil || !pool.IsAvailable(ip) {
+			return
+		}
+		pool.allocateFor(ip)
+		req := &dns.Msg{}
+		req.SetQuestion(dns.Fqdn(domain), qtypeFor(ip.Is6()))
+		r.saveRecord(r.newRecord(domain, ip, req))
+		restored++
+	})
+	r.store = store
+	logger.Logger.Infof("restored %d fake ip records from %s", restored, path)
+	return nil
+}
+
+func (r *fakeIPResolver) close() error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.Close()
 }
 
 func (r *fakeIPResolver) onReleaseFakeIP(_ any, value any) {
 	record := value.(*Record)
 	logger.Logger.Trace("release fake ip", logx.String("ip", record.FakeIP.String()), logx.String("domain", record.Domain))
-	r.pool.Release(record.FakeIP)
+	if pool := r.poolFor(record.FakeIP.Is6()); pool != nil {
+		pool.Release(record.FakeIP)
+	}
+}
+
+func qtypeFor(ipv6 bool) uint16 {
+	if ipv6 {
+		return dns.TypeAAAA
+	}
+	return dns.TypeA
+}
+
+func (r *fakeIPResolver) poolFor(ipv6 bool) *ipPool {
+	if ipv6 {
+		return r.pool6
+	}
+	return r.pool
+}
+
+func (r *fakeIPResolver) cacheFor(ipv6 bool) cache.Cache[string, *Record] {
+	if ipv6 {
+		return r.cache6
+	}
+	return r.cache
 }
 
 func (r *fakeIPResolver) GetAllocatedTunPrefix() netip.Prefix { return r.tunPrefix }
 
+func (r *fakeIPResolver) GetAllocatedTunPrefix6() netip.Prefix { return r.tunPrefix6 }
+
 func (r *fakeIPResolver) GetAllocatedDnsIP() netip.Addr { return r.dnsIP }
 
-func (r *fakeIPResolver) IsFakeIP(ip netip.Addr) bool { return r.pool.Contains(ip) }
+// IsIPv6Enabled reports whether AAAA queries are answered with fake ipv6 addresses
+func (r *fakeIPResolver) IsIPv6Enabled() bool { return r.pool6 != nil }
 
-func (r *fakeIPResolver) find(host string) (*Record, error) { return r.cache.Get(host) }
+func (r *fakeIPResolver) IsFakeIP(ip netip.Addr) bool {
+	pool := r.poolFor(ip.Is6())
+	return pool != nil && pool.Contains(ip)
+}
+
+func (r *fakeIPResolver) find(host string, ipv6 bool) (*Record, error) {
+	return r.cacheFor(ipv6).Get(host)
+}
 
 func (r *fakeIPResolver) FindByIP(ip netip.Addr) (*Record, error) {
 	if host, err := r.ipCache.Get(ip); err == nil {
-		return r.find(host.Domain)
+		return r.find(host.Domain, ip.Is6())
 	} else {
 		return nil, err
 	}
 }
 
-func (r *fakeIPResolver) makeNewFakeDnsRecord(host string, request *dns.Msg) (*Record, error) {
-	// allocate a fake ip for dns query host
-	fakeIP, err := r.pool.Allocate(host)
-	if err != nil {
-		return nil, err
-	}
-	if !fakeIP.IsValid() {
-		return nil, errors.New("unable to allocate fake ip from pool")
+func (r *fakeIPResolver) allocate(host string, ipv6 bool) (netip.Addr, error) {
+	pool := r.poolFor(ipv6)
+	// prefer the fake ip allocated for the host before
+	if r.store != nil {
+		if ip, ok := r.store.Lookup(host, ipv6); ok && pool.IsAvailable(ip) {
+			pool.allocateFor(ip)
+			return ip, nil
+		}
 	}
+	return pool.Allocate(host)
+}
+
+func (r *fakeIPResolver) newRecord(host string, fakeIP netip.Addr, request *dns.Msg) *Record {
 	reply := &dns.Msg{}
 	reply.SetReply(request)
 	reply.RecursionAvailable = true
-	reply.Answer = append(reply.Answer, &dns.A{
-		Hdr: dns.RR_Header{
-			Name:   dns.Fqdn(host),
-			Rrtype: dns.TypeA,
-			Class:  dns.ClassINET,
-			Ttl:    uint32(DefaultFakeIPDnsRecordTTL.Seconds()),
-		},
-		A: fakeIP.AsSlice(),
-	})
-
-	record := &Record{
+	hdr := dns.RR_Header{
+		Name:   dns.Fqdn(host),
+		Rrtype: qtypeFor(fakeIP.Is6()),
+		Class:  dns.ClassINET,
+		Ttl:    uint32(DefaultFakeIPDnsRecordTTL.Seconds()),
+	}
+	if fakeIP.Is6() {
+		reply.Answer = append(reply.Answer, &dns.AAAA{Hdr: hdr, AAAA: fakeIP.AsSlice()})
+	} else {
+		reply.Answer = append(reply.Answer, &dns.A{Hdr: hdr, A: fakeIP.AsSlice()})
+	}
+	return &Record{
 		Domain: host,
 		FakeIP: fakeIP,
 		Query:  request,
 		Reply:  reply,
 	}
+}
+
+func (r *fakeIPResolver) saveRecord(record *Record) {
+	r.cacheFor(record.FakeIP.Is6()).Set(record.Domain, record)
+	r.ipCache.Set(record.FakeIP, record)
+}
+
+func (r *fakeIPResolver) makeNewFakeDnsRecord(host string, request *dns.Msg) (*Record, error) {
+	// allocate a fake ip for dns query host
+	fakeIP, err := r.allocate(host, request.Question[0].Qtype == dns.TypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+	if !fakeIP.IsValid() {
+		return nil, errors.New("unable to allocate fake ip from pool")
+	}
+	record := r.newRecord(host, fakeIP, request)
 	// save to cache
-	r.cache.Set(host, record)
-	r.ipCache.Set(fakeIP, record)
+	r.saveRecord(record)
+	if r.store != nil {
+		if err = r.store.Put(host, fakeIP); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+	}
 	logger.Logger.Trace("allocate fake ip", logx.String("ip", fakeIP.String()), logx.String("domain", host))
 	return record, nil
 }
@@ -142,8 +264,12 @@ func (r *fakeIPResolver) makeNewFakeDnsRecord(host string, request *dns.Msg) (*R
 // instead of directly to the TUN device, otherwise it will cause a loop
 func (r *fakeIPResolver) query(req *dns.Msg) (*dns.Msg, error) {
 	domain := dnsutil.TrimDomain(req.Question[0].Name)
+	ipv6 := req.Question[0].Qtype == dns.TypeAAAA
+	if ipv6 && r.pool6 == nil {
+		return nil, errors.New("fake ipv6 pool is not enabled")
+	}
 	// dns record exists in cache
-	if record, err := r.find(domain); err == nil {
+	if record, err := r.find(domain, ipv6); err == nil {
 		record.Reply.SetReply(req.Copy())
 		return record.Reply, nil
 	}
@@ -0,0 +1,228 @@
+package resolver
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+var (
+	// DefaultFakeIPStorePath the file path where the fake ip mappings are persisted, empty means disabled
+	DefaultFakeIPStorePath string
+	// DefaultFakeIPStoreCompactInterval the interval of rewriting the append-only log file
+	DefaultFakeIPStoreCompactInterval = 10 * time.Minute
+)
+
+const (
+	storeOpAdd = "A"
+	storeOpDel = "D"
+)
+
+type storeKey struct {
+	domain string
+	ipv6   bool
+}
+
+// fakeIPStore persists the domain to fake ip mappings in an append-only log file,
+// so that the same fake ip address is handed out for a domain across restarts.
+// Each line of the file is an operation:
+//
+//	A <domain> <ip>
+//	D <domain> <ip>
+type fakeIPStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	domains map[storeKey]netip.Addr
+	ips     map[netip.Addr]string
+	// the number of operations in the log file
+	ops    int
+	doneCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func openFakeIPStore(path string, compactInterval time.Duration) (*fakeIPStore, error) {
+	s := &fakeIPStore{
+		path:    path,
+		domains: make(map[storeKey]netip.Addr),
+		ips:     make(map[netip.Addr]string),
+		doneCh:  make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// drop the stale operations before appending new ones
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	if compactInterval > 0 {
+		s.wg.Add(1)
+		go s.compactLoop(compactInterval)
+	}
+	return s, nil
+}
+
+func (s *fakeIPStore) load() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			// the last line may be truncated if the process was killed while writing
+			continue
+		}
+		ip, err := netip.ParseAddr(fields[2])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case storeOpAdd:
+			s.set(fields[1], ip)
+		case storeOpDel:
+			s.unset(fields[1], ip.Is6())
+		default:
+			continue
+		}
+		s.ops++
+	}
+	return scanner.Err()
+}
+
+func (s *fakeIPStore) set(domain string, ip netip.Addr) {
+	key := storeKey{domain: domain, ipv6: ip.Is6()}
+	if old, ok := s.domains[key]; ok {
+		delete(s.ips, old)
+	}
+	if owner, ok := s.ips[ip]; ok {
+		delete(s.domains, storeKey{domain: owner, ipv6: ip.Is6()})
+	}
+	s.domains[key] = ip
+	s.ips[ip] = domain
+}
+
+func (s *fakeIPStore) unset(domain string, ipv6 bool) {
+	key := storeKey{domain: domain, ipv6: ipv6}
+	if ip, ok := s.domains[key]; ok {
+		delete(s.ips, ip)
+		delete(s.domains, key)
+	}
+}
+
+func (s *fakeIPStore) Lookup(domain string, ipv6 bool) (netip.Addr, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip, ok := s.domains[storeKey{domain: domain, ipv6: ipv6}]
+	return ip, ok
+}
+
+// Range calls fn for each persisted mapping
+func (s *fakeIPStore) Range(fn func(domain string, ip netip.Addr)) {
+	s.mu.Lock()
+	domains := make(map[storeKey]netip.Addr, len(s.domains))
+	for key, ip := range s.domains {
+		domains[key] = ip
+	}
+	s.mu.Unlock()
+	for key, ip := range domains {
+		fn(key.domain, ip)
+	}
+}
+
+// Put records that the fake ip is allocated for the domain,
+// the mapping of the previous domain owning the ip is dropped
+func (s *fakeIPStore) Put(domain string, ip netip.Addr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.domains[storeKey{domain: domain, ipv6: ip.Is6()}]; ok && old == ip {
+		return nil
+	}
+	var ops string
+	if owner, ok := s.ips[ip]; ok && owner != domain {
+		ops = fmt.Sprintf("%s %s %s\n", storeOpDel, owner, ip)
+		s.ops++
+	}
+	ops += fmt.Sprintf("%s %s %s\n", storeOpAdd, domain, ip)
+	s.ops++
+	s.set(domain, ip)
+	_, err := s.file.WriteString(ops)
+	return err
+}
+
+// compact rewrites the log file with the live mappings only
+func (s *fakeIPStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for key, ip := range s.domains {
+		fmt.Fprintf(w, "%s %s %s\n", storeOpAdd, key.domain, ip)
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	if s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	s.ops = len(s.domains)
+	return nil
+}
+
+func (s *fakeIPStore) compactLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.doneCh:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.ops > len(s.domains) {
+				if err := s.compact(); err != nil {
+					logger.Logger.ErrorBy(err)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *fakeIPStore) Close() error {
+	close(s.doneCh)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.compact()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	return err
+}
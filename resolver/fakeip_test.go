@@ -2,6 +2,8 @@ package resolver
 
 import (
 	"net/netip"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -44,3 +46,84 @@ func TestFakeIPResolverQueryTTL(t *testing.T) {
 	t.Log(newFakeIP)
 	assert.Equal(t, oldFakeIP, newFakeIP)
 }
+
+func TestFakeIPResolverStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fakeip.log")
+	prefix := netip.MustParsePrefix("198.18.0.1/24")
+
+	r, err := newFakeIPResolver(prefix)
+	assert.Nil(t, err)
+	assert.Nil(t, r.attachStore(path))
+	ip1 := doQuery(t, r, "www.example.com")
+	ip2 := doQuery(t, r, "www.example.org")
+	assert.Nil(t, r.close())
+
+	// the records are restored after restart
+	r, err = newFakeIPResolver(prefix)
+	assert.Nil(t, err)
+	assert.Nil(t, r.attachStore(path))
+	record, err := r.FindByIP(ip1)
+	assert.Nil(t, err)
+	assert.Equal(t, "www.example.com", record.Domain)
+	assert.Equal(t, ip2, doQuery(t, r, "www.example.org"))
+	assert.False(t, r.pool.IsAvailable(ip1))
+	assert.Nil(t, r.close())
+}
+
+func TestFakeIPStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fakeip.log")
+	store, err := openFakeIPStore(path, 0)
+	assert.Nil(t, err)
+	ip := netip.MustParseAddr("198.18.0.10")
+	assert.Nil(t, store.Put("a.example.com", ip))
+	// the ip is reassigned to another domain
+	assert.Nil(t, store.Put("b.example.com", ip))
+	assert.Equal(t, 3, store.ops)
+	assert.Nil(t, store.Close())
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "A b.example.com 198.18.0.10\n", string(data))
+
+	// a truncated line is ignored
+	assert.Nil(t, os.WriteFile(path, append(data, "A c.exam"...), 0644))
+	store, err = openFakeIPStore(path, 0)
+	assert.Nil(t, err)
+	_, ok := store.Lookup("a.example.com", false)
+	assert.False(t, ok)
+	got, ok := store.Lookup("b.example.com", false)
+	assert.True(t, ok)
+	assert.Equal(t, ip, got)
+	assert.Nil(t, store.Close())
+}
+
+func TestFakeIPResolverQueryAAAA(t *testing.T) {
+	r, err := newFakeIPResolver(netip.MustParsePrefix("198.18.0.1/24"))
+	assert.Nil(t, err)
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeAAAA)
+	_, err = r.query(req)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, r.enableIPv6(netip.MustParsePrefix("fdfe:dcba:9876::1/64")))
+	assert.Equal(t, netip.MustParsePrefix("fdfe:dcba:9876::1/64"), r.GetAllocatedTunPrefix6())
+
+	reply, err := r.query(req)
+	assert.Nil(t, err)
+	ip6 := dnsutil.MsgToAddrs(reply)[0]
+	assert.True(t, ip6.Is6())
+	assert.True(t, r.IsFakeIP(ip6))
+	assert.False(t, r.IsFakeIP(netip.MustParseAddr("fdfe:dcba:9877::1")))
+
+	record, err := r.FindByIP(ip6)
+	assert.Nil(t, err)
+	assert.Equal(t, "www.example.com", record.Domain)
+
+	// A and AAAA records are allocated independently
+	ip4 := doQuery(t, r, "www.example.com")
+	assert.True(t, ip4.Is4())
+	record, err = r.FindByIP(ip4)
+	assert.Nil(t, err)
+	assert.Equal(t, ip4, record.FakeIP)
+}
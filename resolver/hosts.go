@@ -0,0 +1,99 @@
+package resolver
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/josexy/mini-ss/util/trie"
+)
+
+// the max depth of following the aliases in static hosts
+const maxHostsAliasDepth = 8
+
+var errInvalidHostsEntry = errors.New("invalid hosts entry")
+
+// DefaultHosts the static hosts overrides, which take precedence over the nameservers and the hosts file
+var DefaultHosts = NewHosts()
+
+type hostsEntry struct {
+	ips   []netip.Addr
+	alias string
+}
+
+// Hosts static hosts, a host can be an exact or wildcard domain (e.g. *.svc.local, +.corp),
+// and it maps to one or more ip addresses, or to another domain as an alias (CNAME)
+type Hosts struct {
+	mu   sync.RWMutex
+	trie *trie.DomainTrie
+	size int
+}
+
+func NewHosts() *Hosts {
+	return &Hosts{trie: trie.New()}
+}
+
+// Add adds a host entry, the values must be either ip addresses or a single alias domain
+func (h *Hosts) Add(host string, values []string) error {
+	host = strings.TrimSpace(host)
+	if host == "" || len(values) == 0 {
+		return errInvalidHostsEntry
+	}
+	entry := &hostsEntry{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if ip, err := netip.ParseAddr(value); err == nil {
+			entry.ips = append(entry.ips, ip.Unmap())
+			continue
+		}
+		if value == "" || entry.alias != "" {
+			return errInvalidHostsEntry
+		}
+		entry.alias = strings.TrimSuffix(value, ".")
+	}
+	if entry.alias != "" && len(entry.ips) > 0 {
+		return errInvalidHostsEntry
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.trie.Insert(host, entry); err != nil {
+		return err
+	}
+	h.size++
+	return nil
+}
+
+func (h *Hosts) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.size
+}
+
+// Lookup returns the ip addresses of the host, and the aliases followed in order.
+// If the last alias is not found in the static hosts, no ip addresses are returned,
+// and the last alias should be resolved by the nameservers.
+func (h *Hosts) Lookup(host string) (ips []netip.Addr, aliases []string, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.size == 0 {
+		return
+	}
+	for i := 0; i < maxHostsAliasDepth; i++ {
+		node := h.trie.Search(host)
+		if node == nil {
+			return
+		}
+		ok = true
+		entry := node.Data.(*hostsEntry)
+		if entry.alias == "" {
+			ips = entry.ips
+			return
+		}
+		host = entry.alias
+		aliases = append(aliases, host)
+	}
+	// too many aliases, maybe a loop
+	return nil, nil, false
+}
@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/josexy/mini-ss/util/dnsutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHosts(t *testing.T) {
+	h := NewHosts()
+	assert.Nil(t, h.Add("gitlab.corp.internal", []string{"10.0.0.10"}))
+	assert.Nil(t, h.Add("+.staging.internal", []string{"10.0.1.10", "fd00::10"}))
+	assert.Nil(t, h.Add("registry.corp.internal", []string{"gitlab.corp.internal"}))
+	assert.Nil(t, h.Add("docs.corp.internal", []string{"docs.example.com."}))
+	assert.Nil(t, h.Add("loop1.internal", []string{"loop2.internal"}))
+	assert.Nil(t, h.Add("loop2.internal", []string{"loop1.internal"}))
+
+	assert.NotNil(t, h.Add("", []string{"10.0.0.1"}))
+	assert.NotNil(t, h.Add("bad.internal", nil))
+	assert.NotNil(t, h.Add("bad.internal", []string{"10.0.0.1", "example.com"}))
+	assert.NotNil(t, h.Add("bad.internal", []string{"a.example.com", "b.example.com"}))
+
+	ips, aliases, ok := h.Lookup("gitlab.corp.internal")
+	assert.True(t, ok)
+	assert.Nil(t, aliases)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.10")}, ips)
+
+	ips, _, ok = h.Lookup("api.staging.internal")
+	assert.True(t, ok)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.1.10"), netip.MustParseAddr("fd00::10")}, ips)
+	_, _, ok = h.Lookup("staging.internal")
+	assert.True(t, ok)
+
+	ips, aliases, ok = h.Lookup("registry.corp.internal")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"gitlab.corp.internal"}, aliases)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.10")}, ips)
+
+	ips, aliases, ok = h.Lookup("docs.corp.internal")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"docs.example.com"}, aliases)
+	assert.Nil(t, ips)
+
+	_, _, ok = h.Lookup("loop1.internal")
+	assert.False(t, ok)
+	_, _, ok = h.Lookup("www.example.com")
+	assert.False(t, ok)
+}
+
+func TestResolverStaticHosts(t *testing.T) {
+	old := DefaultHosts
+	defer func() { DefaultHosts = old }()
+	DefaultHosts = NewHosts()
+	assert.Nil(t, DefaultHosts.Add("*.svc.internal", []string{"10.0.2.1", "10.0.2.2", "fd00::2"}))
+	assert.Nil(t, DefaultHosts.Add("api.internal", []string{"web.svc.internal"}))
+
+	r := &Resolver{clients: make(map[string]*DnsClient)}
+	ips, err := r.LookupIP(context.Background(), "api.internal")
+	assert.Nil(t, err)
+	assert.Len(t, ips, 3)
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("api.internal"), dns.TypeA)
+	reply, err := r.Query(req)
+	assert.Nil(t, err)
+	assert.Len(t, reply.Answer, 3)
+	assert.Equal(t, "web.svc.internal.", reply.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.2.1"), netip.MustParseAddr("10.0.2.2")}, dnsutil.MsgToAddrs(reply))
+
+	req.SetQuestion(dns.Fqdn("db.svc.internal"), dns.TypeAAAA)
+	reply, err = r.Query(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("fd00::2")}, dnsutil.MsgToAddrs(reply))
+
+}
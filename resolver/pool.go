@@ -1,16 +1,21 @@
 package resolver
 
 import (
+	"encoding/binary"
 	"errors"
 	"hash/adler32"
 	"net/netip"
 )
 
+// maxIPv6PoolSize limits the number of the allocatable ipv6 addresses,
+// since an ipv6 prefix such as /64 contains far more addresses than needed
+const maxIPv6PoolSize = 1 << 16
+
 var errNoAvailableFakeIP = errors.New("no available fake ip")
 
 type ipPool struct {
-	hmin  uint32
-	hmax  uint32
+	first netip.Addr
+	last  netip.Addr
 	bits  int
 	flags []bool
 }
@@ -19,35 +24,42 @@ func newIPPool(prefix netip.Prefix) (*ipPool, error) {
 	if !prefix.IsValid() {
 		return nil, errNoAvailableFakeIP
 	}
-	var hmin, hmax uint32
-	var base uint32 = ipToInt(prefix.Masked().Addr())
-	var mask uint32 = (0xFFFFFFFF << (32 - prefix.Bits())) & 0xFFFFFFFF
-	if mask == 0xFFFFFFFF {
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits <= 0 {
 		return nil, errNoAvailableFakeIP
 	}
 
-	last := base | (^mask & 0xFFFFFFFF)
-	if mask == 0xFFFFFFFE {
-		hmin = base
-		hmax = last
+	var first netip.Addr
+	var hostn uint64
+	if hostBits == 1 {
+		first = prefix.Addr()
+		hostn = 2
 	} else {
-		hmin = base + 1
-		hmax = last - 1
+		// exclude the network address and the last (broadcast) address
+		first = prefix.Addr().Next()
+		if hostBits >= 63 {
+			hostn = 1<<63 - 2
+		} else {
+			hostn = 1<<hostBits - 2
+		}
+	}
+	if prefix.Addr().Is6() && hostn > maxIPv6PoolSize {
+		hostn = maxIPv6PoolSize
 	}
-	hostn := hmax - hmin + 1
 	return &ipPool{
-		hmin:  hmin,
-		hmax:  hmax,
-		bits:  prefix.Masked().Bits(),
+		first: first,
+		last:  addIP(first, hostn-1),
+		bits:  prefix.Bits(),
 		flags: make([]bool, hostn),
 	}, nil
 }
 
 func (pool *ipPool) Capacity() int { return cap(pool.flags) }
 
-func (pool *ipPool) IPMin() netip.Addr { return intToIP(pool.hmin) }
+func (pool *ipPool) IPMin() netip.Addr { return pool.first }
 
-func (pool *ipPool) IPMax() netip.Addr { return intToIP(pool.hmax) }
+func (pool *ipPool) IPMax() netip.Addr { return pool.last }
 
 func (pool *ipPool) Bits() int { return pool.bits }
 
@@ -62,11 +74,14 @@ func (pool *ipPool) Available() int {
 }
 
 func (pool *ipPool) index(ip netip.Addr) int {
-	value := ipToInt(ip)
-	if value >= pool.hmin && value <= pool.hmax {
-		return int(value - pool.hmin)
+	if ip.Is4() != pool.first.Is4() || ip.Less(pool.first) || pool.last.Less(ip) {
+		return -1
 	}
-	return -1
+	return int(subIP(ip, pool.first))
+}
+
+func (pool *ipPool) ipAt(index int) netip.Addr {
+	return addIP(pool.first, uint64(index))
 }
 
 func (pool *ipPool) Contains(ip netip.Addr) bool {
@@ -97,7 +112,7 @@ func (pool *ipPool) allocateFor(ip netip.Addr) (netip.Addr, bool) {
 		return netip.Addr{}, false
 	}
 	pool.flags[index] = true
-	return intToIP(pool.hmin + uint32(index)), true
+	return pool.ipAt(index), true
 }
 
 func (pool *ipPool) Release(ip netip.Addr) bool {
@@ -124,15 +139,39 @@ func (pool *ipPool) Allocate(host string) (ip netip.Addr, err error) {
 		return
 	}
 	pool.flags[index] = true
-	ip = intToIP(pool.hmin + index)
+	ip = pool.ipAt(int(index))
 	return
 }
 
-func intToIP(v uint32) netip.Addr {
-	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+func ipToUint128(ip netip.Addr) (hi, lo uint64) {
+	b := ip.As16()
+	return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+}
+
+func uint128ToIP(hi, lo uint64, is4 bool) netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	ip := netip.AddrFrom16(b)
+	if is4 {
+		return ip.Unmap()
+	}
+	return ip
+}
+
+// addIP returns ip+n
+func addIP(ip netip.Addr, n uint64) netip.Addr {
+	hi, lo := ipToUint128(ip)
+	sum := lo + n
+	if sum < lo {
+		hi++
+	}
+	return uint128ToIP(hi, sum, ip.Is4())
 }
 
-func ipToInt(ip netip.Addr) uint32 {
-	v := ip.As4()
-	return (uint32(v[0]) << 24) | (uint32(v[1]) << 16) | (uint32(v[2]) << 8) | uint32(v[3])
+// subIP returns a-b, the result is truncated to 64 bits
+func subIP(a, b netip.Addr) uint64 {
+	_, alo := ipToUint128(a)
+	_, blo := ipToUint128(b)
+	return alo - blo
 }
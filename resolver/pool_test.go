@@ -32,8 +32,8 @@ func TestIPPool_AllocateAndRelease(t *testing.T) {
 		assert.False(t, pool.Contains(pool.IPMin().Prev()))
 		assert.False(t, pool.Contains(pool.IPMax().Next()))
 
-		for min := pool.hmin; min <= pool.hmax; min++ {
-			ip := intToIP(min)
+		for i := 0; i < pool.Capacity(); i++ {
+			ip := pool.ipAt(i)
 			assert.True(t, pool.Contains(ip))
 		}
 
@@ -82,9 +82,26 @@ func TestIPPool_AllocateAndRelease(t *testing.T) {
 		"10.2.99.14/22",
 		"10.2.88.25/18",
 		"254.244.240.25/16",
+		"fdfe:dcba:9876::2/127",
+		"fdfe:dcba:9876::1/120",
 	}
 	for _, cidr := range cidrs {
 		testFn(cidr)
 		testFn2(cidr)
 	}
 }
+
+func TestIPPool_IPv6(t *testing.T) {
+	pool, err := newIPPool(netip.MustParsePrefix("fdfe:dcba:9876::1/64"))
+	assert.Nil(t, err)
+	assert.Equal(t, maxIPv6PoolSize, pool.Capacity())
+	assert.Equal(t, netip.MustParseAddr("fdfe:dcba:9876::1"), pool.IPMin())
+	assert.Equal(t, netip.MustParseAddr("fdfe:dcba:9876::1:0"), pool.IPMax())
+	assert.False(t, pool.Contains(netip.MustParseAddr("198.18.0.1")))
+	assert.False(t, pool.Contains(netip.MustParseAddr("fdfe:dcba:9877::1")))
+
+	pool4, err := newIPPool(netip.MustParsePrefix("198.18.0.1/16"))
+	assert.Nil(t, err)
+	assert.False(t, pool4.Contains(netip.MustParseAddr("::ffff:198.18.0.1")))
+	assert.False(t, pool4.Contains(pool.IPMin()))
+}
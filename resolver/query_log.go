@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/josexy/mini-ss/statistic"
+	"github.com/josexy/mini-ss/util/dnsutil"
+	"github.com/miekg/dns"
+)
+
+const (
+	querySourceDns    = "dns"
+	querySourceLookup = "lookup"
+
+	upstreamStaticHosts = "static-hosts"
+	upstreamHostsFile   = "hosts-file"
+	upstreamFakeIP      = "fake-ip"
+)
+
+// recordQuery records the dns query into the statistic query log
+func recordQuery(source string, req, reply *dns.Msg, upstream string, start time.Time, err error) {
+	if !statistic.EnableStatistic || len(req.Question) == 0 {
+		return
+	}
+	query := &statistic.DnsQuery{
+		Time:     start,
+		Source:   source,
+		Name:     dnsutil.TrimDomain(req.Question[0].Name),
+		Qtype:    dns.TypeToString[req.Question[0].Qtype],
+		Upstream: upstream,
+		Latency:  time.Since(start),
+	}
+	if err != nil {
+		query.Error = err.Error()
+	}
+	if reply != nil {
+		query.Rcode = dns.RcodeToString[reply.Rcode]
+		query.FakeIP = upstream == upstreamFakeIP
+		for _, ip := range dnsutil.MsgToAddrs(reply) {
+			query.Answers = append(query.Answers, ip.String())
+		}
+	}
+	statistic.DefaultDnsManager.Add(query)
+}
+
+// recordLookup records the lookup which is answered locally without a dns message
+func recordLookup(host string, ips []netip.Addr, upstream string, start time.Time) {
+	if !statistic.EnableStatistic || len(ips) == 0 {
+		return
+	}
+	query := &statistic.DnsQuery{
+		Time:     start,
+		Source:   querySourceLookup,
+		Name:     host,
+		Qtype:    dns.TypeToString[qtypeFor(ips[0].Is6())],
+		Upstream: upstream,
+		Latency:  time.Since(start),
+		Rcode:    dns.RcodeToString[dns.RcodeSuccess],
+	}
+	for _, ip := range ips {
+		query.Answers = append(query.Answers, ip.String())
+	}
+	statistic.DefaultDnsManager.Add(query)
+}
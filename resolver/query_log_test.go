@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/statistic"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func enableQueryLog(t *testing.T) {
+	statistic.EnableStatistic = true
+	statistic.DefaultDnsManager.Reset()
+	t.Cleanup(func() {
+		statistic.EnableStatistic = false
+		statistic.DefaultDnsManager.Reset()
+	})
+}
+
+func TestQueryLog(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("www.example.com"), dns.TypeA)
+	reply := new(dns.Msg)
+	reply.SetReply(req)
+	reply.Answer = append(reply.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   netip.MustParseAddr("93.184.216.34").AsSlice(),
+	})
+
+	// nothing is recorded while the statistic is disabled
+	statistic.DefaultDnsManager.Reset()
+	recordQuery(querySourceDns, req, reply, "8.8.8.8:53", time.Now(), nil)
+	recordLookup("www.example.com", []netip.Addr{netip.MustParseAddr("10.0.0.1")}, upstreamStaticHosts, time.Now())
+	assert.Zero(t, statistic.DefaultDnsManager.DumpSnapshot().Total)
+
+	enableQueryLog(t)
+	// the empty question and lookup are skipped
+	recordQuery(querySourceDns, new(dns.Msg), nil, "8.8.8.8:53", time.Now(), nil)
+	recordLookup("www.example.com", nil, upstreamStaticHosts, time.Now())
+	assert.Zero(t, statistic.DefaultDnsManager.DumpSnapshot().Total)
+
+	start := time.Now()
+	recordQuery(querySourceDns, req, reply, "8.8.8.8:53", start, nil)
+	recordQuery(querySourceLookup, req, nil, "8.8.8.8:53", start, errors.New("i/o timeout"))
+	recordQuery(querySourceDns, req, reply, upstreamFakeIP, start, nil)
+	recordLookup("db.internal", []netip.Addr{netip.MustParseAddr("fd00::1"), netip.MustParseAddr("fd00::2")}, upstreamHostsFile, start)
+
+	snapshot := statistic.DefaultDnsManager.DumpSnapshot()
+	assert.EqualValues(t, 4, snapshot.Total)
+	assert.EqualValues(t, 1, snapshot.Failed)
+	assert.EqualValues(t, 1, snapshot.FakeIP)
+	assert.Len(t, snapshot.Queries, 4)
+
+	q := snapshot.Queries[0]
+	assert.Equal(t, start, q.Time)
+	assert.Equal(t, querySourceDns, q.Source)
+	assert.Equal(t, "www.example.com", q.Name)
+	assert.Equal(t, "A", q.Qtype)
+	assert.Equal(t, "8.8.8.8:53", q.Upstream)
+	assert.Equal(t, "NOERROR", q.Rcode)
+	assert.False(t, q.FakeIP)
+	assert.Equal(t, []string{"93.184.216.34"}, q.Answers)
+	assert.Empty(t, q.Error)
+
+	q = snapshot.Queries[1]
+	assert.Equal(t, querySourceLookup, q.Source)
+	assert.Equal(t, "i/o timeout", q.Error)
+	assert.Empty(t, q.Rcode)
+	assert.Nil(t, q.Answers)
+
+	assert.True(t, snapshot.Queries[2].FakeIP)
+
+	q = snapshot.Queries[3]
+	assert.Equal(t, querySourceLookup, q.Source)
+	assert.Equal(t, "db.internal", q.Name)
+	assert.Equal(t, "AAAA", q.Qtype)
+	assert.Equal(t, upstreamHostsFile, q.Upstream)
+	assert.Equal(t, "NOERROR", q.Rcode)
+	assert.Equal(t, []string{"fd00::1", "fd00::2"}, q.Answers)
+}
+
+func TestQueryLogStaticHosts(t *testing.T) {
+	old := DefaultHosts
+	defer func() { DefaultHosts = old }()
+	DefaultHosts = NewHosts()
+	assert.Nil(t, DefaultHosts.Add("*.svc.internal", []string{"10.0.2.1", "fd00::2"}))
+
+	enableQueryLog(t)
+	r := &Resolver{clients: make(map[string]*DnsClient)}
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn("db.svc.internal"), dns.TypeAAAA)
+	_, err := r.Query(req)
+	assert.Nil(t, err)
+	_, err = r.LookupIP(context.Background(), "web.svc.internal")
+	assert.Nil(t, err)
+
+	queries := statistic.DefaultDnsManager.DumpSnapshot().Queries
+	assert.Len(t, queries, 2)
+	assert.Equal(t, querySourceDns, queries[0].Source)
+	assert.Equal(t, "db.svc.internal", queries[0].Name)
+	assert.Equal(t, "AAAA", queries[0].Qtype)
+	assert.Equal(t, upstreamStaticHosts, queries[0].Upstream)
+	assert.Equal(t, []string{"fd00::2"}, queries[0].Answers)
+
+	assert.Equal(t, querySourceLookup, queries[1].Source)
+	assert.Equal(t, "web.svc.internal", queries[1].Name)
+	assert.Equal(t, upstreamStaticHosts, queries[1].Upstream)
+	assert.Equal(t, []string{"10.0.2.1", "fd00::2"}, queries[1].Answers)
+}
@@ -29,14 +29,19 @@ var (
 
 var DefaultResolver *Resolver
 
+// ResolutionDelay the time to wait for the AAAA records once the A records are answered first, and vice versa
+var ResolutionDelay = 50 * time.Millisecond
+
 type nameserverExt struct {
 	addr   string
 	dnsNet string
+	// edns client subnet, e.g. udp://8.8.8.8?ecs=1.2.3.0/24
+	ecs netip.Prefix
 }
 
 type Resolver struct {
 	*fakeIPResolver
-	// UDP/TCP/DoT/DoH
+	// UDP/TCP/DoT/DoH/DoQ/DoH3
 	nameservers    []nameserverExt
 	clients        map[string]*DnsClient
 	lookupGroup    singleflight.Group
@@ -97,6 +102,16 @@ func parseNameserver(nameservers []string) []nameserverExt {
 				urlInfo := url.URL{Scheme: "https", Host: addr, Path: urlres.Path, User: urlres.User}
 				addr = urlInfo.String()
 			}
+		case "quic":
+			dnsNet = "quic"
+			addr, err = formatNameserver(urlres.Host, "853") // DNS over QUIC
+		case "h3":
+			dnsNet = "h3"
+			addr, err = formatNameserver(urlres.Host, "443") // DNS over HTTPS (HTTP/3)
+			if err == nil {
+				urlInfo := url.URL{Scheme: "https", Host: addr, Path: urlres.Path, User: urlres.User}
+				addr = urlInfo.String()
+			}
 		default:
 			logger.Logger.Errorf("unsupported dns scheme: %s", urlres.Scheme)
 			continue
@@ -105,9 +120,17 @@ func parseNameserver(nameservers []string) []nameserverExt {
 			logger.Logger.ErrorBy(err)
 			continue
 		}
+		var ecs netip.Prefix
+		if value := urlres.Query().Get("ecs"); value != "" {
+			if ecs, err = parseClientSubnet(value); err != nil {
+				logger.Logger.ErrorBy(err)
+				continue
+			}
+		}
 		list = append(list, nameserverExt{
 			addr:   addr,
 			dnsNet: dnsNet,
+			ecs:    ecs,
 		})
 	}
 	return list
@@ -129,7 +152,9 @@ func NewDnsResolver(nameservers []string, lookupHostsFile bool) *Resolver {
 
 	for _, ns := range resolver.nameservers {
 		logger.Logger.Infof("dns nameserver: type: %s, addr: %s", ns.dnsNet, ns.addr)
-		resolver.clients[ns.dnsNet+":"+ns.addr] = NewDnsClient(ns.dnsNet, ns.addr, time.Second*5)
+		client := NewDnsClient(ns.dnsNet, ns.addr, time.Second*5)
+		client.ecs = ns.ecs
+		resolver.clients[ns.dnsNet+":"+ns.addr] = client
 	}
 	return resolver
 }
@@ -138,11 +163,30 @@ func (r *Resolver) IsEnhancerMode() bool {
 	return r.fakeIPResolver != nil
 }
 
-func (r *Resolver) EnableEnhancerMode(tunCIDR netip.Prefix) (err error) {
-	r.fakeIPResolver, err = newFakeIPResolver(tunCIDR)
+// EnableEnhancerMode allocates fake ip addresses from the tun prefix,
+// and fake ipv6 addresses from tunCIDR6 if it is valid
+func (r *Resolver) EnableEnhancerMode(tunCIDR, tunCIDR6 netip.Prefix) (err error) {
+	if r.fakeIPResolver, err = newFakeIPResolver(tunCIDR); err != nil {
+		return
+	}
+	if tunCIDR6.IsValid() {
+		if err = r.fakeIPResolver.enableIPv6(tunCIDR6); err != nil {
+			return
+		}
+	}
+	if DefaultFakeIPStorePath != "" {
+		err = r.fakeIPResolver.attachStore(DefaultFakeIPStorePath)
+	}
 	return
 }
 
+func (r *Resolver) CloseEnhancerMode() error {
+	if r.fakeIPResolver == nil {
+		return nil
+	}
+	return r.fakeIPResolver.close()
+}
+
 func (r *Resolver) LookupHost(ctx context.Context, host string) netip.Addr {
 	if host == "" {
 		return netip.Addr{}
@@ -159,11 +203,9 @@ func (r *Resolver) LookupHost(ctx context.Context, host string) netip.Addr {
 }
 
 func (r *Resolver) LookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
-	if r.lookupHostPref {
-		ip := hostsutil.LookupIP(host)
-		if ip.IsValid() {
-			return []netip.Addr{ip}, nil
-		}
+	ips, host, ok := r.lookupStatic(host)
+	if ok {
+		return ips, nil
 	}
 	ipsCh := make(chan []netip.Addr, 1)
 	// lookup ipv6 address
@@ -180,13 +222,104 @@ func (r *Resolver) LookupIP(ctx context.Context, host string) ([]netip.Addr, err
 	if err == nil && len(ips) > 0 {
 		return ips, nil
 	}
-	ips, ok := <-ipsCh
+	ips, ok = <-ipsCh
 	if !ok {
 		return nil, errCannotLookupIPv4v6
 	}
 	return ips, nil
 }
 
+// LookupIPv4v6 resolves the ipv4 and ipv6 addresses of the host concurrently.
+// Once one of the families is answered, it waits at most ResolutionDelay for the other one (RFC 8305).
+func (r *Resolver) LookupIPv4v6(ctx context.Context, host string) (ipv4, ipv6 []netip.Addr, err error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips := []netip.Addr{ip.Unmap()}
+		if ip.Unmap().Is4() {
+			return ips, nil, nil
+		}
+		return nil, ips, nil
+	}
+	ips, host, ok := r.lookupStatic(host)
+	if ok {
+		ipv4, ipv6 = splitAddrs(ips)
+		return
+	}
+	ipv4, ipv6 = r.lookupIPv4v6(ctx, host)
+	if len(ipv4) == 0 && len(ipv6) == 0 {
+		err = errCannotLookupIPv4v6
+	}
+	return
+}
+
+func (r *Resolver) lookupIPv4v6(ctx context.Context, host string) (ipv4, ipv6 []netip.Addr) {
+	type result struct {
+		ips  []netip.Addr
+		ipv6 bool
+	}
+	results := make(chan result, 2)
+	lookup := func(dnsType uint16) {
+		ips, _ := r.lookupIP(ctx, host, dnsType)
+		results <- result{ips: ips, ipv6: dnsType == dns.TypeAAAA}
+	}
+	go lookup(dns.TypeA)
+	go lookup(dns.TypeAAAA)
+
+	var delay <-chan time.Time
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-results:
+			if res.ipv6 {
+				ipv6 = res.ips
+			} else {
+				ipv4 = res.ips
+			}
+			if len(res.ips) > 0 && delay == nil {
+				timer := time.NewTimer(ResolutionDelay)
+				defer timer.Stop()
+				delay = timer.C
+			}
+		case <-delay:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+	return
+}
+
+// lookupStatic looks up the static hosts and the local hosts file,
+// the returned host is the last alias which should be resolved by the nameservers if not found
+func (r *Resolver) lookupStatic(host string) ([]netip.Addr, string, bool) {
+	start := time.Now()
+	if ips, aliases, ok := DefaultHosts.Lookup(host); ok {
+		if len(ips) > 0 {
+			recordLookup(host, ips, upstreamStaticHosts, start)
+			return ips, host, true
+		}
+		// resolve the last alias by the nameservers
+		host = aliases[len(aliases)-1]
+	}
+	if r.lookupHostPref {
+		ip := hostsutil.LookupIP(host)
+		if ip.IsValid() {
+			recordLookup(host, []netip.Addr{ip}, upstreamHostsFile, start)
+			return []netip.Addr{ip}, host, true
+		}
+	}
+	return nil, host, false
+}
+
+func splitAddrs(ips []netip.Addr) (ipv4, ipv6 []netip.Addr) {
+	for _, ip := range ips {
+		if ip = ip.Unmap(); ip.Is4() {
+			ipv4 = append(ipv4, ip)
+		} else {
+			ipv6 = append(ipv6, ip)
+		}
+	}
+	return
+}
+
 func (r *Resolver) ResolveTCPAddr(ctx context.Context, addr string) (*net.TCPAddr, error) {
 	host, p, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -224,7 +357,9 @@ func (r *Resolver) lookupIP(ctx context.Context, host string, dnsType uint16) ([
 	req.SetQuestion(dns.Fqdn(host), dnsType)
 	req.RecursionDesired = true
 
-	reply, err := r.lookupIPWithMsg(ctx, req)
+	start := time.Now()
+	reply, upstream, err := r.lookupIPWithMsg(ctx, req)
+	recordQuery(querySourceLookup, req, reply, upstream, start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -238,7 +373,14 @@ func (r *Resolver) lookupIP(ctx context.Context, host string, dnsType uint16) ([
 	return addrs, nil
 }
 
-func (r *Resolver) lookupIPWithMsg(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+// exchangeResult the reply and the nameserver which answered
+type exchangeResult struct {
+	reply    *dns.Msg
+	upstream string
+}
+
+// lookupIPWithMsg returns the reply and the nameserver which answered
+func (r *Resolver) lookupIPWithMsg(ctx context.Context, req *dns.Msg) (*dns.Msg, string, error) {
 	lookupCtx, lookupCancel := context.WithCancel(ctx)
 
 	ch := r.lookupGroup.DoChan(req.Question[0].String(), func() (interface{}, error) {
@@ -248,32 +390,33 @@ func (r *Resolver) lookupIPWithMsg(ctx context.Context, req *dns.Msg) (*dns.Msg,
 	select {
 	case <-ctx.Done():
 		lookupCancel()
-		return nil, ctx.Err()
+		return nil, "", ctx.Err()
 	case r := <-ch:
 		lookupCancel()
 		if r.Err != nil {
-			return nil, r.Err
+			return nil, "", r.Err
 		}
-		if reply, ok := r.Val.(*dns.Msg); ok {
+		if result, ok := r.Val.(*exchangeResult); ok {
+			reply := result.reply
 			if r.Shared {
 				reply = reply.Copy()
 			}
-			return reply, nil
+			return reply, result.upstream, nil
 		} else {
-			return nil, errors.New("invalid dns lookup msg")
+			return nil, "", errors.New("invalid dns lookup msg")
 		}
 	}
 }
 
-func (r *Resolver) exchangeContext(ctx context.Context, req *dns.Msg) (msg *dns.Msg, err error) {
-	msg, err = r.exchangeContextWithoutCache(ctx, req)
+func (r *Resolver) exchangeContext(ctx context.Context, req *dns.Msg) (result *exchangeResult, err error) {
+	result, err = r.exchangeContextWithoutCache(ctx, req)
 	return
 }
 
-func (r *Resolver) exchangeContextWithoutCache(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+func (r *Resolver) exchangeContextWithoutCache(ctx context.Context, req *dns.Msg) (*exchangeResult, error) {
 	// request the dns server one after another.
 	// once a dns returns a reply, it returns immediately.
-	replyCh := make(chan *dns.Msg, 1)
+	replyCh := make(chan *exchangeResult, 1)
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 	wg := sync.WaitGroup{}
@@ -288,7 +431,7 @@ func (r *Resolver) exchangeContextWithoutCache(ctx context.Context, req *dns.Msg
 			return
 		}
 		select {
-		case replyCh <- reply:
+		case replyCh <- &exchangeResult{reply: reply, upstream: key}:
 		default:
 		}
 	}
@@ -324,49 +467,115 @@ func (r *Resolver) lookupHostsFile(req *dns.Msg) (*dns.Msg, error) {
 	reply := new(dns.Msg)
 	reply.SetReply(req)
 	reply.RecursionAvailable = true
+	reply.Answer = append(reply.Answer, newAddrRR(host, ip))
+	return reply, nil
+}
 
-	var rr dns.RR
-	if ip.Is4() {
-		rr = &dns.A{
+// lookupStaticHosts answers the A/AAAA query from the static hosts,
+// ok is false if the host is not found in the static hosts
+func (r *Resolver) lookupStaticHosts(req *dns.Msg) (reply *dns.Msg, ok bool, err error) {
+	question := req.Question[0]
+	if question.Qclass != dns.ClassINET || (question.Qtype != dns.TypeA && question.Qtype != dns.TypeAAAA) {
+		return
+	}
+	host := dnsutil.TrimDomain(question.Name)
+	ips, aliases, ok := DefaultHosts.Lookup(host)
+	if !ok {
+		return
+	}
+	reply = new(dns.Msg)
+	reply.SetReply(req)
+	reply.RecursionAvailable = true
+	name := host
+	for _, alias := range aliases {
+		reply.Answer = append(reply.Answer, &dns.CNAME{
 			Hdr: dns.RR_Header{
-				Name:   dns.Fqdn(host),
-				Rrtype: dns.TypeA,
+				Name:   dns.Fqdn(name),
+				Rrtype: dns.TypeCNAME,
 				Class:  dns.ClassINET,
 				Ttl:    6,
 			},
-			A: ip.AsSlice(),
+			Target: dns.Fqdn(alias),
+		})
+		name = alias
+	}
+	if len(ips) == 0 {
+		// the last alias is resolved by the nameservers
+		aliasReq := &dns.Msg{}
+		aliasReq.SetQuestion(dns.Fqdn(name), question.Qtype)
+		aliasReq.RecursionDesired = true
+		var aliasReply *dns.Msg
+		if aliasReply, _, err = r.lookupIPWithMsg(context.Background(), aliasReq); err != nil {
+			return
 		}
-	} else {
-		rr = &dns.AAAA{
+		reply.Answer = append(reply.Answer, aliasReply.Answer...)
+		return
+	}
+	for _, ip := range ips {
+		if ip.Is4() == (question.Qtype == dns.TypeA) {
+			reply.Answer = append(reply.Answer, newAddrRR(name, ip))
+		}
+	}
+	return
+}
+
+func newAddrRR(host string, ip netip.Addr) dns.RR {
+	if ip.Is4() {
+		return &dns.A{
 			Hdr: dns.RR_Header{
 				Name:   dns.Fqdn(host),
-				Rrtype: dns.TypeAAAA,
+				Rrtype: dns.TypeA,
 				Class:  dns.ClassINET,
 				Ttl:    6,
 			},
-			AAAA: ip.AsSlice(),
+			A: ip.AsSlice(),
 		}
 	}
-	reply.Answer = append(reply.Answer, rr)
-	return reply, nil
+	return &dns.AAAA{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(host),
+			Rrtype: dns.TypeAAAA,
+			Class:  dns.ClassINET,
+			Ttl:    6,
+		},
+		AAAA: ip.AsSlice(),
+	}
 }
 
 func (r *Resolver) Query(req *dns.Msg) (reply *dns.Msg, err error) {
+	start := time.Now()
+	var upstream string
+	defer func() {
+		// the client subnet is only a hint for the nameservers, don't leak it to the local clients
+		if err == nil && reply != nil {
+			stripClientSubnet(reply)
+		}
+		recordQuery(querySourceDns, req, reply, upstream, start, err)
+	}()
+	var ok bool
+	if reply, ok, err = r.lookupStaticHosts(req); ok {
+		upstream = upstreamStaticHosts
+		return
+	}
 	reply, err = r.lookupHostsFile(req)
 	if err == nil {
+		upstream = upstreamHostsFile
 		return
 	}
 
-	if req.Question[0].Qclass == dns.ClassINET && req.Question[0].Qtype == dns.TypeA {
+	question := req.Question[0]
+	if question.Qclass == dns.ClassINET &&
+		(question.Qtype == dns.TypeA || (question.Qtype == dns.TypeAAAA && r.fakeIPResolver.IsIPv6Enabled())) {
 		if r.matchDomainFilter(req) {
 			logger.Logger.Debugf("domain filter matched for %s", req.Question[0].Name)
-			reply, err = r.lookupIPWithMsg(context.Background(), req)
+			reply, upstream, err = r.lookupIPWithMsg(context.Background(), req)
 			return
 		}
-		// ipv4 dns query, return fake ip address
+		// ipv4 or ipv6 dns query, return fake ip address
 		reply, err = r.fakeIPResolver.query(req)
+		upstream = upstreamFakeIP
 	} else {
-		// return an empty response for ipv6
+		// return an empty response for ipv6 if the fake ipv6 pool is disabled
 		reply, err = &dns.Msg{}, nil
 		reply.SetReply(req)
 	}
@@ -374,15 +583,5 @@ func (r *Resolver) Query(req *dns.Msg) (reply *dns.Msg, err error) {
 }
 
 func (r *Resolver) matchDomainFilter(req *dns.Msg) bool {
-	if len(DefaultDomainFilter) == 0 {
-		return false
-	}
-	domain := dnsutil.TrimDomain(req.Question[0].Name)
-	// TODO: support wildcard domain match?
-	for _, name := range DefaultDomainFilter {
-		if domain == name {
-			return true
-		}
-	}
-	return false
+	return DefaultDomainFilter.Match(dnsutil.TrimDomain(req.Question[0].Name))
 }
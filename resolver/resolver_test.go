@@ -3,11 +3,13 @@ package resolver
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/josexy/logx"
 	"github.com/josexy/mini-ss/util/logger"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDnsResolver(t *testing.T) {
@@ -40,3 +42,25 @@ func TestDnsResolver(t *testing.T) {
 	}
 	time.Sleep(time.Second * 5)
 }
+
+func TestLookupIPv4v6(t *testing.T) {
+	old := DefaultHosts
+	defer func() { DefaultHosts = old }()
+	DefaultHosts = NewHosts()
+	assert.Nil(t, DefaultHosts.Add("dual.internal", []string{"10.0.3.1", "fd00::3", "10.0.3.2"}))
+
+	r := &Resolver{clients: make(map[string]*DnsClient)}
+	ipv4, ipv6, err := r.LookupIPv4v6(context.Background(), "dual.internal")
+	assert.Nil(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.3.1"), netip.MustParseAddr("10.0.3.2")}, ipv4)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("fd00::3")}, ipv6)
+
+	ipv4, ipv6, err = r.LookupIPv4v6(context.Background(), "::ffff:10.0.3.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.3.1")}, ipv4)
+	assert.Nil(t, ipv6)
+
+	// no nameservers
+	_, _, err = r.LookupIPv4v6(context.Background(), "none.internal")
+	assert.ErrorIs(t, err, errCannotLookupIPv4v6)
+}
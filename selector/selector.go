@@ -3,8 +3,10 @@ package selector
 import (
 	"net"
 
+	"github.com/josexy/mini-ss/options"
 	"github.com/josexy/mini-ss/relay"
 	"github.com/josexy/mini-ss/ss/ctxv"
+	"github.com/josexy/mini-ss/transport"
 	"github.com/josexy/mini-ss/util/logger"
 	"github.com/josexy/mini-ss/util/ordmap"
 )
@@ -39,22 +41,56 @@ func NewSelector() *Selector {
 	return selector
 }
 
+// SetDirectBind binds the outbound sockets of the direct connections
+func (selector *Selector) SetDirectBind(opts *options.BindOptions) {
+	selector.tcpDirector.WithBind(opts)
+	selector.udpDirector.WithBind(opts)
+}
+
 func (selector *Selector) AddProxy(proxy string, ctx ctxv.V) {
-	selector.tcpProxyNode.Store(proxy, relay.NewProxyTCPRelayer(
+	relayer := relay.NewProxyTCPRelayer(
 		ctx.Addr,
 		ctx.Type,
 		ctx.Options,
 		nil,
 		ctx.TcpConnBound,
-	))
+	)
+	if ctx.Forward != nil {
+		relayer.WithForward(ctx.Forward)
+	}
+	if ctx.Bind != nil {
+		relayer.WithBind(ctx.Bind)
+	}
+	if ctx.Mux != nil {
+		relayer.WithMux(ctx.Mux)
+	}
+	selector.AddProxyInvoker(proxy, StreamInvokerFunc(relayer.RelayToProxyServer))
 }
 
 func (selector *Selector) AddPacketProxy(proxy string, ctx ctxv.V) {
-	selector.udpProxyNode.Store(proxy, relay.NewProxyUDPRelayer(
+	relayer := relay.NewProxyUDPRelayer(
 		ctx.Addr,
 		nil,
 		ctx.UdpConnBound,
-	))
+	).WithBind(ctx.Bind)
+	if ctx.PacketDialer != nil {
+		if err := transport.SetDialerBind(ctx.PacketDialer, ctx.Bind); err != nil {
+			logger.Logger.ErrorBy(err)
+			return
+		}
+		relayer.WithPacketDialer(ctx.PacketDialer)
+	}
+	selector.AddPacketProxyInvoker(proxy, PacketInvokerFunc(relayer.RelayToProxyServer))
+}
+
+// AddProxyInvoker adds a proxy node which relays the tcp connections by itself, such as the upstream proxies
+func (selector *Selector) AddProxyInvoker(proxy string, invoker StreamInvoker) {
+	selector.tcpProxyNode.Store(proxy, invoker)
+}
+
+// AddPacketProxyInvoker adds a proxy node which relays the udp packets by itself
+func (selector *Selector) AddPacketProxyInvoker(proxy string, invoker PacketInvoker) {
+	selector.udpProxyNode.Store(proxy, invoker)
 }
 
 func (selector *Selector) Select(proxy string) StreamInvoker {
@@ -69,7 +105,7 @@ func (selector *Selector) Select(proxy string) StreamInvoker {
 		return StreamInvokerFunc(selector.tcpDirector.RelayToServer)
 	}
 	logger.Logger.Trace("tcp: proxy")
-	return StreamInvokerFunc(node.(*relay.ProxyTCPRelayer).RelayToProxyServer)
+	return node.(StreamInvoker)
 }
 
 func (selector *Selector) SelectPacket(proxy string) PacketInvoker {
@@ -84,5 +120,5 @@ func (selector *Selector) SelectPacket(proxy string) PacketInvoker {
 		return PacketInvokerFunc(selector.udpDirector.RelayToServer)
 	}
 	logger.Logger.Trace("udp: proxy")
-	return PacketInvokerFunc(node.(*relay.ProxyUDPRelayer).RelayToProxyServer)
+	return node.(PacketInvoker)
 }
@@ -7,7 +7,6 @@ import (
 	"sync/atomic"
 
 	"github.com/josexy/mini-ss/connection"
-	"github.com/josexy/mini-ss/connection/proto"
 	"github.com/josexy/mini-ss/options"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -18,7 +17,6 @@ import (
 var _ Server = (*GrpcServer)(nil)
 
 type GrpcServer struct {
-	proto.UnimplementedStreamServiceServer
 	ln      *tcpKeepAliveListener
 	server  *grpc.Server
 	Addr    string
@@ -67,7 +65,7 @@ func (s *GrpcServer) Start(ctx context.Context) error {
 	}
 
 	s.server = grpc.NewServer(opts...)
-	proto.RegisterStreamServiceServer(s.server, s)
+	s.server.RegisterService(s.serviceDesc(), s)
 
 	s.running.Store(true)
 	go closeWithContextDoneErr(ctx, s)
@@ -79,9 +77,25 @@ func (s *GrpcServer) Start(ctx context.Context) error {
 	return err
 }
 
-func (s *GrpcServer) Transfer(ss proto.StreamService_TransferServer) error {
-	newConn(connection.NewGrpcServerStreamConn(ss), s).serve()
-	return nil
+// serviceDesc both the single and the multi mode streams are served
+func (s *GrpcServer) serviceDesc() *grpc.ServiceDesc {
+	service, tun, tunMulti := connection.GrpcServiceMethods(s.opts.ServiceName)
+	return &grpc.ServiceDesc{
+		ServiceName: service,
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{
+			{StreamName: tun, Handler: s.transfer(false), ServerStreams: true, ClientStreams: true},
+			{StreamName: tunMulti, Handler: s.transfer(true), ServerStreams: true, ClientStreams: true},
+		},
+		Metadata: "stream.proto",
+	}
+}
+
+func (s *GrpcServer) transfer(multi bool) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		newConn(connection.NewGrpcServerStreamConn(stream, multi), s).serve()
+		return nil
+	}
 }
 
 func (s *GrpcServer) LocalAddr() string { return s.Addr }
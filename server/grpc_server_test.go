@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func waitListening(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s is not listening", addr)
+}
+
+func echo(conn net.Conn) { io.Copy(conn, conn) }
+
+func assertEchoRoundTrip(t *testing.T, dialer transport.Dialer, addr string, sizes ...int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.Dial(ctx, addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for _, size := range sizes {
+		payload := make([]byte, size)
+		rand.Read(payload)
+		go conn.Write(payload)
+		got := make([]byte, size)
+		_, err = io.ReadFull(conn, got)
+		if !assert.Nil(t, err, "size %d", size) {
+			return
+		}
+		assert.Equal(t, payload, got, "size %d", size)
+	}
+}
+
+func TestGrpcServiceDesc(t *testing.T) {
+	tests := []struct {
+		serviceName string
+		service     string
+		streams     []string
+	}{
+		{serviceName: "", service: "proto.StreamService", streams: []string{"Transfer", "TransferMulti"}},
+		{serviceName: "mygun", service: "mygun", streams: []string{"Tun", "TunMulti"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			desc := NewGrpcServer("", nil, &options.GrpcOptions{ServiceName: tt.serviceName}).serviceDesc()
+			assert.Equal(t, tt.service, desc.ServiceName)
+			var streams []string
+			for _, stream := range desc.Streams {
+				assert.True(t, stream.ClientStreams && stream.ServerStreams)
+				streams = append(streams, stream.StreamName)
+			}
+			assert.Equal(t, tt.streams, streams)
+		})
+	}
+}
+
+func TestGrpcRoundTrip(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	for _, serviceName := range []string{"", "mygun"} {
+		addr := freeAddr(t)
+		srv := NewGrpcServer(addr, GrpcHandlerFunc(echo), &options.GrpcOptions{ServiceName: serviceName})
+		go srv.Start(context.Background())
+		t.Cleanup(func() { srv.Close() })
+		waitListening(t, addr)
+
+		for _, multi := range []bool{false, true} {
+			name := map[bool]string{false: "single", true: "multi"}[multi]
+			t.Run(serviceName+"/"+name, func(t *testing.T) {
+				opts := *options.DefaultGrpcOptions
+				opts.ServiceName = serviceName
+				opts.Multi = multi
+				dialer, err := transport.NewDialer(transport.Grpc, &opts)
+				assert.Nil(t, err)
+				assertEchoRoundTrip(t, dialer, addr, 1, 1024, 64<<10, 1<<20)
+			})
+		}
+	}
+}
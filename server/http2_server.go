@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/josexy/mini-ss/connection"
+	"github.com/josexy/mini-ss/options"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var _ Server = (*Http2Server)(nil)
+
+type Http2Server struct {
+	srv     *http.Server
+	Addr    string
+	Handler Http2Handler
+	opts    *options.Http2Options
+	running atomic.Bool
+}
+
+func NewHttp2Server(addr string, handler Http2Handler, opts options.Options) *Http2Server {
+	opts.Update()
+	return &Http2Server{
+		Addr:    addr,
+		Handler: handler,
+		opts:    opts.(*options.Http2Options),
+	}
+}
+
+func (s *Http2Server) LocalAddr() string { return s.Addr }
+
+func (s *Http2Server) Type() ServerType { return Http2 }
+
+func (s *Http2Server) Start(ctx context.Context) error {
+	if s.running.Load() {
+		return ErrServerStarted
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return err
+	}
+	var listener net.Listener = &tcpKeepAliveListener{ln}
+	tlsConfig, err := s.opts.TlsOptions.GetServerTlsConfig()
+	if err != nil {
+		return err
+	}
+
+	h2s := &http2.Server{}
+	var handler http.Handler = http.HandlerFunc(s.serveStream)
+	if tlsConfig == nil {
+		// h2c with prior knowledge
+		handler = h2c.NewHandler(handler, h2s)
+	}
+	s.srv = &http.Server{
+		Addr:              s.Addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	if err = http2.ConfigureServer(s.srv, h2s); err != nil {
+		return err
+	}
+	s.running.Store(true)
+	go closeWithContextDoneErr(ctx, s)
+	if tlsConfig != nil {
+		err = s.srv.ServeTLS(listener, "", "")
+	} else {
+		err = s.srv.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	s.running.Store(false)
+	return err
+}
+
+func (s *Http2Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, http.StatusText(http.StatusHTTPVersionNotSupported), http.StatusHTTPVersionNotSupported)
+		return
+	}
+	switch r.Method {
+	case http.MethodConnect:
+	case http.MethodPost:
+		if r.URL.Path != s.opts.Path {
+			http.NotFound(w, r)
+			return
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if s.opts.Host != "" && r.Host != s.opts.Host {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	// the stream is finished once the handler returns
+	newConn(connection.NewHttp2ServerConn(w, r), s).serve()
+}
+
+func (s *Http2Server) Close() error {
+	if !s.running.Load() {
+		return ErrServerClosed
+	}
+	s.running.Store(false)
+	// the proxied streams are long-lived, so do not wait for them
+	return s.srv.Close()
+}
+
+func (s *Http2Server) Serve(conn *Conn) {
+	if s.Handler != nil {
+		s.Handler.ServeHTTP2(conn)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func startHttp2Server(t *testing.T, handler func(net.Conn), opts *options.Http2Options) string {
+	addr := freeAddr(t)
+	srv := NewHttp2Server(addr, Http2HandlerFunc(handler), opts)
+	go srv.Start(context.Background())
+	t.Cleanup(func() { srv.Close() })
+	waitListening(t, addr)
+	return addr
+}
+
+func TestHttp2RoundTrip(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	addr := startHttp2Server(t, echo, &options.Http2Options{Host: "h2.example.com", Path: "/h2"})
+
+	for _, method := range []string{"POST", "CONNECT"} {
+		t.Run(method, func(t *testing.T) {
+			dialer, err := transport.NewDialer(transport.Http2, &options.Http2Options{Host: "h2.example.com", Path: "/h2", Method: method})
+			assert.Nil(t, err)
+			assertEchoRoundTrip(t, dialer, addr, 1, 1024, 64<<10, 1<<20)
+			// the streams share a single connection
+			assertEchoRoundTrip(t, dialer, addr, 1024)
+		})
+	}
+}
+
+func TestHttp2RoundTripRejected(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	addr := startHttp2Server(t, echo, &options.Http2Options{Host: "h2.example.com", Path: "/h2"})
+
+	tests := []struct {
+		name string
+		opts *options.Http2Options
+	}{
+		{name: "path", opts: &options.Http2Options{Host: "h2.example.com", Path: "/other"}},
+		{name: "host", opts: &options.Http2Options{Host: "other.example.com", Path: "/h2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer, err := transport.NewDialer(transport.Http2, tt.opts)
+			assert.Nil(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = dialer.Dial(ctx, addr)
+			assert.ErrorContains(t, err, "404 Not Found")
+		})
+	}
+}
+
+func dialHttp2(t *testing.T, addr string) net.Conn {
+	dialer, err := transport.NewDialer(transport.Http2, &options.Http2Options{})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.Dial(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHttp2ReadDeadline(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	t.Run("client", func(t *testing.T) {
+		done := make(chan struct{})
+		defer close(done)
+		// the server never writes
+		addr := startHttp2Server(t, func(net.Conn) { <-done }, &options.Http2Options{})
+		conn := dialHttp2(t, addr)
+
+		start := time.Now()
+		conn.SetReadDeadline(start.Add(200 * time.Millisecond))
+		_, err := conn.Read(make([]byte, 16))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+		_, err = conn.Write([]byte("hello"))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+
+	t.Run("server", func(t *testing.T) {
+		serverErr := make(chan error, 1)
+		addr := startHttp2Server(t, func(conn net.Conn) {
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			_, err := conn.Read(make([]byte, 16))
+			serverErr <- err
+		}, &options.Http2Options{})
+		// the client never writes
+		conn := dialHttp2(t, addr)
+
+		select {
+		case err := <-serverErr:
+			assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the server read deadline is not expired")
+		}
+		// the stream is finished once the handler returns
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err := conn.Read(make([]byte, 16))
+		assert.NotNil(t, err)
+		assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+}
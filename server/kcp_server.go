@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/xtaci/kcp-go/v5"
+)
+
+var _ Server = (*KcpServer)(nil)
+
+type KcpServer struct {
+	ln      *kcp.Listener
+	conn    net.PacketConn
+	Addr    string
+	Handler KcpHandler
+	running atomic.Bool
+	opts    *options.KcpOptions
+}
+
+func NewKcpServer(addr string, handler KcpHandler, opts options.Options) *KcpServer {
+	return &KcpServer{
+		Addr:    addr,
+		Handler: handler,
+		opts:    opts.(*options.KcpOptions),
+	}
+}
+
+func (s *KcpServer) LocalAddr() string { return s.Addr }
+
+func (s *KcpServer) Type() ServerType { return Kcp }
+
+func (s *KcpServer) Start(ctx context.Context) error {
+	if s.running.Load() {
+		return ErrServerStarted
+	}
+	conn, err := transport.ListenUDP(ctx, s.Addr)
+	if err != nil {
+		return err
+	}
+	// the listener doesn't own the udp connection
+	s.ln, err = kcp.ServeConn(nil, s.opts.DataShards, s.opts.ParityShards, conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn = conn
+
+	s.running.Store(true)
+	go closeWithContextDoneErr(ctx, s)
+	for {
+		sess, err := s.ln.AcceptKCP()
+		if err != nil {
+			// the listener can't be used anymore once the udp connection is broken
+			if !s.running.Load() {
+				return nil
+			}
+			return err
+		}
+		transport.SetupKcpSession(sess, s.opts)
+		go newConn(sess, s).serve()
+	}
+}
+
+func (s *KcpServer) Serve(conn *Conn) {
+	if s.Handler != nil {
+		s.Handler.ServeKCP(conn)
+	}
+}
+
+func (s *KcpServer) Close() error {
+	if !s.running.Load() {
+		return ErrServerClosed
+	}
+	s.running.Store(false)
+	err := s.ln.Close()
+	s.conn.Close()
+	return err
+}
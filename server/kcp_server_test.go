@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// startLossyUDPProxy forwards the udp packets to the target, and drops every nth packet of the client
+func startLossyUDPProxy(t *testing.T, target string, nth int) (string, *atomic.Int64) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	raddr, err := net.ResolveUDPAddr("udp", target)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		upstream.Close()
+	})
+	var client atomic.Value
+	dropped := new(atomic.Int64)
+	go func() {
+		buf := make([]byte, 65535)
+		for i := 1; ; i++ {
+			n, src, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			client.Store(src)
+			if i%nth == 0 {
+				dropped.Add(1)
+				continue
+			}
+			upstream.WriteTo(buf[:n], raddr)
+		}
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, _, err := upstream.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if src, ok := client.Load().(net.Addr); ok {
+				conn.WriteTo(buf[:n], src)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), dropped
+}
+
+func TestKcpRoundTrip(t *testing.T) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	// the forward error correction is enabled by the default options
+	opts := *options.DefaultKcpOptions
+	assert.True(t, opts.DataShards > 0 && opts.ParityShards > 0)
+	srv := NewKcpServer(addr, KcpHandlerFunc(echo), &opts)
+	go srv.Start(context.Background())
+	t.Cleanup(func() { srv.Close() })
+
+	dialer, err := transport.NewDialer(transport.Kcp, &opts)
+	assert.Nil(t, err)
+
+	t.Run("direct", func(t *testing.T) {
+		assertEchoRoundTrip(t, dialer, addr, 1, 1024, 64<<10, 1<<20)
+	})
+	t.Run("lossy", func(t *testing.T) {
+		proxyAddr, dropped := startLossyUDPProxy(t, addr, 10)
+		assertEchoRoundTrip(t, dialer, proxyAddr, 1, 1024, 64<<10, 256<<10)
+		assert.Greater(t, dropped.Load(), int64(0))
+	})
+}
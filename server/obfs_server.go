@@ -23,7 +23,7 @@ func NewObfsServer(addr string, handler ObfsHandler, opts options.Options) *Obfs
 		Handler: handler,
 		opts:    opts.(*options.ObfsOptions),
 	}
-	s.srv = NewTcpServer(addr, TcpHandlerFunc(s.serveTCP), Obfs)
+	s.srv = NewTcpServer(addr, TcpHandlerFunc(s.serveTCP), Obfs, nil)
 	return s
 }
 
@@ -38,7 +38,11 @@ func (s *ObfsServer) Type() ServerType { return s.srv.typ }
 func (s *ObfsServer) Serve(*Conn) {}
 
 func (s *ObfsServer) serveTCP(c net.Conn) {
-	c = connection.NewObfsConn(c, s.opts.Host, true)
+	if s.opts.Mode == options.ObfsTLS {
+		c = connection.NewObfsTlsConn(c, s.opts.Host, true)
+	} else {
+		c = connection.NewObfsConn(c, s.opts.Host, true)
+	}
 	if s.Handler != nil {
 		s.Handler.ServeOBFS(c)
 	}
@@ -68,18 +68,9 @@ func (s *QuicServer) Start(ctx context.Context) error {
 		return err
 	}
 
-	ln, err := quic.ListenEarly(conn, transport.TlsConfigQuicALPN(tlsConfig), &quic.Config{
-		HandshakeIdleTimeout:  s.opts.HandshakeIdleTimeout,
-		KeepAlivePeriod:       s.opts.KeepAlivePeriod,
-		MaxIdleTimeout:        s.opts.MaxIdleTimeout,
-		MaxIncomingStreams:    1 << 32,
-		MaxIncomingUniStreams: 1 << 32,
-		Allow0RTT:             true,
-		Versions: []quic.VersionNumber{
-			quic.Version1,
-			quic.Version2,
-		},
-	})
+	config := transport.QuicConfig(s.opts)
+	config.Allow0RTT = true
+	ln, err := quic.ListenEarly(conn, transport.TlsConfigQuicALPN(tlsConfig), config)
 	if err != nil {
 		return err
 	}
@@ -101,6 +92,9 @@ func (s *QuicServer) Start(ctx context.Context) error {
 				s.locker.Lock()
 				s.conns = append(s.conns, conn)
 				s.locker.Unlock()
+				if ph, ok := s.Handler.(QuicPacketHandler); ok && s.opts.Datagram {
+					go ph.ServeQUICPacket(connection.NewQuicDatagramConn(conn))
+				}
 				s.acceptStreamForConn(ctx, conn)
 			case <-conn.Context().Done():
 			}
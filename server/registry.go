@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/transport"
+)
+
+// Handler serves the connections of all the transports,
+// the connections of the registered transports are usually served with ServeTCP
+type Handler interface {
+	TcpHandler
+	WsHandler
+	ObfsHandler
+	QuicHandler
+	GrpcHandler
+	SshHandler
+	Http2Handler
+	KcpHandler
+}
+
+// Factory creates the server of the transport with its options
+type Factory func(addr string, handler Handler, opts options.Options) Server
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[transport.Type]Factory{
+		transport.Tcp: func(addr string, handler Handler, opts options.Options) Server {
+			return NewTcpServer(addr, handler, Tcp, opts)
+		},
+		transport.Websocket: func(addr string, handler Handler, opts options.Options) Server {
+			return NewWsServer(addr, handler, opts)
+		},
+		transport.Quic: func(addr string, handler Handler, opts options.Options) Server {
+			return NewQuicServer(addr, handler, opts)
+		},
+		transport.Obfs: func(addr string, handler Handler, opts options.Options) Server {
+			return NewObfsServer(addr, handler, opts)
+		},
+		transport.Grpc: func(addr string, handler Handler, opts options.Options) Server {
+			return NewGrpcServer(addr, handler, opts)
+		},
+		transport.Ssh: func(addr string, handler Handler, opts options.Options) Server {
+			return NewSshServer(addr, handler, opts)
+		},
+		transport.Http2: func(addr string, handler Handler, opts options.Options) Server {
+			return NewHttp2Server(addr, handler, opts)
+		},
+		transport.Kcp: func(addr string, handler Handler, opts options.Options) Server {
+			return NewKcpServer(addr, handler, opts)
+		},
+	}
+)
+
+var errEmptyFactory = errors.New("server factory must not be empty")
+
+// Register registers the server factory of the transport which is registered with transport.Register,
+// the factory of a transport can't be replaced including the built-in ones
+func Register(typ transport.Type, newServer Factory) error {
+	if newServer == nil {
+		return errEmptyFactory
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[typ]; ok {
+		return fmt.Errorf("%s transport server is already registered", typ.String())
+	}
+	registry[typ] = newServer
+	return nil
+}
+
+// New creates the server of the transport
+func New(typ transport.Type, addr string, handler Handler, opts options.Options) (Server, error) {
+	registryMu.RLock()
+	newServer, ok := registry[typ]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s transport server", typ.String())
+	}
+	return newServer(addr, handler, opts), nil
+}
@@ -21,6 +21,10 @@ const (
 	Mixed
 	Grpc
 	Ssh
+	Http2
+	Kcp
+	Redir
+	TProxy
 )
 
 func (t ServerType) String() string {
@@ -43,8 +47,16 @@ func (t ServerType) String() string {
 		return "grpc"
 	case Ssh:
 		return "ssh"
+	case Http2:
+		return "http2"
+	case Kcp:
+		return "kcp"
 	case Mixed:
 		return "mixed-socks-http"
+	case Redir:
+		return "redir"
+	case TProxy:
+		return "tproxy"
 	}
 	return "unknown"
 }
@@ -63,26 +75,35 @@ type (
 		LocalAddr() string
 		Type() ServerType
 	}
-	TcpHandler      interface{ ServeTCP(net.Conn) }
-	WsHandler       interface{ ServeWS(net.Conn) }
-	ObfsHandler     interface{ ServeOBFS(net.Conn) }
-	QuicHandler     interface{ ServeQUIC(net.Conn) }
-	GrpcHandler     interface{ ServeGRPC(net.Conn) }
-	SshHandler      interface{ ServeSSH(net.Conn) }
-	TcpHandlerFunc  func(net.Conn)
-	WsHandlerFunc   func(net.Conn)
-	ObfsHandlerFunc func(net.Conn)
-	QuicHandlerFunc func(net.Conn)
-	GrpcHandlerFunc func(net.Conn)
-	SshHandlerFunc  func(net.Conn)
+	TcpHandler       interface{ ServeTCP(net.Conn) }
+	WsHandler        interface{ ServeWS(net.Conn) }
+	ObfsHandler      interface{ ServeOBFS(net.Conn) }
+	QuicHandler      interface{ ServeQUIC(net.Conn) }
+	GrpcHandler      interface{ ServeGRPC(net.Conn) }
+	SshHandler       interface{ ServeSSH(net.Conn) }
+	Http2Handler     interface{ ServeHTTP2(net.Conn) }
+	KcpHandler       interface{ ServeKCP(net.Conn) }
+	TcpHandlerFunc   func(net.Conn)
+	WsHandlerFunc    func(net.Conn)
+	ObfsHandlerFunc  func(net.Conn)
+	QuicHandlerFunc  func(net.Conn)
+	GrpcHandlerFunc  func(net.Conn)
+	SshHandlerFunc   func(net.Conn)
+	Http2HandlerFunc func(net.Conn)
+	KcpHandlerFunc   func(net.Conn)
 )
 
-func (f TcpHandlerFunc) ServeTCP(conn net.Conn)   { f(conn) }
-func (f WsHandlerFunc) ServeWS(conn net.Conn)     { f(conn) }
-func (f ObfsHandlerFunc) ServeOBFS(conn net.Conn) { f(conn) }
-func (f QuicHandlerFunc) ServeQUIC(conn net.Conn) { f(conn) }
-func (f GrpcHandlerFunc) ServeGRPC(conn net.Conn) { f(conn) }
-func (f SshHandlerFunc) ServeSSH(conn net.Conn)   { f(conn) }
+// QuicPacketHandler the optional handler of the quic server, which serves the udp packets over the quic datagrams
+type QuicPacketHandler interface{ ServeQUICPacket(net.PacketConn) }
+
+func (f TcpHandlerFunc) ServeTCP(conn net.Conn)     { f(conn) }
+func (f WsHandlerFunc) ServeWS(conn net.Conn)       { f(conn) }
+func (f ObfsHandlerFunc) ServeOBFS(conn net.Conn)   { f(conn) }
+func (f QuicHandlerFunc) ServeQUIC(conn net.Conn)   { f(conn) }
+func (f GrpcHandlerFunc) ServeGRPC(conn net.Conn)   { f(conn) }
+func (f SshHandlerFunc) ServeSSH(conn net.Conn)     { f(conn) }
+func (f Http2HandlerFunc) ServeHTTP2(conn net.Conn) { f(conn) }
+func (f KcpHandlerFunc) ServeKCP(conn net.Conn)     { f(conn) }
 
 func closeWithContextDoneErr(ctx context.Context, server Server) {
 	<-ctx.Done()
@@ -37,6 +37,9 @@ func newConn(conn net.Conn, server Server) *Conn {
 	}
 }
 
+// NetConn returns the underlying connection of the listener
+func (c *Conn) NetConn() net.Conn { return c.onceCloseConn.Conn }
+
 func (c *Conn) serve() {
 	defer func() {
 		// if an error occurs, close the client connection
@@ -5,6 +5,9 @@ import (
 	"net"
 	"sync/atomic"
 	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/transport"
 )
 
 type tcpKeepAliveListener struct{ *net.TCPListener }
@@ -27,14 +30,18 @@ type TcpServer struct {
 	Handler TcpHandler
 	typ     ServerType
 	running atomic.Bool
+	opts    *options.TcpOptions
 }
 
-func NewTcpServer(addr string, handler TcpHandler, typ ServerType) *TcpServer {
-	return &TcpServer{
+// NewTcpServer the fast open and multipath tcp are enabled by the tcp options, opts can be nil
+func NewTcpServer(addr string, handler TcpHandler, typ ServerType, opts options.Options) *TcpServer {
+	s := &TcpServer{
 		Addr:    addr,
 		Handler: handler,
 		typ:     typ,
 	}
+	s.opts, _ = opts.(*options.TcpOptions)
+	return s
 }
 
 func (s *TcpServer) LocalAddr() string { return s.Addr }
@@ -45,14 +52,11 @@ func (s *TcpServer) Start(ctx context.Context) error {
 	if s.running.Load() {
 		return ErrServerStarted
 	}
-	laddr, err := net.ResolveTCPAddr("tcp", s.Addr)
-	if err != nil {
-		return err
-	}
-	ln, err := net.ListenTCP("tcp", laddr)
+	l, err := transport.ListenTCP(ctx, s.Addr, s.opts)
 	if err != nil {
 		return err
 	}
+	ln := l.(*net.TCPListener)
 	s.ln = &tcpKeepAliveListener{ln}
 
 	s.running.Store(true)
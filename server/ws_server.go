@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"net"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -14,7 +16,10 @@ import (
 	"github.com/josexy/mini-ss/util/logger"
 )
 
-var errWsUpgradeHostNotMatch = errors.New("ws upgrade host not match")
+var (
+	errWsUpgradeHostNotMatch = errors.New("ws upgrade host not match")
+	errWsPathNotMatch        = errors.New("ws path not match")
+)
 
 var _ Server = (*WsServer)(nil)
 
@@ -68,7 +73,12 @@ func (s *WsServer) Start(ctx context.Context) error {
 	}
 
 	serveMux := http.NewServeMux()
-	serveMux.HandleFunc(s.opts.Path, func(w http.ResponseWriter, r *http.Request) {
+	pattern := s.opts.Path
+	// the early data is appended to the path
+	if s.opts.EarlyDataPath {
+		pattern = "/"
+	}
+	serveMux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
 		err := s.wsUpgrade(w, r)
 		if err != nil {
 			logger.Logger.ErrorBy(err)
@@ -102,14 +112,52 @@ func (s *WsServer) wsUpgrade(w http.ResponseWriter, r *http.Request) error {
 	if s.opts.Host != "" && host != s.opts.Host {
 		return errWsUpgradeHostNotMatch
 	}
-	c, err := s.upgrader.Upgrade(w, r, nil)
+	earlyData, responseHeader, err := s.earlyData(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return err
+	}
+	c, err := s.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		return err
 	}
-	newConn(connection.NewWebsocketConn(c), s).serve()
+	newConn(connection.NewWebsocketConnWithEarlyData(c, earlyData), s).serve()
 	return nil
 }
 
+// earlyData decodes the early data from the header or the path
+func (s *WsServer) earlyData(r *http.Request) ([]byte, http.Header, error) {
+	if s.opts.EarlyDataPath {
+		encoded, ok := strings.CutPrefix(r.URL.Path, s.opts.Path)
+		if !ok {
+			return nil, nil, errWsPathNotMatch
+		}
+		if encoded == "" {
+			return nil, nil, nil
+		}
+		data, err := base64.RawURLEncoding.DecodeString(encoded)
+		return data, nil, err
+	}
+	if s.opts.EarlyDataHeader == "" {
+		return nil, nil, nil
+	}
+	encoded := r.Header.Get(s.opts.EarlyDataHeader)
+	if encoded == "" {
+		return nil, nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		// it's a real header rather than the early data
+		return nil, nil, nil
+	}
+	// the client expects the same sub-protocol in the response
+	var responseHeader http.Header
+	if http.CanonicalHeaderKey(s.opts.EarlyDataHeader) == "Sec-Websocket-Protocol" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {encoded}}
+	}
+	return data, responseHeader, nil
+}
+
 func (s *WsServer) Close() error {
 	if !s.running.Load() {
 		return ErrServerClosed
@@ -0,0 +1,141 @@
+package sockopt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/josexy/cropstun/bind"
+	"github.com/josexy/mini-ss/options"
+)
+
+var errSourceIPInvalid = errors.New("invalid source ip")
+
+type ControlFunc func(syscall.RawConn) error
+
+// AddDialerControl appends fn to the controls of the dialer
+func AddDialerControl(dialer *net.Dialer, fn ControlFunc) {
+	controlCtx, control := dialer.ControlContext, dialer.Control
+	dialer.Control = nil
+	dialer.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		var err error
+		if controlCtx != nil {
+			err = controlCtx(ctx, network, address, c)
+		} else if control != nil {
+			err = control(network, address, c)
+		}
+		if err != nil {
+			return err
+		}
+		return fn(c)
+	}
+}
+
+// AddListenControl appends fn to the control of the listen config
+func AddListenControl(lc *net.ListenConfig, fn ControlFunc) {
+	control := lc.Control
+	lc.Control = func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return fn(c)
+	}
+}
+
+// Bind the effective bind options merged with the global outbound interface and routing mark
+type Bind struct {
+	iface    string
+	sourceIP netip.Addr
+	mark     int
+	err      error
+}
+
+func NewBind(opts *options.BindOptions) Bind {
+	b := Bind{
+		iface: options.DefaultOptions.OutboundInterface,
+		mark:  options.DefaultOptions.RoutingMark,
+	}
+	if opts == nil {
+		return b
+	}
+	if opts.Interface != "" {
+		b.iface = opts.Interface
+	}
+	if opts.Mark != 0 {
+		b.mark = opts.Mark
+	}
+	if opts.SourceIP != "" {
+		if b.sourceIP, b.err = netip.ParseAddr(opts.SourceIP); b.err != nil {
+			b.err = errSourceIPInvalid
+		}
+		b.sourceIP = b.sourceIP.Unmap()
+	}
+	return b
+}
+
+func (b Bind) Empty() bool {
+	return b.err == nil && b.iface == "" && !b.sourceIP.IsValid() && b.mark == 0
+}
+
+// Network restricts the ip family of the network to the one of the source ip
+func (b Bind) Network(network string) string {
+	if !b.sourceIP.IsValid() {
+		return network
+	}
+	if b.sourceIP.Is4() {
+		return network + "4"
+	}
+	return network + "6"
+}
+
+func (b Bind) SetupDialer(dialer *net.Dialer, network string, dst netip.Addr) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.iface != "" {
+		if err := bind.BindToDeviceForConn(b.iface, dialer, network, dst); err != nil {
+			return err
+		}
+	}
+	if b.sourceIP.IsValid() {
+		ip := b.sourceIP.AsSlice()
+		switch network[:3] {
+		case "tcp":
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		case "udp":
+			dialer.LocalAddr = &net.UDPAddr{IP: ip}
+		}
+	}
+	if b.mark != 0 {
+		AddDialerControl(dialer, func(c syscall.RawConn) error { return SetMark(c, b.mark) })
+	}
+	return nil
+}
+
+// SetupListenConfig returns the local address to listen on
+func (b Bind) SetupListenConfig(lc *net.ListenConfig, network, addr string) (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	if b.sourceIP.IsValid() {
+		_, port, _ := net.SplitHostPort(addr)
+		if port == "" {
+			port = "0"
+		}
+		addr = net.JoinHostPort(b.sourceIP.String(), port)
+	}
+	if b.iface != "" {
+		var err error
+		if addr, err = bind.BindToDeviceForPacket(b.iface, lc, network, addr); err != nil {
+			return "", err
+		}
+	}
+	if b.mark != 0 {
+		AddListenControl(lc, func(c syscall.RawConn) error { return SetMark(c, b.mark) })
+	}
+	return addr, nil
+}
@@ -0,0 +1,21 @@
+package sockopt
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func SetsockoptInt(c syscall.RawConn, level, opt, value int) error {
+	var innerErr error
+	if err := c.Control(func(fd uintptr) {
+		innerErr = unix.SetsockoptInt(int(fd), level, opt, value)
+	}); err != nil {
+		return err
+	}
+	return innerErr
+}
+
+func SetMark(c syscall.RawConn, mark int) error {
+	return SetsockoptInt(c, unix.SOL_SOCKET, unix.SO_MARK, mark)
+}
@@ -0,0 +1,75 @@
+package sockopt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// getMark returns the routing mark of the socket
+func getMark(c syscall.RawConn) (int, error) {
+	var mark int
+	var innerErr error
+	if err := c.Control(func(fd uintptr) {
+		mark, innerErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK)
+	}); err != nil {
+		return 0, err
+	}
+	return mark, innerErr
+}
+
+// skipWithoutNetAdmin setting the routing mark requires CAP_NET_ADMIN
+func skipWithoutNetAdmin(t *testing.T, err error) {
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("CAP_NET_ADMIN is required to set the routing mark")
+	}
+}
+
+func TestSetupListenConfigMark(t *testing.T) {
+	setGlobalBind(t, "", 0x1234)
+	var lc net.ListenConfig
+	addr, err := NewBind(&options.BindOptions{SourceIP: "127.0.0.1"}).SetupListenConfig(&lc, "udp", "")
+	assert.Nil(t, err)
+	conn, err := lc.ListenPacket(context.Background(), "udp4", addr)
+	skipWithoutNetAdmin(t, err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rc, err := conn.(*net.UDPConn).SyscallConn()
+	assert.Nil(t, err)
+	mark, err := getMark(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, 0x1234, mark)
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).IP.String())
+}
+
+func TestSetupDialerMark(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	setGlobalBind(t, "", 0x1234)
+	var dialer net.Dialer
+	assert.Nil(t, NewBind(&options.BindOptions{Mark: 0x4321}).SetupDialer(&dialer, "tcp", netip.Addr{}))
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	skipWithoutNetAdmin(t, err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rc, err := conn.(*net.TCPConn).SyscallConn()
+	assert.Nil(t, err)
+	mark, err := getMark(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, 0x4321, mark)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package sockopt
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errRoutingMarkUnsupported = errors.New("routing mark is only supported on linux")
+
+func SetMark(syscall.RawConn, int) error { return errRoutingMarkUnsupported }
@@ -0,0 +1,114 @@
+package sockopt
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/stretchr/testify/assert"
+)
+
+func setGlobalBind(t *testing.T, iface string, mark int) {
+	oldIface, oldMark := options.DefaultOptions.OutboundInterface, options.DefaultOptions.RoutingMark
+	options.DefaultOptions.OutboundInterface, options.DefaultOptions.RoutingMark = iface, mark
+	t.Cleanup(func() {
+		options.DefaultOptions.OutboundInterface, options.DefaultOptions.RoutingMark = oldIface, oldMark
+	})
+}
+
+func TestNewBind(t *testing.T) {
+	setGlobalBind(t, "eth9", 7)
+
+	tests := []struct {
+		name    string
+		opts    *options.BindOptions
+		want    Bind
+		network string
+		wantErr error
+	}{
+		{name: "global", want: Bind{iface: "eth9", mark: 7}, network: "udp"},
+		{
+			name:    "override",
+			opts:    &options.BindOptions{Interface: "eth1", Mark: 9, SourceIP: "2001:db8::1"},
+			want:    Bind{iface: "eth1", mark: 9, sourceIP: netip.MustParseAddr("2001:db8::1")},
+			network: "udp6",
+		},
+		{
+			name:    "unmapped source ip",
+			opts:    &options.BindOptions{SourceIP: "::ffff:192.168.1.2"},
+			want:    Bind{iface: "eth9", mark: 7, sourceIP: netip.MustParseAddr("192.168.1.2")},
+			network: "udp4",
+		},
+		{name: "invalid source ip", opts: &options.BindOptions{SourceIP: "x"}, wantErr: errSourceIPInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBind(tt.opts)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, b.err, tt.wantErr)
+				assert.False(t, b.Empty())
+				_, err := b.SetupListenConfig(&net.ListenConfig{}, "udp", "")
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorIs(t, b.SetupDialer(&net.Dialer{}, "tcp", netip.Addr{}), tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, b)
+			assert.Equal(t, tt.network, b.Network("udp"))
+		})
+	}
+
+	setGlobalBind(t, "", 0)
+	assert.True(t, NewBind(nil).Empty())
+	assert.True(t, NewBind(&options.BindOptions{}).Empty())
+}
+
+func TestSetupListenConfig(t *testing.T) {
+	setGlobalBind(t, "", 0)
+
+	tests := []struct {
+		name string
+		opts *options.BindOptions
+		addr string
+		want string
+	}{
+		{name: "no source ip", opts: &options.BindOptions{}, addr: ":5353", want: ":5353"},
+		{name: "source ip", opts: &options.BindOptions{SourceIP: "127.0.0.1"}, want: "127.0.0.1:0"},
+		{name: "source ip with port", opts: &options.BindOptions{SourceIP: "127.0.0.1"}, addr: "0.0.0.0:5353", want: "127.0.0.1:5353"},
+		{name: "ipv6 source ip", opts: &options.BindOptions{SourceIP: "::1"}, addr: ":53", want: "[::1]:53"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lc net.ListenConfig
+			addr, err := NewBind(tt.opts).SetupListenConfig(&lc, "udp", tt.addr)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, addr)
+			assert.Nil(t, lc.Control)
+		})
+	}
+
+	var lc net.ListenConfig
+	_, err := NewBind(&options.BindOptions{Mark: 1}).SetupListenConfig(&lc, "udp", "")
+	assert.Nil(t, err)
+	assert.NotNil(t, lc.Control)
+}
+
+func TestSetupDialer(t *testing.T) {
+	setGlobalBind(t, "", 0)
+	b := NewBind(&options.BindOptions{SourceIP: "127.0.0.1"})
+
+	var dialer net.Dialer
+	assert.Nil(t, b.SetupDialer(&dialer, "tcp4", netip.Addr{}))
+	assert.Equal(t, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1).To4()}, dialer.LocalAddr)
+	assert.Nil(t, dialer.ControlContext)
+
+	dialer = net.Dialer{}
+	assert.Nil(t, b.SetupDialer(&dialer, "udp", netip.Addr{}))
+	assert.Equal(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1).To4()}, dialer.LocalAddr)
+
+	setGlobalBind(t, "", 1)
+	dialer = net.Dialer{}
+	assert.Nil(t, NewBind(nil).SetupDialer(&dialer, "tcp", netip.Addr{}))
+	assert.Nil(t, dialer.LocalAddr)
+	assert.NotNil(t, dialer.ControlContext)
+}
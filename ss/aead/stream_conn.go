@@ -10,6 +10,7 @@ import (
 
 	"github.com/josexy/mini-ss/bufferpool"
 	cipherx "github.com/josexy/mini-ss/cipher"
+	"github.com/josexy/mini-ss/connection"
 )
 
 type streamReader struct {
@@ -225,14 +226,12 @@ func (c *streamConn) initWriter() error {
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		return err
 	}
-	if _, err := c.Conn.Write(salt); err != nil {
-		return err
-	}
 	cp, err := c.cipher.GetEncrypter(salt)
 	if err != nil {
 		return err
 	}
-	c.w = newStreamWriter(c.Conn, cp)
+	// the salt is sent with the first payload
+	c.w = newStreamWriter(connection.NewConnWithPrefix(c.Conn, salt), cp)
 	return nil
 }
 
@@ -1,9 +1,25 @@
 package ss
 
 import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+var errUnsupportedPasswordHash = errors.New("unsupported password hash, only bcrypt is supported")
+
+// Authenticator validates the username and password of the inbound SOCKS and HTTP proxy requests
+type Authenticator interface {
+	Validate(username, password string) bool
+}
+
 type Auth struct {
 	info *url.Userinfo
 }
@@ -48,3 +64,101 @@ func (a *Auth) Validate(username, password string) bool {
 	}
 	return username == a.info.Username()
 }
+
+// UserStore the inbound users from the config and the htpasswd-style credentials file,
+// the password is either plain text or a bcrypt hash and must not be empty
+type UserStore struct {
+	mu     sync.RWMutex
+	static map[string]string
+	file   string
+	users  map[string]string
+}
+
+func NewUserStore(users map[string]string, file string) (*UserStore, error) {
+	s := &UserStore{static: users, file: file}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reloads the users from the credentials file, the users from the config take precedence.
+// The current users are kept if the file is invalid.
+func (s *UserStore) Reload() error {
+	users := make(map[string]string, len(s.static))
+	if s.file != "" {
+		if err := readUsersFile(s.file, users); err != nil {
+			return err
+		}
+	}
+	for username, password := range s.static {
+		if username == "" || password == "" {
+			return fmt.Errorf("user %q: empty username or password", username)
+		}
+		if err := checkPasswordHash(password); err != nil {
+			return fmt.Errorf("user %q: %w", username, err)
+		}
+		users[username] = password
+	}
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *UserStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+func (s *UserStore) Validate(username, password string) bool {
+	s.mu.RLock()
+	secret, ok := s.users[username]
+	s.mu.RUnlock()
+	if !ok || secret == "" {
+		return false
+	}
+	if isBcryptHash(secret) {
+		return bcrypt.CompareHashAndPassword([]byte(secret), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(password)) == 1
+}
+
+// readUsersFile reads the "username:password" lines, the lines starting with '#' are comments
+func readUsersFile(name string, users map[string]string) error {
+	fp, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		username, password, ok := strings.Cut(line, ":")
+		if !ok || username == "" || password == "" {
+			return fmt.Errorf("users file %s:%d: invalid line", name, lineno)
+		}
+		if err := checkPasswordHash(password); err != nil {
+			return fmt.Errorf("users file %s:%d: %w", name, lineno, err)
+		}
+		users[username] = password
+	}
+	return scanner.Err()
+}
+
+// checkPasswordHash rejects the other htpasswd hash formats, such as MD5 and SHA1
+func checkPasswordHash(s string) error {
+	if strings.HasPrefix(s, "$apr1$") || strings.HasPrefix(s, "{SHA}") {
+		return errUnsupportedPasswordHash
+	}
+	return nil
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
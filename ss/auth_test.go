@@ -0,0 +1,106 @@
+package ss
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeUsersFile(t *testing.T, name, content string) {
+	assert.Nil(t, os.WriteFile(name, []byte(content), 0o600))
+}
+
+func TestUserStoreValidate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-secret"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	name := filepath.Join(t.TempDir(), "users.htpasswd")
+	writeUsersFile(t, name, "# comment\n\nalice:"+string(hash)+"\nbob:plain-secret\n")
+
+	store, err := NewUserStore(nil, name)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, store.Len())
+
+	assert.True(t, store.Validate("alice", "bcrypt-secret"))
+	assert.False(t, store.Validate("alice", "wrong"))
+	assert.False(t, store.Validate("alice", string(hash)))
+	assert.True(t, store.Validate("bob", "plain-secret"))
+	assert.False(t, store.Validate("bob", "plain-secre"))
+	assert.False(t, store.Validate("bob", ""))
+	assert.False(t, store.Validate("carol", ""))
+	assert.False(t, store.Validate("", ""))
+}
+
+func TestUserStorePrecedence(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users.htpasswd")
+	writeUsersFile(t, name, "alice:from-file\nbob:from-file\n")
+
+	store, err := NewUserStore(map[string]string{"alice": "from-config"}, name)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, store.Len())
+	assert.True(t, store.Validate("alice", "from-config"))
+	assert.False(t, store.Validate("alice", "from-file"))
+	assert.True(t, store.Validate("bob", "from-file"))
+}
+
+func TestUserStoreReload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users.htpasswd")
+	writeUsersFile(t, name, "alice:old\n")
+	store, err := NewUserStore(nil, name)
+	assert.Nil(t, err)
+
+	writeUsersFile(t, name, "alice:new\nbob:new\n")
+	assert.Nil(t, store.Reload())
+	assert.Equal(t, 2, store.Len())
+	assert.True(t, store.Validate("alice", "new"))
+	assert.False(t, store.Validate("alice", "old"))
+
+	// the invalid file keeps the current users
+	writeUsersFile(t, name, "alice:newer\ninvalid line\n")
+	assert.NotNil(t, store.Reload())
+	assert.Equal(t, 2, store.Len())
+	assert.True(t, store.Validate("alice", "new"))
+
+	assert.Nil(t, os.Remove(name))
+	assert.NotNil(t, store.Reload())
+	assert.True(t, store.Validate("bob", "new"))
+}
+
+func TestUserStoreReject(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{name: "apr1", content: "alice:$apr1$salt$hash\n", err: errUnsupportedPasswordHash},
+		{name: "sha", content: "alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n", err: errUnsupportedPasswordHash},
+		{name: "empty password", content: "alice:\n"},
+		{name: "empty username", content: ":secret\n"},
+		{name: "missing separator", content: "alice\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name)
+			writeUsersFile(t, name, tt.content)
+			store, err := NewUserStore(nil, name)
+			assert.NotNil(t, err)
+			assert.Nil(t, store)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+
+	for _, users := range []map[string]string{
+		{"alice": ""},
+		{"": "secret"},
+		{"alice": "$apr1$salt$hash"},
+	} {
+		store, err := NewUserStore(users, "")
+		assert.NotNil(t, err)
+		assert.Nil(t, store)
+	}
+}
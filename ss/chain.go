@@ -0,0 +1,122 @@
+package ss
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/josexy/mini-ss/relay"
+	"github.com/josexy/mini-ss/transport"
+)
+
+var (
+	errDialerProxyNotFound = errors.New("dialer proxy not found")
+	errDialerProxyLoop     = errors.New("dialer proxy loop detected")
+)
+
+// dialerChain resolves the dialers which dial the proxy nodes through other proxy nodes
+type dialerChain struct {
+	nodes    map[string]*serverOptions
+	dialers  map[string]transport.Dialer
+	visiting map[string]bool
+}
+
+func newDialerChain(opts []serverOptions) *dialerChain {
+	c := &dialerChain{
+		nodes:    make(map[string]*serverOptions, len(opts)),
+		dialers:  make(map[string]transport.Dialer),
+		visiting: make(map[string]bool),
+	}
+	for i := range opts {
+		c.nodes[opts[i].name] = &opts[i]
+	}
+	return c
+}
+
+// forward returns the dialer which the connections to the node are dialed through, nil means dialing directly.
+// The nodes in the chain are used as is, their own dialer proxies are ignored.
+func (c *dialerChain) forward(opt *serverOptions) (transport.Dialer, error) {
+	if opt.dialerProxy == "" && len(opt.chain) == 0 {
+		return nil, nil
+	}
+	// the connections must not bypass the dialer proxy
+	if opt.upstream != nil {
+		return nil, fmt.Errorf("upstream proxy %q can not be dialed through another node", opt.name)
+	}
+	// the plugin dials the proxy server by itself
+	if opt.pluginAddr != "" || opt.plugin != "" {
+		return nil, fmt.Errorf("%q can not be dialed through another node since it uses the plugin", opt.name)
+	}
+	if len(opt.chain) > 0 {
+		var forward transport.Dialer
+		for _, name := range opt.chain {
+			node, ok := c.nodes[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", errDialerProxyNotFound, name)
+			}
+			var err error
+			if forward, err = c.hop(node, forward); err != nil {
+				return nil, err
+			}
+		}
+		return forward, nil
+	}
+	return c.nodeDialer(opt.dialerProxy)
+}
+
+func (c *dialerChain) nodeDialer(name string) (transport.Dialer, error) {
+	if dialer, ok := c.dialers[name]; ok {
+		return dialer, nil
+	}
+	node, ok := c.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errDialerProxyNotFound, name)
+	}
+	if c.visiting[name] {
+		return nil, fmt.Errorf("%w: %q", errDialerProxyLoop, name)
+	}
+	c.visiting[name] = true
+	defer delete(c.visiting, name)
+
+	forward, err := c.forward(node)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := c.hop(node, forward)
+	if err != nil {
+		return nil, err
+	}
+	c.dialers[name] = dialer
+	return dialer, nil
+}
+
+// hop returns the dialer which connects to the remote servers through the node
+func (c *dialerChain) hop(node *serverOptions, forward transport.Dialer) (transport.Dialer, error) {
+	if node.upstream != nil {
+		if forward != nil {
+			return nil, fmt.Errorf("upstream proxy %q can not be dialed through another node", node.name)
+		}
+		relayer, err := newUpstreamTCPRelayer(node)
+		if err != nil {
+			return nil, err
+		}
+		return transport.DialFunc(relayer.DialRemote), nil
+	}
+	if forward != nil && node.pluginAddr != "" {
+		return nil, fmt.Errorf("%q can not be dialed through another node since it uses the plugin", node.name)
+	}
+	if forward != nil && !node.transport.Forwardable() {
+		return nil, fmt.Errorf("%s transport of %q can not be dialed through another node", node.transport.String(), node.name)
+	}
+	if node.bind != nil && !node.transport.Bindable() {
+		return nil, fmt.Errorf("%s transport of %q does not support the outbound bind", node.transport.String(), node.name)
+	}
+	tcpBound, _, err := makeClientConnBound(node, forward)
+	if err != nil {
+		return nil, err
+	}
+	relayer := relay.NewProxyTCPRelayer(node.tcpAddr(), node.transport, node.opts, nil, tcpBound).WithForward(forward).WithBind(node.bind)
+	if muxEnabled(node) {
+		relayer.WithMux(node.mux)
+	}
+	return transport.DialFunc(relayer.DialRemote), nil
+}
@@ -0,0 +1,265 @@
+package ss
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func waitListening(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s is not listening", addr)
+}
+
+func startEchoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startSocks5Server starts a socks5 server without authentication which records the CONNECT targets
+func startSocks5Server(t *testing.T) (string, func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var targets []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				// VER NMETHODS METHODS
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{0x05, 0x00})
+				// VER CMD RSV ATYP, only the ipv4 address is expected
+				if _, err := io.ReadFull(conn, buf[:10]); err != nil || buf[3] != 0x01 {
+					return
+				}
+				target := net.JoinHostPort(net.IP(buf[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(buf[8:10]))))
+				mu.Lock()
+				targets = append(targets, target)
+				mu.Unlock()
+				remote, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer remote.Close()
+				conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				go io.Copy(remote, conn)
+				io.Copy(conn, remote)
+			}()
+		}
+	}()
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), targets...)
+	}
+}
+
+func startShadowsocksServer(t *testing.T, method, password string) string {
+	addr := freeAddr(t)
+	srv := NewShadowsocksServer(WithServerCompose(
+		WithServerAddr(addr),
+		WithMethod(method),
+		WithPassword(password),
+		WithDefaultTransport(),
+	))
+	go srv.Start()
+	t.Cleanup(func() { srv.Close() })
+	waitListening(t, addr)
+	return addr
+}
+
+func ssNode(name, addr, method, password string) serverOptions {
+	opts := *options.DefaultTcpOptions
+	return serverOptions{
+		name:      name,
+		addr:      addr,
+		method:    method,
+		password:  password,
+		transport: transport.Tcp,
+		opts:      &opts,
+	}
+}
+
+func socks5Node(name, addr string) serverOptions {
+	return serverOptions{
+		name:     name,
+		addr:     addr,
+		upstream: &options.UpstreamOptions{Type: "socks5"},
+	}
+}
+
+func assertEcho(t *testing.T, dialer transport.Dialer, addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.Dial(ctx, addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("hello chain"))
+	assert.Nil(t, err)
+	buf := make([]byte, len("hello chain"))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello chain", string(buf))
+}
+
+func TestDialerChainOrder(t *testing.T) {
+	echoAddr := startEchoServer(t)
+	socksAddr, socksTargets := startSocks5Server(t)
+	addrA := startShadowsocksServer(t, "aes-128-gcm", "password-a")
+	addrB := startShadowsocksServer(t, "chacha20-ietf-poly1305", "password-b")
+
+	t.Run("chain", func(t *testing.T) {
+		node := ssNode("node", echoAddr, "none", "")
+		node.chain = []string{"up", "a", "b"}
+		chain := newDialerChain([]serverOptions{
+			socks5Node("up", socksAddr),
+			ssNode("a", addrA, "aes-128-gcm", "password-a"),
+			ssNode("b", addrB, "chacha20-ietf-poly1305", "password-b"),
+			node,
+		})
+		forward, err := chain.forward(&node)
+		assert.Nil(t, err)
+		assert.NotNil(t, forward)
+		before := len(socksTargets())
+		// client -> up -> a -> b -> echo
+		assertEcho(t, forward, echoAddr)
+		assert.Equal(t, []string{addrA}, socksTargets()[before:])
+	})
+
+	t.Run("dialer proxy", func(t *testing.T) {
+		a := ssNode("a", addrA, "aes-128-gcm", "password-a")
+		a.dialerProxy = "up"
+		b := ssNode("b", addrB, "chacha20-ietf-poly1305", "password-b")
+		b.dialerProxy = "a"
+		node := ssNode("node", echoAddr, "none", "")
+		node.dialerProxy = "b"
+		chain := newDialerChain([]serverOptions{socks5Node("up", socksAddr), a, b, node})
+		forward, err := chain.forward(&node)
+		assert.Nil(t, err)
+		before := len(socksTargets())
+		assertEcho(t, forward, echoAddr)
+		assert.Equal(t, []string{addrA}, socksTargets()[before:])
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		node := ssNode("node", addrA, "aes-128-gcm", "password-a")
+		forward, err := newDialerChain([]serverOptions{node}).forward(&node)
+		assert.Nil(t, err)
+		assert.Nil(t, forward)
+	})
+}
+
+func TestDialerChainNotFound(t *testing.T) {
+	a := ssNode("a", "127.0.0.1:1", "none", "")
+	a.chain = []string{"missing"}
+	b := ssNode("b", "127.0.0.1:2", "none", "")
+	b.dialerProxy = "missing"
+	c := ssNode("c", "127.0.0.1:3", "none", "")
+	c.dialerProxy = "a"
+	chain := newDialerChain([]serverOptions{a, b, c})
+
+	for _, node := range []*serverOptions{&a, &b, &c} {
+		_, err := chain.forward(node)
+		assert.ErrorIs(t, err, errDialerProxyNotFound, node.name)
+	}
+}
+
+func TestDialerChainLoop(t *testing.T) {
+	a := ssNode("a", "127.0.0.1:1", "none", "")
+	a.dialerProxy = "b"
+	b := ssNode("b", "127.0.0.1:2", "none", "")
+	b.dialerProxy = "c"
+	c := ssNode("c", "127.0.0.1:3", "none", "")
+	c.dialerProxy = "a"
+	self := ssNode("self", "127.0.0.1:4", "none", "")
+	self.dialerProxy = "self"
+	chain := newDialerChain([]serverOptions{a, b, c, self})
+
+	_, err := chain.forward(&a)
+	assert.ErrorIs(t, err, errDialerProxyLoop)
+	_, err = chain.forward(&self)
+	assert.ErrorIs(t, err, errDialerProxyLoop)
+}
+
+func TestDialerChainRejectUpstreamAndPlugin(t *testing.T) {
+	a := ssNode("a", "127.0.0.1:1", "none", "")
+	up := socks5Node("up", "127.0.0.1:2")
+	plugin := ssNode("plugin", "127.0.0.1:3", "none", "")
+	plugin.plugin = "v2ray-plugin"
+	plugin.pluginAddr = "127.0.0.1:4"
+	nodes := []serverOptions{a, up, plugin}
+
+	tests := []struct {
+		name   string
+		modify func(*serverOptions)
+		node   serverOptions
+	}{
+		{name: "upstream with dialer proxy", node: up, modify: func(o *serverOptions) { o.dialerProxy = "a" }},
+		{name: "upstream with chain", node: up, modify: func(o *serverOptions) { o.chain = []string{"a"} }},
+		{name: "plugin with dialer proxy", node: plugin, modify: func(o *serverOptions) { o.dialerProxy = "a" }},
+		{name: "plugin with chain", node: plugin, modify: func(o *serverOptions) { o.chain = []string{"a"} }},
+		{name: "upstream in the middle of chain", node: a, modify: func(o *serverOptions) { o.chain = []string{"plugin", "up"} }},
+		{name: "plugin in the middle of chain", node: a, modify: func(o *serverOptions) { o.chain = []string{"up", "plugin"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			tt.modify(&node)
+			forward, err := newDialerChain(nodes).forward(&node)
+			assert.NotNil(t, err)
+			assert.Nil(t, forward)
+		})
+	}
+}
@@ -11,4 +11,12 @@ type V struct {
 	transport.TcpConnBound
 	transport.UdpConnBound
 	options.Options
+	// mux options, nil means disabled
+	Mux options.Options
+	// the dialer which the connections to the proxy server are dialed through, nil means dialing directly
+	Forward transport.Dialer
+	// the outbound sockets to the proxy server are bound with it, nil means using the global options
+	Bind *options.BindOptions
+	// the udp packets are relayed over the transport such as the quic datagrams, nil means the plain udp
+	PacketDialer transport.PacketDialer
 }
@@ -36,10 +36,10 @@ var (
 
 type httpReqHandler struct {
 	owner    *httpProxyServer
-	httpAuth *Auth
+	httpAuth Authenticator
 }
 
-func newHttpReqHandler(auth *Auth, owner *httpProxyServer) *httpReqHandler {
+func newHttpReqHandler(auth Authenticator, owner *httpProxyServer) *httpReqHandler {
 	return &httpReqHandler{
 		httpAuth: auth,
 		owner:    owner,
@@ -140,6 +140,9 @@ func (r *httpReqHandler) readRequest(conn net.Conn, req *http.Request) (proxy.Re
 		Port:       port,
 		Addr:       net.JoinHostPort(host, port),
 	}
+	if r.httpAuth != nil {
+		reqCtx.User = username
+	}
 	if req.Method == http.MethodConnect {
 		// https: CONNECT www.example.com:443 HTTP/1.1
 		// NOTE: ws/wss alos is CONNECT method
@@ -159,11 +162,11 @@ type httpProxyServer struct {
 	pool        *bufferpool.BufferPool
 }
 
-func newHttpProxyServer(addr string, httpAuth *Auth) *httpProxyServer {
+func newHttpProxyServer(addr string, httpAuth Authenticator) *httpProxyServer {
 	hp := &httpProxyServer{}
 	hp.pool = bufferpool.NewBytesBufferPool()
 	hp.handler = newHttpReqHandler(httpAuth, hp)
-	hp.Server = server.NewTcpServer(addr, hp, server.Http)
+	hp.Server = server.NewTcpServer(addr, hp, server.Http, nil)
 	return hp
 }
 
@@ -219,6 +222,7 @@ func (hp *httpProxyServer) ServeTCP(conn net.Conn) {
 			Type:    "HTTP",
 			Proxy:   proxy,
 			Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
+			User:    reqCtx.User,
 		})
 		// defer statistic.DefaultManager.Remove(tcpTracker)
 		conn = tcpTracker
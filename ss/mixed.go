@@ -16,15 +16,15 @@ type mixedServer struct {
 	err      chan error
 }
 
-// newMixedServer mixed proxy mode does not support SOCKS and HTTP authentication
-func newMixedServer(addr string, httpAuth *Auth, socksAuth *Auth) *mixedServer {
+// newMixedServer the SOCKS and HTTP requests on the same port are authenticated respectively
+func newMixedServer(addr string, httpAuth, socksAuth Authenticator) *mixedServer {
 	ms := &mixedServer{
 		addr:     addr,
 		socksSrv: newSocksProxyServer(addr, socksAuth),
 		httpSrv:  newHttpProxyServer(addr, httpAuth),
 		err:      make(chan error, 1),
 	}
-	ms.Server = server.NewTcpServer(addr, server.TcpHandlerFunc(ms.handleTCPConn), server.Mixed)
+	ms.Server = server.NewTcpServer(addr, server.TcpHandlerFunc(ms.handleTCPConn), server.Mixed, nil)
 	return ms
 }
 
@@ -45,7 +45,7 @@ func (s *mixedServer) handleTCPConn(conn net.Conn) {
 		return
 	}
 	switch data[0] {
-	case 0x05:
+	case socks4Version, 0x05:
 		s.socksSrv.ServeTCP(bufConn)
 	default:
 		s.httpSrv.ServeTCP(bufConn)
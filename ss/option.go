@@ -1,6 +1,7 @@
 package ss
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
 	"strings"
@@ -11,8 +12,10 @@ import (
 	"github.com/josexy/mini-ss/proxy"
 	"github.com/josexy/mini-ss/resolver"
 	"github.com/josexy/mini-ss/rule"
+	"github.com/josexy/mini-ss/selector"
 	"github.com/josexy/mini-ss/ssr"
 	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/util/logger"
 )
 
 type serverOptions struct {
@@ -25,6 +28,19 @@ type serverOptions struct {
 	opts      options.Options
 	ssr       bool
 	ssrOpt    ssr.ShadowsocksROption
+	mux       *options.MuxOptions
+	trojan    *options.TrojanOptions
+	upstream  *options.UpstreamOptions
+	// dialerProxy the name of the node which the connections to this node are dialed through
+	dialerProxy string
+	// chain the names of the nodes which the connections to this node are dialed through in order
+	chain []string
+	// SIP003 plugin
+	plugin     string
+	pluginOpts string
+	pluginAddr string
+	// bind the outbound sockets to this node
+	bind *options.BindOptions
 }
 
 type localOptions struct {
@@ -33,7 +49,11 @@ type localOptions struct {
 	mixedAddr       string
 	socksAuth       *Auth
 	httpAuth        *Auth
+	users           map[string]string
+	usersFile       string
 	tcpTunAddr      [][]string
+	redirAddr       string
+	tproxyAddr      string
 	systemProxy     bool
 	enableTun       bool
 	lookupHostsFile bool
@@ -65,10 +85,17 @@ func WithTunName(name string) SSOption {
 	})
 }
 
+// WithTunCIDR set the tun address and the fake ip range, both ipv4 and ipv6 prefixes are supported
 func WithTunCIDR(cidr string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
-		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return
+		}
+		if prefix.Addr().Is4() {
 			so.localOpts.enhancerConfig.Tun.Inet4Address = []netip.Prefix{prefix}
+		} else {
+			so.localOpts.enhancerConfig.Tun.Inet6Address = []netip.Prefix{prefix}
 		}
 	})
 }
@@ -108,9 +135,29 @@ func WithTunDnsHijack(dns []string) SSOption {
 	})
 }
 
+// WithFakeDnsDomainFilter the matched domains are resolved to real ip addresses,
+// wildcard entries such as *.lan, +.local and suffix:/keyword:/regex: entries are supported
 func WithFakeDnsDomainFilter(domain []string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
-		resolver.DefaultDomainFilter = domain
+		if err := resolver.DefaultDomainFilter.Add(domain...); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+	})
+}
+
+// WithFakeDnsDomainFilterFile load the domain filter entries from the list file
+func WithFakeDnsDomainFilterFile(path string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if err := resolver.DefaultDomainFilter.LoadFile(path); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+	})
+}
+
+// WithFakeDnsStore persist the fake ip records to the file, so that they survive restarts
+func WithFakeDnsStore(path string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		resolver.DefaultFakeIPStorePath = path
 	})
 }
 
@@ -133,6 +180,34 @@ func WithOutboundInterface(ifaceName string) SSOption {
 	})
 }
 
+// WithRoutingMark set the SO_MARK of all the outgoing sockets on linux
+func WithRoutingMark(mark int) SSOption {
+	return ssOptionFunc(func(*ssOptions) {
+		options.DefaultOptions.RoutingMark = mark
+	})
+}
+
+// WithIPPreference set the address family which is attempted first when dialing the dual stack hosts
+func WithIPPreference(pref options.IPPreference) SSOption {
+	return ssOptionFunc(func(*ssOptions) {
+		options.DefaultOptions.IPPreference = pref
+	})
+}
+
+// WithDirectBind set the outgoing interface, source ip and routing mark of the direct connections (client-only)
+func WithDirectBind(ifaceName, sourceIP string, mark int) SSOption {
+	return ssOptionFunc(func(*ssOptions) {
+		if ifaceName == "" && sourceIP == "" && mark == 0 {
+			return
+		}
+		selector.ProxySelector.SetDirectBind(&options.BindOptions{
+			Interface: ifaceName,
+			SourceIP:  sourceIP,
+			Mark:      mark,
+		})
+	})
+}
+
 // WithDefaultDnsNameservers default dns nameservers
 func WithDefaultDnsNameservers(ns []string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
@@ -177,6 +252,192 @@ func WithUDPRelay(enable bool) SSOption {
 	})
 }
 
+func (opt *serverOptions) bindOptions() *options.BindOptions {
+	if opt.bind == nil {
+		opt.bind = new(options.BindOptions)
+	}
+	return opt.bind
+}
+
+// WithBindInterface the outgoing interface name of the connections to this node
+func WithBindInterface(ifaceName string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if ifaceName == "" {
+			return
+		}
+		so.serverOpts[0].bindOptions().Interface = ifaceName
+	})
+}
+
+// WithBindSourceIP the source ip of the connections to this node
+func WithBindSourceIP(ip string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if ip == "" {
+			return
+		}
+		so.serverOpts[0].bindOptions().SourceIP = ip
+	})
+}
+
+// WithBindRoutingMark the SO_MARK of the connections to this node on linux
+func WithBindRoutingMark(mark int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if mark == 0 {
+			return
+		}
+		so.serverOpts[0].bindOptions().Mark = mark
+	})
+}
+
+// WithMux enable stream multiplexing over the tcp, websocket, obfs and kcp transports
+func WithMux() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		clone := *options.DefaultMuxOptions
+		so.serverOpts[0].mux = &clone
+	})
+}
+
+func WithMuxConns(conns int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if conns <= 0 || so.serverOpts[0].mux == nil {
+			return
+		}
+		so.serverOpts[0].mux.Conns = conns
+	})
+}
+
+func WithMuxMaxStreams(streams int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if streams < 0 || so.serverOpts[0].mux == nil {
+			return
+		}
+		so.serverOpts[0].mux.MaxStreams = streams
+	})
+}
+
+// WithTrojan speaks the trojan protocol instead of shadowsocks, the password is shared
+func WithTrojan() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		clone := *options.DefaultTrojanOptions
+		so.serverOpts[0].trojan = &clone
+	})
+}
+
+func WithTrojanTLS(mode options.TlsMode) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.TlsOptions.Mode = mode
+	})
+}
+
+func WithTrojanHostname(hostname string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.Hostname = hostname
+	})
+}
+
+func WithTrojanCertPath(certFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.CertFile = certFile
+	})
+}
+
+func WithTrojanKeyPath(keyFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.KeyFile = keyFile
+	})
+}
+
+func WithTrojanCAPath(caFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.CAFile = caFile
+	})
+}
+
+// WithTrojanFallback the http backend address which the unauthenticated connections are relayed to
+func WithTrojanFallback(addr string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].trojan.Fallback = addr
+	})
+}
+
+// WithSocks5Upstream relays through the upstream socks5 proxy server instead of shadowsocks
+func WithSocks5Upstream() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream = &options.UpstreamOptions{Type: "socks5"}
+	})
+}
+
+// WithHttpUpstream relays through the upstream http proxy server instead of shadowsocks, udp is not supported
+func WithHttpUpstream() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream = &options.UpstreamOptions{Type: "http"}
+	})
+}
+
+func WithUpstreamUsername(username string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.Username = username
+	})
+}
+
+func WithUpstreamTLS(mode options.TlsMode) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.TlsOptions.Mode = mode
+	})
+}
+
+func WithUpstreamHostname(hostname string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.Hostname = hostname
+	})
+}
+
+func WithUpstreamCertPath(certFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.CertFile = certFile
+	})
+}
+
+func WithUpstreamKeyPath(keyFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.KeyFile = keyFile
+	})
+}
+
+func WithUpstreamCAPath(caFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].upstream.CAFile = caFile
+	})
+}
+
+// WithDialerProxy dials the proxy server through another proxy node (client-only)
+func WithDialerProxy(name string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].dialerProxy = name
+	})
+}
+
+// WithChain dials the proxy server through the proxy nodes in order (client-only)
+// for example: client -> a -> b -> server
+func WithChain(names ...string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].chain = names
+	})
+}
+
+// WithPlugin routes the tcp traffic through the SIP003 plugin, such as v2ray-plugin and kcptun
+func WithPlugin(name string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].plugin = name
+	})
+}
+
+func WithPluginOpts(opts string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].pluginOpts = opts
+	})
+}
+
 // WithEnableSSR whether to support SSR connection
 // for example "ss" or "ssr", default "ss"
 func WithEnableSSR() SSOption {
@@ -240,11 +501,34 @@ func WithPassword(password string) SSOption {
 func WithDefaultTransport() SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].transport = transport.Tcp
-		clone := *options.DefaultOptions
+		clone := *options.DefaultTcpOptions
 		so.serverOpts[0].opts = &clone
 	})
 }
 
+// WithTransport the transport which is registered with transport.Register and server.Register
+func WithTransport(typ transport.Type, opts options.Options) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].transport = typ
+		so.serverOpts[0].opts = opts
+	})
+}
+
+// WithTcpFastOpen sends the salt and the target address within the SYN (linux-only),
+// it is disabled if the server host resolves to more than one address
+func WithTcpFastOpen(enable bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.TcpOptions).FastOpen = enable
+	})
+}
+
+// WithTcpMultipath enable multipath tcp (linux-only)
+func WithTcpMultipath(enable bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.TcpOptions).Multipath = enable
+	})
+}
+
 func WithRuler(ruler *rule.Ruler) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		rule.MatchRuler = ruler
@@ -258,6 +542,25 @@ func WithSystemProxy() SSOption {
 	})
 }
 
+// WithHosts add a static hosts entry, the values are ip addresses or an alias domain
+func WithHosts(host string, values []string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if err := resolver.DefaultHosts.Add(host, values); err != nil {
+			logger.Logger.ErrorBy(fmt.Errorf("hosts %q: %w", host, err))
+		}
+	})
+}
+
+// WithDnsClientSubnetPolicy override the edns client subnet of the nameservers for the domain,
+// the subnet "none" disables the edns client subnet for the domain
+func WithDnsClientSubnetPolicy(domain, subnet string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if err := resolver.DefaultClientSubnetPolicy.Add(domain, subnet); err != nil {
+			logger.Logger.ErrorBy(fmt.Errorf("client subnet policy %q: %w", domain, err))
+		}
+	})
+}
+
 func WithLookupHostsFile() SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.localOpts.lookupHostsFile = true
@@ -288,6 +591,15 @@ func WithHttpUserInfo(username, password string) SSOption {
 	})
 }
 
+// WithUsers the inbound users shared by the SOCKS, HTTP and mixed proxy, which replace the SOCKS and HTTP user info.
+// The password is either plain text or a bcrypt hash, and the users file is in the htpasswd format
+func WithUsers(users map[string]string, file string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.localOpts.users = users
+		so.localOpts.usersFile = file
+	})
+}
+
 // WithMixedAddr mixed proxy ports (SOCKS and HTTP)
 func WithMixedAddr(addr string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
@@ -295,6 +607,20 @@ func WithMixedAddr(addr string) SSOption {
 	})
 }
 
+// WithRedirAddr the tcp connections redirected by the iptables or nftables REDIRECT rules (linux-only)
+func WithRedirAddr(addr string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.localOpts.redirAddr = addr
+	})
+}
+
+// WithTProxyAddr the tcp connections and udp packets of the iptables or nftables TPROXY rules (linux-only)
+func WithTProxyAddr(addr string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.localOpts.tproxyAddr = addr
+	})
+}
+
 func WithTcpTunAddr(addrs [][]string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.localOpts.tcpTunAddr = addrs
@@ -347,6 +673,13 @@ func WithObfsHost(host string) SSOption {
 	})
 }
 
+// WithObfsMode the simple-obfs mode, http (default) or tls
+func WithObfsMode(mode options.ObfsMode) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.ObfsOptions).Mode = mode
+	})
+}
+
 func WithQuicTransport() SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].transport = transport.Quic
@@ -412,6 +745,36 @@ func WithQuicCAPath(caFile string) SSOption {
 	})
 }
 
+// WithQuicDatagram relays the udp packets with the quic datagram frames instead of the plain udp
+func WithQuicDatagram(datagram bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.QuicOptions).Datagram = datagram
+	})
+}
+
+// WithQuicMigrate migrates the pooled quic connections to the new network instead of redialling them (client-only)
+func WithQuicMigrate(migrate bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.QuicOptions).Migrate = migrate
+	})
+}
+
+// WithQuicStreamReceiveWindow the initial and max receive windows of the quic stream in bytes
+func WithQuicStreamReceiveWindow(initial, max uint64) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.QuicOptions).InitialStreamReceiveWindow = initial
+		so.serverOpts[0].opts.(*options.QuicOptions).MaxStreamReceiveWindow = max
+	})
+}
+
+// WithQuicConnReceiveWindow the initial and max receive windows of the quic connection in bytes
+func WithQuicConnReceiveWindow(initial, max uint64) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.QuicOptions).InitialConnectionReceiveWindow = initial
+		so.serverOpts[0].opts.(*options.QuicOptions).MaxConnectionReceiveWindow = max
+	})
+}
+
 func WithWsTransport() SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].transport = transport.Websocket
@@ -447,10 +810,34 @@ func WithWsCompress() SSOption {
 
 func WithWsUserAgent(userAgent string) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
+		if userAgent == "" {
+			return
+		}
 		so.serverOpts[0].opts.(*options.WsOptions).UserAgent = userAgent
 	})
 }
 
+// WithWsHeaders the extra request headers
+func WithWsHeaders(headers map[string]string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if len(headers) == 0 {
+			return
+		}
+		so.serverOpts[0].opts.(*options.WsOptions).Headers = headers
+	})
+}
+
+// WithWsEarlyData sends the first data up to maxEarlyData bytes within the handshake request like v2ray `ed=2048`,
+// it's carried in the header, or appended to the path if the header is empty which the server only accepts then
+func WithWsEarlyData(maxEarlyData int, header string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		opts := so.serverOpts[0].opts.(*options.WsOptions)
+		opts.MaxEarlyData = max(maxEarlyData, 0)
+		opts.EarlyDataHeader = header
+		opts.EarlyDataPath = header == ""
+	})
+}
+
 func WithWsTLS(mode options.TlsMode) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].opts.(*options.WsOptions).TlsOptions.Mode = mode
@@ -519,6 +906,29 @@ func WithGrpcCAPath(caFile string) SSOption {
 	})
 }
 
+// WithGrpcServiceName the methods are named like Xray's gun service, such as /<name>/Tun
+func WithGrpcServiceName(name string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.GrpcOptions).ServiceName = strings.Trim(name, "/")
+	})
+}
+
+// WithGrpcMulti sends the data with the repeated bytes message
+func WithGrpcMulti(multi bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.GrpcOptions).Multi = multi
+	})
+}
+
+func WithGrpcConns(conns int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if conns <= 0 {
+			return
+		}
+		so.serverOpts[0].opts.(*options.GrpcOptions).Conns = conns
+	})
+}
+
 func WithGrpcSndRevBuffer(sndBuffer, revBuffer int) SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].opts.(*options.GrpcOptions).SndBuffer = sndBuffer
@@ -526,6 +936,129 @@ func WithGrpcSndRevBuffer(sndBuffer, revBuffer int) SSOption {
 	})
 }
 
+func WithKcpTransport() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].transport = transport.Kcp
+		clone := *options.DefaultKcpOptions
+		so.serverOpts[0].opts = &clone
+	})
+}
+
+// WithKcpMtu the mtu must be the same for both sides
+func WithKcpMtu(mtu int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if mtu <= 0 {
+			return
+		}
+		so.serverOpts[0].opts.(*options.KcpOptions).Mtu = mtu
+	})
+}
+
+func WithKcpWindowSize(sndWnd, rcvWnd int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		opts := so.serverOpts[0].opts.(*options.KcpOptions)
+		if sndWnd > 0 {
+			opts.SndWnd = sndWnd
+		}
+		if rcvWnd > 0 {
+			opts.RcvWnd = rcvWnd
+		}
+	})
+}
+
+// WithKcpNoDelay nodelay reduces the minimum rto, resend enables the fast retransmission and nc disables the congestion control
+func WithKcpNoDelay(nodelay bool, interval time.Duration, resend int, nc bool) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		opts := so.serverOpts[0].opts.(*options.KcpOptions)
+		opts.NoDelay = nodelay
+		if interval > 0 {
+			opts.Interval = interval
+		}
+		if resend >= 0 {
+			opts.Resend = resend
+		}
+		opts.NoCongestion = nc
+	})
+}
+
+// WithKcpFEC the shards must be the same for both sides, the fec is disabled if either of them is zero
+func WithKcpFEC(dataShards, parityShards int) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if dataShards < 0 || parityShards < 0 {
+			return
+		}
+		opts := so.serverOpts[0].opts.(*options.KcpOptions)
+		opts.DataShards = dataShards
+		opts.ParityShards = parityShards
+	})
+}
+
+func WithHttp2Transport() SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].transport = transport.Http2
+		clone := *options.DefaultHttp2Options
+		so.serverOpts[0].opts = &clone
+	})
+}
+
+func WithHttp2Host(host string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if host == "" {
+			return
+		}
+		so.serverOpts[0].opts.(*options.Http2Options).Host = host
+	})
+}
+
+func WithHttp2Path(path string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if path == "" {
+			return
+		}
+		so.serverOpts[0].opts.(*options.Http2Options).Path = path
+	})
+}
+
+// WithHttp2Method the method of the tunneled stream, CONNECT or POST, default POST
+func WithHttp2Method(method string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		if method == "" {
+			return
+		}
+		so.serverOpts[0].opts.(*options.Http2Options).Method = strings.ToUpper(method)
+	})
+}
+
+func WithHttp2TLS(mode options.TlsMode) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.Http2Options).TlsOptions.Mode = mode
+	})
+}
+
+func WithHttp2Hostname(hostname string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.Http2Options).Hostname = hostname
+	})
+}
+
+func WithHttp2CertPath(certFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.Http2Options).TlsOptions.CertFile = certFile
+	})
+}
+
+func WithHttp2KeyPath(keyFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.Http2Options).TlsOptions.KeyFile = keyFile
+	})
+}
+
+func WithHttp2CAPath(caFile string) SSOption {
+	return ssOptionFunc(func(so *ssOptions) {
+		so.serverOpts[0].opts.(*options.Http2Options).TlsOptions.CAFile = caFile
+	})
+}
+
 func WithSshTransport() SSOption {
 	return ssOptionFunc(func(so *ssOptions) {
 		so.serverOpts[0].transport = transport.Ssh
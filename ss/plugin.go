@@ -0,0 +1,55 @@
+package ss
+
+import (
+	"net"
+
+	"github.com/josexy/mini-ss/plugin"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+// tcpAddr the address which the tcp traffic of the node is routed through,
+// it's the local address of the plugin if enabled, while the udp traffic is not affected
+func (opt *serverOptions) tcpAddr() string {
+	if opt.pluginAddr != "" {
+		return opt.pluginAddr
+	}
+	return opt.addr
+}
+
+// attachPlugin creates the SIP003 plugin of the node if configured.
+// For the client the plugin connects to the server address, and for the server it listens on the server address.
+func attachPlugin(opt *serverOptions) (*plugin.Plugin, error) {
+	if opt.plugin == "" {
+		return nil, nil
+	}
+	if opt.upstream != nil {
+		logger.Logger.Warnf("plugin is not supported by the upstream proxy %q", opt.name)
+		return nil, nil
+	}
+	remoteAddr := opt.addr
+	if host, port, err := net.SplitHostPort(remoteAddr); err == nil && host == "" {
+		remoteAddr = net.JoinHostPort("0.0.0.0", port)
+	}
+	p, err := plugin.New(opt.plugin, opt.pluginOpts, remoteAddr, "")
+	if err != nil {
+		return nil, err
+	}
+	opt.pluginAddr = p.LocalAddr()
+	return p, nil
+}
+
+func startPlugins(plugins []*plugin.Plugin) error {
+	for i, p := range plugins {
+		if err := p.Start(); err != nil {
+			closePlugins(plugins[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+func closePlugins(plugins []*plugin.Plugin) {
+	for _, p := range plugins {
+		p.Close()
+	}
+}
@@ -0,0 +1,83 @@
+package ss
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/rule"
+	"github.com/josexy/mini-ss/selector"
+	"github.com/josexy/mini-ss/server"
+	"github.com/josexy/mini-ss/statistic"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+var errRedirLoop = errors.New("redir: the original destination is the redir server itself")
+
+// redirServer accepts the tcp connections redirected by the iptables or nftables REDIRECT rules (linux-only)
+type redirServer struct {
+	server.Server
+	addr string
+}
+
+func newRedirServer(addr string) *redirServer {
+	rs := &redirServer{addr: addr}
+	rs.Server = server.NewTcpServer(addr, rs, server.Redir, nil)
+	return rs
+}
+
+func (rs *redirServer) ServeTCP(conn net.Conn) {
+	dst, err := transport.OriginalDst(conn)
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
+	// the connections to the redir server itself are not redirected
+	if local, err := netip.ParseAddrPort(conn.LocalAddr().String()); err == nil &&
+		netip.AddrPortFrom(local.Addr().Unmap(), local.Port()) == dst {
+		logger.Logger.ErrorBy(errRedirLoop)
+		return
+	}
+	relayTransparentTCP(conn, dst, "REDIR")
+}
+
+// relayTransparentTCP relays the tcp connection of the redir and tproxy servers to its original destination
+func relayTransparentTCP(conn net.Conn, dst netip.AddrPort, typ string) {
+	host := dst.Addr().String()
+	// the destination may be a fake ip address if the fake dns is enabled
+	if resolver.DefaultResolver.IsEnhancerMode() && resolver.DefaultResolver.IsFakeIP(dst.Addr()) {
+		record, err := resolver.DefaultResolver.FindByIP(dst.Addr())
+		if err != nil {
+			logger.Logger.ErrorBy(err)
+			return
+		}
+		host = record.Domain
+	}
+	if !rule.MatchRuler.Match(&host) {
+		return
+	}
+	proxy, err := rule.MatchRuler.Select()
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
+	remoteAddr := net.JoinHostPort(host, strconv.FormatUint(uint64(dst.Port()), 10))
+	if statistic.EnableStatistic {
+		tcpTracker := statistic.NewTCPTracker(conn, statistic.Context{
+			Src:     conn.RemoteAddr().String(),
+			Dst:     remoteAddr,
+			Network: "TCP",
+			Type:    typ,
+			Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
+			Proxy:   proxy,
+		})
+		defer statistic.DefaultManager.Remove(tcpTracker)
+		conn = tcpTracker
+	}
+	if err = selector.ProxySelector.Select(proxy).Invoke(conn, remoteAddr); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
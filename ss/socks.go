@@ -7,11 +7,14 @@ import (
 	"net"
 	"net/netip"
 	"strconv"
+	"time"
 
 	"github.com/josexy/mini-ss/address"
 	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/connection"
 	"github.com/josexy/mini-ss/proxy"
 	proxyaddons "github.com/josexy/mini-ss/proxy-addons"
+	"github.com/josexy/mini-ss/relay"
 	"github.com/josexy/mini-ss/resolver"
 	"github.com/josexy/mini-ss/rule"
 	"github.com/josexy/mini-ss/selector"
@@ -35,23 +38,27 @@ var (
 	errAuthFailure             = errors.New("socks authentication failure")
 	errAuthUserShortLength     = errors.New("socks authentication user short length")
 	errAuthPasswordShortLength = errors.New("socks authentication password short length")
+	errBindThroughProxy        = errors.New("socks bind is only supported for the direct connections")
 )
 
+// socksBindTimeout the time to wait for the incoming connection of the BIND command
+const socksBindTimeout = 60 * time.Second
+
 type socks5Server struct {
 	server.Server
 	addr        string
-	socksAuth   *Auth
+	socksAuth   Authenticator
 	mitmHandler proxy.MitmHandler
 	pool        *bufferpool.BufferPool
 }
 
-func newSocksProxyServer(addr string, socksAuth *Auth) *socks5Server {
+func newSocksProxyServer(addr string, socksAuth Authenticator) *socks5Server {
 	ss := &socks5Server{
 		addr:      addr,
 		socksAuth: socksAuth,
 		pool:      bufferpool.NewBufferPool(bufferpool.MaxSocksBufferSize),
 	}
-	ss.Server = server.NewTcpServer(addr, ss, server.Socks)
+	ss.Server = server.NewTcpServer(addr, ss, server.Socks, nil)
 	return ss
 }
 
@@ -69,52 +76,75 @@ func (s *socks5Server) WithMitmMode(opt proxy.MimtOption) *socks5Server {
 }
 
 func (s *socks5Server) ServeTCP(conn net.Conn) {
-	dstAddr, cmd, err := s.handshake(conn)
+	bufConn, ok := conn.(*connection.BufioConn)
+	if !ok {
+		bufConn = connection.NewBufioConn(conn)
+	}
+	ver, err := bufConn.Peek(1)
+	if err != nil {
+		return
+	}
+	if ver[0] == socks4Version {
+		if err = s.serveSocks4(bufConn); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+		return
+	}
+
+	dstAddr, cmd, user, err := s.handshake(bufConn)
 	if err != nil {
 		logger.Logger.ErrorBy(err)
 		return
 	}
 	if cmd == CONNECT {
-		if s.mitmHandler != nil {
-			host, port, _ := net.SplitHostPort(dstAddr)
-			ctx := context.WithValue(context.Background(), proxy.ReqCtxKey, proxy.ReqContext{
-				ConnMethod: true, // ConnMethod is true for socks5 proxy
-				Host:       host,
-				Port:       port,
-				Addr:       dstAddr,
-			})
-			if err = s.mitmHandler.HandleMIMT(ctx, conn); err != nil {
-				logger.Logger.ErrorBy(err)
-			}
-			return
-		}
+		s.relayConnect(bufConn, dstAddr, user)
+	}
+}
 
-		proxy, err := rule.MatchRuler.Select()
-		if err != nil {
+// relayConnect relays the connection of the CONNECT command to the selected proxy,
+// the user is the authenticated username which is empty if the authentication is disabled
+func (s *socks5Server) relayConnect(conn net.Conn, dstAddr, user string) {
+	if s.mitmHandler != nil {
+		host, port, _ := net.SplitHostPort(dstAddr)
+		ctx := context.WithValue(context.Background(), proxy.ReqCtxKey, proxy.ReqContext{
+			ConnMethod: true, // ConnMethod is true for socks5 proxy
+			Host:       host,
+			Port:       port,
+			Addr:       dstAddr,
+			User:       user,
+		})
+		if err := s.mitmHandler.HandleMIMT(ctx, conn); err != nil {
 			logger.Logger.ErrorBy(err)
-			return
 		}
+		return
+	}
 
-		if statistic.EnableStatistic {
-			tcpTracker := statistic.NewTCPTracker(conn, statistic.Context{
-				Src:     conn.RemoteAddr().String(),
-				Dst:     dstAddr,
-				Network: "TCP",
-				Type:    "SOCKS",
-				Proxy:   proxy,
-				Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
-			})
-			defer statistic.DefaultManager.Remove(tcpTracker)
-			conn = tcpTracker
-		}
+	proxy, err := rule.MatchRuler.Select()
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
 
-		if err = selector.ProxySelector.Select(proxy).Invoke(conn, dstAddr); err != nil {
-			logger.Logger.ErrorBy(err)
-		}
+	if statistic.EnableStatistic {
+		tcpTracker := statistic.NewTCPTracker(conn, statistic.Context{
+			Src:     conn.RemoteAddr().String(),
+			Dst:     dstAddr,
+			Network: "TCP",
+			Type:    "SOCKS",
+			Proxy:   proxy,
+			Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
+			User:    user,
+		})
+		defer statistic.DefaultManager.Remove(tcpTracker)
+		conn = tcpTracker
+	}
+
+	if err = selector.ProxySelector.Select(proxy).Invoke(conn, dstAddr); err != nil {
+		logger.Logger.ErrorBy(err)
 	}
 }
 
-func (s *socks5Server) negotiate(conn net.Conn) (err error) {
+func (s *socks5Server) negotiate(conn net.Conn) (user string, err error) {
 	buf := s.pool.Get()
 	defer s.pool.Put(buf)
 
@@ -124,14 +154,14 @@ func (s *socks5Server) negotiate(conn net.Conn) (err error) {
 	// | 1  |    1     | 1 to 255 |
 	// +----+----------+----------+
 
-	if _, err := io.ReadFull(conn, (*buf)[:1]); err != nil || (*buf)[0] != 0x05 {
-		return errVersion5Invalid
+	if _, err = io.ReadFull(conn, (*buf)[:1]); err != nil || (*buf)[0] != 0x05 {
+		return "", errVersion5Invalid
 	}
 	if _, err = io.ReadFull(conn, (*buf)[:1]); err != nil || (*buf)[0] <= 0 {
-		return errUnsupportedMethod
+		return "", errUnsupportedMethod
 	}
 	if _, err = io.ReadFull(conn, (*buf)[:(*buf)[0]]); err != nil {
-		return err
+		return "", err
 	}
 
 	method := 0x00
@@ -149,10 +179,10 @@ func (s *socks5Server) negotiate(conn net.Conn) (err error) {
 	if method == 0x02 {
 		return s.auth(conn, buf)
 	}
-	return nil
+	return "", nil
 }
 
-func (s *socks5Server) auth(conn net.Conn, buf *[]byte) (err error) {
+func (s *socks5Server) auth(conn net.Conn, buf *[]byte) (user string, err error) {
 	// +----+------+----------+------+----------+
 	// |VER | ULEN |  UNAME   | PLEN |  PASSWD  |
 	// +----+------+----------+------+----------+
@@ -162,26 +192,26 @@ func (s *socks5Server) auth(conn net.Conn, buf *[]byte) (err error) {
 	var username, password string
 	var userLen, passLen int
 	if _, err = io.ReadFull(conn, (*buf)[:1]); err != nil || (*buf)[0] != 0x1 {
-		return errVersion1Invalid
+		return "", errVersion1Invalid
 	}
 	if _, err = io.ReadFull(conn, (*buf)[:1]); err != nil {
-		return err
+		return "", err
 	}
 	if userLen = int((*buf)[0]); userLen <= 0 {
-		return errAuthUserShortLength
+		return "", errAuthUserShortLength
 	}
 	if _, err = io.ReadFull(conn, (*buf)[:userLen]); err != nil {
-		return err
+		return "", err
 	}
 	username = string((*buf)[:userLen])
 	if _, err = io.ReadFull(conn, (*buf)[:1]); err != nil {
-		return err
+		return "", err
 	}
 	if passLen = int((*buf)[0]); passLen <= 0 {
-		return errAuthPasswordShortLength
+		return "", errAuthPasswordShortLength
 	}
 	if _, err = io.ReadFull(conn, (*buf)[:passLen]); err != nil {
-		return err
+		return "", err
 	}
 	password = string((*buf)[:passLen])
 
@@ -194,14 +224,14 @@ func (s *socks5Server) auth(conn net.Conn, buf *[]byte) (err error) {
 	if s.socksAuth.Validate(username, password) {
 		(*buf)[1] = 0x00
 		conn.Write((*buf)[:2])
-		return nil
+		return username, nil
 	}
 	(*buf)[1] = 0x01
 	conn.Write((*buf)[:2])
-	return errAuthFailure
+	return "", errAuthFailure
 }
 
-func (s *socks5Server) request(conn net.Conn) (addr string, cmd byte, err error) {
+func (s *socks5Server) request(conn net.Conn, user string) (addr string, cmd byte, err error) {
 	buf := s.pool.Get()
 
 	// var n int
@@ -259,8 +289,12 @@ func (s *socks5Server) request(conn net.Conn) (addr string, cmd byte, err error)
 		if err = s.handleCmdConnect(conn, buf); err != nil {
 			return
 		}
+	case BIND:
+		if err = s.handleCmdBind(conn, buf, addr, user); err != nil {
+			return
+		}
 	case UDP:
-		if err = s.handleCmdUdpAssociate(conn, buf); err != nil {
+		if err = s.handleCmdUdpAssociate(conn, buf, user); err != nil {
 			return
 		}
 	default:
@@ -272,12 +306,13 @@ func (s *socks5Server) request(conn net.Conn) (addr string, cmd byte, err error)
 	return
 }
 
-func (s *socks5Server) handshake(conn net.Conn) (dstAddr string, cmd byte, err error) {
-	if err = s.negotiate(conn); err != nil {
+func (s *socks5Server) handshake(conn net.Conn) (dstAddr string, cmd byte, user string, err error) {
+	if user, err = s.negotiate(conn); err != nil {
 		logger.Logger.ErrorBy(err)
 		return
 	}
-	return s.request(conn)
+	dstAddr, cmd, err = s.request(conn, user)
+	return
 }
 
 func (s *socks5Server) handleCmdConnect(conn net.Conn, buf *[]byte) error {
@@ -299,7 +334,7 @@ func (s *socks5Server) handleCmdConnect(conn net.Conn, buf *[]byte) error {
 	return nil
 }
 
-func (s *socks5Server) handleCmdUdpAssociate(conn net.Conn, buf *[]byte) error {
+func (s *socks5Server) handleCmdUdpAssociate(conn net.Conn, buf *[]byte, user string) error {
 	// +----+-----+-------+------+----------+----------+
 	// |VER | REP |  RSV  | ATYP | BND.ADDR | BND.PORT |
 	// +----+-----+-------+------+----------+----------+
@@ -348,6 +383,7 @@ func (s *socks5Server) handleCmdUdpAssociate(conn net.Conn, buf *[]byte) error {
 			Type:    "SOCKS",
 			Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
 			Proxy:   proxy,
+			User:    user,
 		})
 		defer statistic.DefaultManager.Remove(udpTracker)
 		dstConn = udpTracker
@@ -355,6 +391,118 @@ func (s *socks5Server) handleCmdUdpAssociate(conn net.Conn, buf *[]byte) error {
 	return selector.ProxySelector.SelectPacket(proxy).Invoke(dstConn, "")
 }
 
+func (s *socks5Server) handleCmdBind(conn net.Conn, buf *[]byte, dstAddr, user string) error {
+	defer s.pool.Put(buf)
+
+	ln, expected, err := listenForBind(conn, dstAddr, "tcp")
+	if err != nil {
+		s.handleFail(conn, 0x01)
+		return err
+	}
+	defer ln.Close()
+
+	// +----+-----+-------+------+----------+----------+
+	// |VER | REP |  RSV  | ATYP | BND.ADDR | BND.PORT |
+	// +----+-----+-------+------+----------+----------+
+	// | 1  |  1  | X'00' |  1   | Variable |    2     |
+	// +----+-----+-------+------+----------+----------+
+	reply := func(addr string) error {
+		bindAddr, err := address.ParseAddress(addr, (*buf)[3:])
+		if err != nil {
+			return err
+		}
+		(*buf)[0], (*buf)[1], (*buf)[2] = 0x05, 0x00, 0x00
+		_, err = conn.Write((*buf)[:3+len(bindAddr)])
+		return err
+	}
+
+	// the first reply is the address which the application server connects to
+	if err = reply(ln.Addr().String()); err != nil {
+		return err
+	}
+	inbound, err := acceptForBind(ln, expected)
+	if err != nil {
+		s.handleFail(conn, 0x01)
+		return err
+	}
+	// the second reply is the address of the application server
+	if err = reply(inbound.RemoteAddr().String()); err != nil {
+		inbound.Close()
+		return err
+	}
+	return relayBind(conn, inbound, user)
+}
+
 func (s *socks5Server) handleFail(conn net.Conn, errno byte) {
 	conn.Write([]byte{0x05, errno, 0x00})
 }
+
+// listenForBind listens on the local address of the route to the application server for the BIND command,
+// which is only supported if the connections to the application server are direct.
+// The incoming connections are expected from the returned address if it is valid.
+func listenForBind(conn net.Conn, dstAddr, network string) (net.Listener, netip.Addr, error) {
+	proxy, err := rule.MatchRuler.Select()
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+	if proxy != "" {
+		return nil, netip.Addr{}, errBindThroughProxy
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transport.DefaultDialTimeout)
+	defer cancel()
+	raddr, err := resolver.DefaultResolver.ResolveUDPAddr(ctx, dstAddr)
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+	expected := raddr.AddrPort().Addr().Unmap()
+	// the local address of the control connection is used if the application server is unspecified
+	var localIP string
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		localIP = addr.IP.String()
+	}
+	if !expected.IsUnspecified() {
+		// no packets are sent by the connected udp socket
+		probe, err := net.DialUDP("udp", nil, raddr)
+		if err != nil {
+			return nil, netip.Addr{}, err
+		}
+		localIP = probe.LocalAddr().(*net.UDPAddr).IP.String()
+		probe.Close()
+	}
+	ln, err := net.Listen(network, net.JoinHostPort(localIP, "0"))
+	return ln, expected, err
+}
+
+// acceptForBind accepts the incoming connection from the application server,
+// the connections from the other hosts are rejected
+func acceptForBind(ln net.Listener, expected netip.Addr) (net.Conn, error) {
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(socksBindTimeout))
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		remote := conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr().Unmap()
+		if expected.IsUnspecified() || expected == remote {
+			return conn, nil
+		}
+		logger.Logger.Warnf("socks bind: reject the connection from %s, expected %s", remote, expected)
+		conn.Close()
+	}
+}
+
+func relayBind(conn, inbound net.Conn, user string) error {
+	if statistic.EnableStatistic {
+		tcpTracker := statistic.NewTCPTracker(conn, statistic.Context{
+			Src:     conn.RemoteAddr().String(),
+			Dst:     inbound.RemoteAddr().String(),
+			Network: "TCP",
+			Type:    "SOCKS",
+			Rule:    string(rule.MatchRuler.MatcherResult().RuleType),
+			User:    user,
+		})
+		defer statistic.DefaultManager.Remove(tcpTracker)
+		conn = tcpTracker
+	}
+	return relay.IoCopyBidirectionalForStream(conn, inbound)
+}
@@ -0,0 +1,164 @@
+package ss
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/josexy/mini-ss/connection"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/rule"
+)
+
+const (
+	socks4Version = 0x04
+
+	socks4Granted  = 0x5a
+	socks4Rejected = 0x5b
+	// the user id is not the same as the socks auth username
+	socks4UserIdMismatch = 0x5d
+)
+
+var (
+	errVersion4Invalid   = errors.New("socks version not 0x04")
+	errSocks4FieldLength = errors.New("socks4 user id or domain name too long")
+	errSocks4IPv6Bind    = errors.New("socks4 bind address is not ipv4")
+)
+
+// serveSocks4 handles the SOCKS4 and SOCKS4a requests, the SOCKS4 has no password,
+// so the requests are rejected unless the user id is a socks auth user without password
+func (s *socks5Server) serveSocks4(conn *connection.BufioConn) error {
+	buf := s.pool.Get()
+	defer s.pool.Put(buf)
+
+	// +----+----+----+----+----+----+----+----+----+----+....+----+
+	// | VN | CD | DSTPORT |      DSTIP        | USERID       |NULL|
+	// +----+----+----+----+----+----+----+----+----+----+....+----+
+	// | 1  | 1  |    2    |         4         | variable     | 1  |
+	// +----+----+----+----+----+----+----+----+----+----+....+----+
+	if _, err := io.ReadFull(conn, (*buf)[:8]); err != nil {
+		return err
+	}
+	if (*buf)[0] != socks4Version {
+		return errVersion4Invalid
+	}
+	cmd := (*buf)[1]
+	port := binary.BigEndian.Uint16((*buf)[2:4])
+	ip := netip.AddrFrom4([4]byte((*buf)[4:8]))
+	userId, err := readSocks4String(conn, *buf)
+	if err != nil {
+		return err
+	}
+	host := ip.String()
+	// SOCKS4a: the ip 0.0.0.x (x != 0) is followed by the domain name
+	if b := ip.As4(); b[0] == 0 && b[1] == 0 && b[2] == 0 && b[3] != 0 {
+		if host, err = readSocks4String(conn, *buf); err != nil {
+			return err
+		}
+	}
+
+	// the user id is only trusted if it is authenticated
+	var user string
+	if s.socksAuth != nil {
+		if !s.socksAuth.Validate(userId, "") {
+			s.socks4Reply(conn, socks4UserIdMismatch, netip.AddrPort{})
+			return errAuthFailure
+		}
+		user = userId
+	}
+	// if tun mode is enabled, the host may be a fake ip address
+	if resolver.DefaultResolver.IsEnhancerMode() {
+		if ip, e := netip.ParseAddr(host); e == nil && resolver.DefaultResolver.IsFakeIP(ip) {
+			record, e := resolver.DefaultResolver.FindByIP(ip)
+			if e != nil {
+				s.socks4Reply(conn, socks4Rejected, netip.AddrPort{})
+				return e
+			}
+			host = record.Domain
+		}
+	}
+	if !rule.MatchRuler.Match(&host) {
+		s.socks4Reply(conn, socks4Rejected, netip.AddrPort{})
+		return rule.ErrRuleMatchDropped
+	}
+	dstAddr := net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+
+	switch cmd {
+	case CONNECT:
+		if err = s.socks4Reply(conn, socks4Granted, netip.AddrPort{}); err != nil {
+			return err
+		}
+		s.relayConnect(conn, dstAddr, user)
+		return nil
+	case BIND:
+		return s.handleSocks4Bind(conn, dstAddr, user)
+	default:
+		s.socks4Reply(conn, socks4Rejected, netip.AddrPort{})
+		return errUnsupportedReqCmd
+	}
+}
+
+func (s *socks5Server) handleSocks4Bind(conn net.Conn, dstAddr, user string) error {
+	ln, expected, err := listenForBind(conn, dstAddr, "tcp4")
+	if err != nil {
+		s.socks4Reply(conn, socks4Rejected, netip.AddrPort{})
+		return err
+	}
+	defer ln.Close()
+
+	// the first reply is the address which the application server connects to
+	if err = s.socks4Reply(conn, socks4Granted, ln.Addr().(*net.TCPAddr).AddrPort()); err != nil {
+		return err
+	}
+	inbound, err := acceptForBind(ln, expected)
+	if err != nil {
+		s.socks4Reply(conn, socks4Rejected, netip.AddrPort{})
+		return err
+	}
+	// the second reply is the address of the application server
+	if err = s.socks4Reply(conn, socks4Granted, inbound.RemoteAddr().(*net.TCPAddr).AddrPort()); err != nil {
+		inbound.Close()
+		return err
+	}
+	return relayBind(conn, inbound, user)
+}
+
+// socks4Reply the address is only used by the BIND command
+func (s *socks5Server) socks4Reply(conn net.Conn, code byte, addr netip.AddrPort) error {
+	// +----+----+----+----+----+----+----+----+
+	// | VN | CD | DSTPORT |      DSTIP        |
+	// +----+----+----+----+----+----+----+----+
+	// | 1  | 1  |    2    |         4         |
+	// +----+----+----+----+----+----+----+----+
+	var reply [8]byte
+	reply[1] = code
+	if addr.IsValid() {
+		ip := addr.Addr().Unmap()
+		if !ip.Is4() {
+			return errSocks4IPv6Bind
+		}
+		binary.BigEndian.PutUint16(reply[2:4], addr.Port())
+		ipv4 := ip.As4()
+		copy(reply[4:], ipv4[:])
+	}
+	_, err := conn.Write(reply[:])
+	return err
+}
+
+// readSocks4String reads the null-terminated user id or domain name
+func readSocks4String(r io.ByteReader, buf []byte) (string, error) {
+	for i := 0; i < len(buf); i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0 {
+			return string(buf[:i]), nil
+		}
+		buf[i] = b
+	}
+	return "", errSocks4FieldLength
+}
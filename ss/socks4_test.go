@@ -0,0 +1,242 @@
+package ss
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+// socks4Users the socks4 user ids are validated without password
+type socks4Users map[string]bool
+
+func (u socks4Users) Validate(username, password string) bool { return password == "" && u[username] }
+
+func setMatchRuler(t *testing.T, ruler *rule.Ruler) {
+	old := rule.MatchRuler
+	rule.MatchRuler = ruler
+	t.Cleanup(func() { rule.MatchRuler = old })
+}
+
+// dialSocksServer returns the client side of the connection served by the socks server
+func dialSocksServer(t *testing.T, auth Authenticator) net.Conn {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	s := newSocksProxyServer(ln.Addr().String(), auth)
+	client, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	conn, err := ln.Accept()
+	assert.Nil(t, err)
+	go func() {
+		defer conn.Close()
+		s.ServeTCP(conn)
+	}()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func socks4Request(cmd byte, dst netip.AddrPort, userId, domain string) []byte {
+	req := []byte{socks4Version, cmd}
+	req = binary.BigEndian.AppendUint16(req, dst.Port())
+	ip := dst.Addr().As4()
+	req = append(req, ip[:]...)
+	req = append(req, userId...)
+	req = append(req, 0)
+	if domain != "" {
+		req = append(req, domain...)
+		req = append(req, 0)
+	}
+	return req
+}
+
+func readSocks4Reply(t *testing.T, conn net.Conn) (byte, netip.AddrPort) {
+	var reply [8]byte
+	_, err := io.ReadFull(conn, reply[:])
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0), reply[0])
+	return reply[1], netip.AddrPortFrom(netip.AddrFrom4([4]byte(reply[4:8])), binary.BigEndian.Uint16(reply[2:4]))
+}
+
+func assertConnEcho(t *testing.T, conn net.Conn, payload string) {
+	_, err := conn.Write([]byte(payload))
+	assert.Nil(t, err)
+	buf := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, string(buf))
+}
+
+func TestSocks4Connect(t *testing.T) {
+	setMatchRuler(t, rule.NewRuler(rule.Direct, "", "", nil))
+	echoAddr := netip.MustParseAddrPort(startEchoServer(t))
+
+	tests := []struct {
+		name string
+		req  []byte
+	}{
+		{name: "socks4", req: socks4Request(CONNECT, echoAddr, "", "")},
+		{name: "socks4 with user id", req: socks4Request(CONNECT, echoAddr, "alice", "")},
+		// the ip 0.0.0.x is followed by the domain name
+		{name: "socks4a", req: socks4Request(CONNECT, netip.AddrPortFrom(netip.AddrFrom4([4]byte{0, 0, 0, 1}), echoAddr.Port()), "", "127.0.0.1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialSocksServer(t, nil)
+			_, err := conn.Write(tt.req)
+			assert.Nil(t, err)
+			code, _ := readSocks4Reply(t, conn)
+			assert.Equal(t, byte(socks4Granted), code)
+			assertConnEcho(t, conn, "hello socks4")
+		})
+	}
+}
+
+func TestSocks4UserIdMismatch(t *testing.T) {
+	setMatchRuler(t, rule.NewRuler(rule.Direct, "", "", nil))
+	echoAddr := netip.MustParseAddrPort(startEchoServer(t))
+	users := socks4Users{"alice": true}
+
+	conn := dialSocksServer(t, users)
+	conn.Write(socks4Request(CONNECT, echoAddr, "bob", ""))
+	code, _ := readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4UserIdMismatch), code)
+	// the connection is closed after the rejection
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	conn = dialSocksServer(t, users)
+	conn.Write(socks4Request(CONNECT, echoAddr, "alice", ""))
+	code, _ = readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4Granted), code)
+	assertConnEcho(t, conn, "hello alice")
+}
+
+func TestSocks4Bind(t *testing.T) {
+	setMatchRuler(t, rule.NewRuler(rule.Direct, "", "", nil))
+	conn := dialSocksServer(t, nil)
+	// the application server is 127.0.0.1
+	conn.Write(socks4Request(BIND, netip.MustParseAddrPort("127.0.0.1:21"), "", ""))
+
+	// the first reply is the address which the application server connects to
+	code, bindAddr := readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4Granted), code)
+	assert.Equal(t, "127.0.0.1", bindAddr.Addr().String())
+	assert.NotZero(t, bindAddr.Port())
+
+	inbound, err := net.Dial("tcp", bindAddr.String())
+	assert.Nil(t, err)
+	defer inbound.Close()
+
+	// the second reply is the address of the application server
+	code, peerAddr := readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4Granted), code)
+	assert.Equal(t, inbound.LocalAddr().String(), peerAddr.String())
+
+	inbound.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("from client"))
+	buf := make([]byte, len("from client"))
+	_, err = io.ReadFull(inbound, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "from client", string(buf))
+	inbound.Write([]byte("from server"))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "from server", string(buf))
+}
+
+func TestSocks4BindRejectUnexpectedPeer(t *testing.T) {
+	setMatchRuler(t, rule.NewRuler(rule.Direct, "", "", nil))
+	conn := dialSocksServer(t, nil)
+	// the application server is 127.0.0.2, which is routed through the loopback interface
+	conn.Write(socks4Request(BIND, netip.MustParseAddrPort("127.0.0.2:21"), "", ""))
+	code, bindAddr := readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4Granted), code)
+
+	// the connection from 127.0.0.1 is rejected
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}}
+	unexpected, err := dialer.Dial("tcp", bindAddr.String())
+	assert.Nil(t, err)
+	defer unexpected.Close()
+	unexpected.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = unexpected.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	dialer = net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}}
+	inbound, err := dialer.Dial("tcp", bindAddr.String())
+	assert.Nil(t, err)
+	defer inbound.Close()
+	code, peerAddr := readSocks4Reply(t, conn)
+	assert.Equal(t, byte(socks4Granted), code)
+	assert.Equal(t, inbound.LocalAddr().String(), peerAddr.String())
+}
+
+func TestSocksBindThroughProxy(t *testing.T) {
+	// the global mode always selects the proxy node
+	setMatchRuler(t, rule.NewRuler(rule.Global, "", "node", nil))
+
+	t.Run("socks4", func(t *testing.T) {
+		conn := dialSocksServer(t, nil)
+		conn.Write(socks4Request(BIND, netip.MustParseAddrPort("127.0.0.1:21"), "", ""))
+		code, _ := readSocks4Reply(t, conn)
+		assert.Equal(t, byte(socks4Rejected), code)
+	})
+
+	t.Run("socks5", func(t *testing.T) {
+		conn := dialSocksServer(t, nil)
+		conn.Write([]byte{0x05, 0x01, 0x00})
+		method := make([]byte, 2)
+		_, err := io.ReadFull(conn, method)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x05, 0x00}, method)
+
+		addr, err := address.ParseAddress("127.0.0.1:21", make([]byte, 259))
+		assert.Nil(t, err)
+		conn.Write(append([]byte{0x05, BIND, 0x00}, addr...))
+		reply := make([]byte, 3)
+		_, err = io.ReadFull(conn, reply)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x05, 0x01, 0x00}, reply)
+	})
+}
+
+func TestSocks5Bind(t *testing.T) {
+	setMatchRuler(t, rule.NewRuler(rule.Direct, "", "", nil))
+	conn := dialSocksServer(t, nil)
+	conn.Write([]byte{0x05, 0x01, 0x00})
+	io.ReadFull(conn, make([]byte, 2))
+	addr, err := address.ParseAddress("127.0.0.1:21", make([]byte, 259))
+	assert.Nil(t, err)
+	conn.Write(append([]byte{0x05, BIND, 0x00}, addr...))
+
+	readReply := func() string {
+		header := make([]byte, 3)
+		_, err := io.ReadFull(conn, header)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x05, 0x00, 0x00}, header)
+		bindAddr, err := address.ParseAddressFromReader(conn, make([]byte, 259))
+		assert.Nil(t, err)
+		return bindAddr.String()
+	}
+	bindAddr := readReply()
+	inbound, err := net.Dial("tcp", bindAddr)
+	assert.Nil(t, err)
+	defer inbound.Close()
+	assert.Equal(t, inbound.LocalAddr().String(), readReply())
+
+	inbound.SetDeadline(time.Now().Add(5 * time.Second))
+	inbound.Write([]byte("from server"))
+	buf := make([]byte, len("from server"))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "from server", string(buf))
+}
@@ -1,6 +1,7 @@
 package ss
 
 import (
+	"crypto/tls"
 	"net"
 	"net/netip"
 	"net/url"
@@ -12,6 +13,8 @@ import (
 	"github.com/josexy/mini-ss/enhancer"
 	"github.com/josexy/mini-ss/geoip"
 	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/plugin"
+	"github.com/josexy/mini-ss/relay"
 	"github.com/josexy/mini-ss/resolver"
 	"github.com/josexy/mini-ss/rule"
 	"github.com/josexy/mini-ss/selector"
@@ -37,6 +40,8 @@ var defaultSSLocalOpts = ssOptions{
 type ShadowsocksClient struct {
 	srvGroup *server.ServerGroup
 	enhancer *enhancer.Enhancer
+	plugins  []*plugin.Plugin
+	users    *UserStore
 	Opts     ssOptions
 }
 
@@ -66,25 +71,53 @@ func NewShadowsocksClient(opts ...SSOption) *ShadowsocksClient {
 		rule.MatchRuler.GlobalTo = "<Default>"
 	}
 
+	for i := range s.Opts.serverOpts {
+		p, err := attachPlugin(&s.Opts.serverOpts[i])
+		if err != nil {
+			logger.Logger.FatalBy(err)
+		}
+		if p != nil {
+			s.plugins = append(s.plugins, p)
+		}
+	}
+	chain := newDialerChain(s.Opts.serverOpts)
 	for _, opt := range s.Opts.serverOpts {
-		s.initServerOption(&opt)
+		s.initServerOption(&opt, chain)
 	}
 	// create simple tcp tun server
 	for _, addrs := range s.Opts.localOpts.tcpTunAddr {
 		s.srvGroup.AddServer(newTcpTunServer(addrs[0], addrs[1]))
 	}
+	// transparent proxy
+	if s.Opts.localOpts.redirAddr != "" {
+		s.srvGroup.AddServer(newRedirServer(s.Opts.localOpts.redirAddr))
+	}
+	if s.Opts.localOpts.tproxyAddr != "" {
+		s.srvGroup.AddServer(newTProxyServer(s.Opts.localOpts.tproxyAddr))
+		s.srvGroup.AddServer(newTProxyUDPServer(s.Opts.localOpts.tproxyAddr))
+	}
+
+	// the inbound users replace the SOCKS and HTTP user info
+	if len(s.Opts.localOpts.users) > 0 || s.Opts.localOpts.usersFile != "" {
+		var err error
+		if s.users, err = NewUserStore(s.Opts.localOpts.users, s.Opts.localOpts.usersFile); err != nil {
+			logger.Logger.FatalBy(err)
+		}
+		logger.Logger.Infof("load %d inbound users", s.users.Len())
+	}
+	httpAuth, socksAuth := s.authenticator(s.Opts.localOpts.httpAuth), s.authenticator(s.Opts.localOpts.socksAuth)
 
 	// enable mixed proxy
 	if s.Opts.localOpts.mixedAddr != "" {
-		s.srvGroup.AddServer(newMixedServer(s.Opts.localOpts.mixedAddr, s.Opts.localOpts.httpAuth, s.Opts.localOpts.socksAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
+		s.srvGroup.AddServer(newMixedServer(s.Opts.localOpts.mixedAddr, httpAuth, socksAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
 	} else {
 		if s.Opts.localOpts.httpAddr != "" {
 			// http proxy
-			s.srvGroup.AddServer(newHttpProxyServer(s.Opts.localOpts.httpAddr, s.Opts.localOpts.httpAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
+			s.srvGroup.AddServer(newHttpProxyServer(s.Opts.localOpts.httpAddr, httpAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
 		}
 		if s.Opts.localOpts.socksAddr != "" {
 			// socks proxy
-			s.srvGroup.AddServer(newSocksProxyServer(s.Opts.localOpts.socksAddr, s.Opts.localOpts.socksAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
+			s.srvGroup.AddServer(newSocksProxyServer(s.Opts.localOpts.socksAddr, socksAuth).WithMitmMode(s.Opts.localOpts.mitmConfig))
 		}
 	}
 
@@ -94,37 +127,86 @@ func NewShadowsocksClient(opts ...SSOption) *ShadowsocksClient {
 	return s
 }
 
-func (ss *ShadowsocksClient) initServerOption(opt *serverOptions) {
+func makeClientConnBound(opt *serverOptions, forward transport.Dialer) (transport.TcpConnBound, transport.UdpConnBound, error) {
+	if opt.trojan != nil {
+		return makeTrojanConn(opt, forward)
+	}
 	sc, ac, err := cipher.GetCipher(opt.method, opt.password)
 	if err != nil {
-		logger.Logger.FatalBy(err)
+		return nil, nil, err
 	}
-	var tcpBound transport.TcpConnBound
-	var udpBound transport.UdpConnBound
-
 	// whether to support shadowsocksr
 	if !opt.ssr {
-		tcpBound = makeStreamConn(sc, ac)
-		udpBound = makePacketConn(sc, ac)
-	} else {
-		cp, err := ssr.NewSSRClientStreamCipher(sc,
-			opt.addr,                                      // host,port
-			opt.ssrOpt.Protocol, opt.ssrOpt.ProtocolParam, // protocol,protocol-param
-			opt.ssrOpt.Obfs, opt.ssrOpt.ObfsParam) // obfs,obfs-param
+		return makeStreamConn(sc, ac), makePacketConn(sc, ac), nil
+	}
+	cp, err := ssr.NewSSRClientStreamCipher(sc,
+		opt.addr,                                      // host,port
+		opt.ssrOpt.Protocol, opt.ssrOpt.ProtocolParam, // protocol,protocol-param
+		opt.ssrOpt.Obfs, opt.ssrOpt.ObfsParam) // obfs,obfs-param
+	if err != nil {
+		return nil, nil, err
+	}
+	return makeSSRClientStreamConn(cp), makeSSRClientPacketConn(cp), nil
+}
 
-		if err != nil {
-			logger.Logger.FatalBy(err)
-		}
+func muxEnabled(opt *serverOptions) bool {
+	return opt.mux != nil && opt.trojan == nil && muxSupported(opt.transport)
+}
 
-		tcpBound = makeSSRClientStreamConn(cp)
-		udpBound = makeSSRClientPacketConn(cp)
+func (ss *ShadowsocksClient) initServerOption(opt *serverOptions, chain *dialerChain) {
+	if opt.upstream != nil {
+		if opt.dialerProxy != "" || len(opt.chain) > 0 {
+			logger.Logger.Fatalf("dialer proxy is not supported by the upstream proxy %q", opt.name)
+		}
+		if opt.bind != nil {
+			logger.Logger.Warnf("outbound bind is not supported by the upstream proxy %q", opt.name)
+		}
+		ss.initUpstreamOption(opt)
+		return
+	}
+	if opt.plugin != "" && (opt.dialerProxy != "" || len(opt.chain) > 0) {
+		logger.Logger.Fatalf("dialer proxy is not supported since %q is dialed through the plugin", opt.name)
+	}
+	forward, err := chain.forward(opt)
+	if err != nil {
+		logger.Logger.FatalBy(err)
+	}
+	if forward != nil && !opt.transport.Forwardable() {
+		logger.Logger.Fatalf("%s transport of %q can not be dialed through another node", opt.transport.String(), opt.name)
+	}
+	if opt.bind != nil && !opt.transport.Bindable() {
+		logger.Logger.Fatalf("%s transport of %q does not support the outbound bind", opt.transport.String(), opt.name)
+	}
+	tcpBound, udpBound, err := makeClientConnBound(opt, forward)
+	if err != nil {
+		logger.Logger.FatalBy(err)
 	}
 	item := ctxv.V{
-		Addr:         opt.addr,
+		Addr:         opt.tcpAddr(),
 		Options:      opt.opts,
 		Type:         opt.transport,
 		TcpConnBound: tcpBound,
 		UdpConnBound: udpBound,
+		Forward:      forward,
+		Bind:         opt.bind,
+	}
+	if opt.mux != nil {
+		if muxEnabled(opt) {
+			item.Mux = opt.mux
+		} else if opt.trojan != nil {
+			logger.Logger.Warn("mux is not supported by trojan")
+		} else {
+			logger.Logger.Warnf("mux is not supported by the %s transport", opt.transport.String())
+		}
+	}
+	if opt.udp && opt.trojan == nil {
+		item.PacketDialer = transport.NewPacketDialer(opt.transport, opt.opts)
+	}
+	// the udp packets are sent to the proxy server directly except trojan
+	udp := opt.udp
+	if udp && forward != nil && opt.trojan == nil {
+		logger.Logger.Warnf("udp relay is disabled since %q is dialed through another node", opt.name)
+		udp = false
 	}
 	logger.Logger.Debug("add proxy",
 		logx.String("name", opt.name),
@@ -132,14 +214,73 @@ func (ss *ShadowsocksClient) initServerOption(opt *serverOptions) {
 		logx.String("transport", opt.transport.String()),
 		logx.String("method", opt.method),
 		logx.String("password", opt.password),
-		logx.Bool("udp", opt.udp),
+		logx.Bool("udp", udp),
+		logx.Bool("mux", item.Mux != nil),
+		logx.Bool("chained", forward != nil),
+		logx.String("plugin", opt.plugin),
 	)
 	selector.ProxySelector.AddProxy(opt.name, item)
-	if opt.udp {
+	if udp {
+		// the udp packets are sent to the proxy server directly without the plugin
+		if item.PacketDialer == nil {
+			item.Addr = opt.addr
+		}
 		selector.ProxySelector.AddPacketProxy(opt.name, item)
 	}
 }
 
+func newUpstreamTCPRelayer(opt *serverOptions) (*relay.UpstreamTCPRelayer, error) {
+	auth, tlsConfig, err := upstreamAuth(opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.upstream.Type == "http" {
+		return relay.NewHttpTCPRelayer(opt.addr, auth, tlsConfig), nil
+	}
+	return relay.NewSocks5TCPRelayer(opt.addr, auth, tlsConfig), nil
+}
+
+func upstreamAuth(opt *serverOptions) (*url.Userinfo, *tls.Config, error) {
+	tlsConfig, err := opt.upstream.GetClientTlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tlsConfig != nil && tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(opt.addr)
+	}
+	var auth *url.Userinfo
+	if opt.upstream.Username != "" || opt.password != "" {
+		auth = url.UserPassword(opt.upstream.Username, opt.password)
+	}
+	return auth, tlsConfig, nil
+}
+
+func (ss *ShadowsocksClient) initUpstreamOption(opt *serverOptions) {
+	relayer, err := newUpstreamTCPRelayer(opt)
+	if err != nil {
+		logger.Logger.FatalBy(err)
+	}
+	logger.Logger.Debug("add upstream proxy",
+		logx.String("name", opt.name),
+		logx.String("addr", opt.addr),
+		logx.String("type", opt.upstream.Type),
+		logx.Bool("tls", opt.upstream.Mode != options.None),
+		logx.Bool("udp", opt.udp),
+	)
+	selector.ProxySelector.AddProxyInvoker(opt.name, selector.StreamInvokerFunc(relayer.RelayToProxyServer))
+	if !opt.udp {
+		return
+	}
+	switch opt.upstream.Type {
+	case "socks5":
+		auth, tlsConfig, _ := upstreamAuth(opt)
+		selector.ProxySelector.AddPacketProxyInvoker(opt.name, selector.PacketInvokerFunc(
+			relay.NewSocks5UDPRelayer(opt.addr, auth, tlsConfig).RelayToProxyServer))
+	case "http":
+		logger.Logger.Warnf("udp relay is not supported by the http proxy %q", opt.name)
+	}
+}
+
 func (ss *ShadowsocksClient) setSystemProxy() {
 
 	var http, socks *url.URL
@@ -178,6 +319,29 @@ func (ss *ShadowsocksClient) setSystemProxy() {
 	}
 }
 
+// authenticator returns nil if the authentication is disabled, the nil *Auth must not be converted to the non-nil interface
+func (ss *ShadowsocksClient) authenticator(auth *Auth) Authenticator {
+	if ss.users != nil {
+		return ss.users
+	}
+	if auth != nil {
+		return auth
+	}
+	return nil
+}
+
+// ReloadUsers reloads the inbound users from the users file
+func (ss *ShadowsocksClient) ReloadUsers() error {
+	if ss.users == nil {
+		return nil
+	}
+	if err := ss.users.Reload(); err != nil {
+		return err
+	}
+	logger.Logger.Infof("reload %d inbound users", ss.users.Len())
+	return nil
+}
+
 func (ss *ShadowsocksClient) initEnhancer() error {
 	if ss.Opts.localOpts.enableTun {
 		return ss.enhancer.Start()
@@ -196,7 +360,11 @@ func (ss *ShadowsocksClient) Start() error {
 	if ss.srvGroup.Len() == 0 {
 		return nil
 	}
+	if err := startPlugins(ss.plugins); err != nil {
+		return err
+	}
 	if err := ss.initEnhancer(); err != nil {
+		closePlugins(ss.plugins)
 		return err
 	}
 	if ss.Opts.localOpts.systemProxy {
@@ -205,6 +373,7 @@ func (ss *ShadowsocksClient) Start() error {
 	if err := ss.srvGroup.Start(); err != nil {
 		proxyutil.UnsetSystemProxy()
 		ss.closeEnhancer()
+		closePlugins(ss.plugins)
 		return err
 	}
 	return nil
@@ -222,6 +391,7 @@ func (ss *ShadowsocksClient) Close() error {
 	if ss.Opts.localOpts.enableTun {
 		_ = ss.enhancer.Close()
 	}
+	defer closePlugins(ss.plugins)
 	if err := ss.srvGroup.Close(); err != nil {
 		return err
 	}
@@ -1,12 +1,15 @@
 package ss
 
 import (
+	"errors"
 	"net"
 
 	"github.com/josexy/cropstun/route"
 	"github.com/josexy/logx"
 	"github.com/josexy/mini-ss/cipher"
+	"github.com/josexy/mini-ss/mux"
 	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/plugin"
 	"github.com/josexy/mini-ss/relay"
 	"github.com/josexy/mini-ss/resolver"
 	"github.com/josexy/mini-ss/server"
@@ -16,8 +19,11 @@ import (
 
 var defaultSSServerOpts = ssOptions{}
 
+var errUpstreamOnlyClient = errors.New("the upstream socks5 and http proxies are only supported by the client")
+
 type ShadowsocksServer struct {
 	handlerList []*serverHandler
+	plugins     []*plugin.Plugin
 	srvGroup    *server.ServerGroup
 	Opts        ssOptions
 }
@@ -33,8 +39,15 @@ func NewShadowsocksServer(opts ...SSOption) *ShadowsocksServer {
 	if len(s.Opts.serverOpts) == 0 {
 		logger.Logger.Fatal("ss-server need configuration")
 	}
-	resolver.DefaultResolver = resolver.NewDnsResolver(nil, false)
 	for _, opt := range s.Opts.serverOpts {
+		p, err := attachPlugin(&opt)
+		if err != nil {
+			logger.Logger.Error("init plugin failed", logx.Error("error", err))
+			continue
+		}
+		if p != nil {
+			s.plugins = append(s.plugins, p)
+		}
 		if err := s.initServerHandler(&opt); err != nil {
 			logger.Logger.Error("init server failed", logx.Error("error", err))
 		}
@@ -46,34 +59,59 @@ func NewShadowsocksServer(opts ...SSOption) *ShadowsocksServer {
 			logger.Logger.Infof("auto detect outbound interface: %s", defaultRoute.InterfaceName)
 		}
 	}
+	// the sockets of the nameservers are bound to the outbound interface and routing mark
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, false)
 	return s
 }
 
+func (ss *ShadowsocksServer) addServer(opt *serverOptions, handler server.Handler) error {
+	srv, err := server.New(opt.transport, opt.tcpAddr(), handler, opt.opts)
+	if err != nil {
+		return err
+	}
+	ss.srvGroup.AddServer(srv)
+	return nil
+}
+
 func (ss *ShadowsocksServer) initServerHandler(opt *serverOptions) error {
+	if opt.upstream != nil {
+		return errUpstreamOnlyClient
+	}
+	if opt.trojan != nil {
+		if opt.mux != nil {
+			logger.Logger.Warn("mux is not supported by trojan")
+		}
+		handler, err := newTrojanHandler(opt)
+		if err != nil {
+			return err
+		}
+		return ss.addServer(opt, handler)
+	}
+
 	sc, ac, err := cipher.GetCipher(opt.method, opt.password)
 	if err != nil {
 		return err
 	}
 
 	handler := &serverHandler{}
-	switch opt.transport {
-	case transport.Tcp:
-		ss.srvGroup.AddServer(server.NewTcpServer(opt.addr, handler, server.Tcp))
-	case transport.Websocket:
-		ss.srvGroup.AddServer(server.NewWsServer(opt.addr, handler, opt.opts))
-	case transport.Quic:
-		ss.srvGroup.AddServer(server.NewQuicServer(opt.addr, handler, opt.opts))
-	case transport.Obfs:
-		ss.srvGroup.AddServer(server.NewObfsServer(opt.addr, handler, opt.opts))
-	case transport.Grpc:
-		ss.srvGroup.AddServer(server.NewGrpcServer(opt.addr, handler, opt.opts))
-	case transport.Ssh:
-		ss.srvGroup.AddServer(server.NewSshServer(opt.addr, handler, opt.opts))
-	default:
+	if opt.udp && opt.transport == transport.Quic && opt.opts.(*options.QuicOptions).Datagram {
+		// the udp packets are relayed over the quic datagrams instead of the plain udp relayer,
+		// which can't listen on the same port as the quic server
+		handler.packetBound = makePacketConn(sc, ac)
+	}
+	if opt.mux != nil {
+		if muxSupported(opt.transport) {
+			handler.mux = opt.mux
+		} else {
+			logger.Logger.Warnf("mux is not supported by the %s transport", opt.transport.String())
+		}
+	}
+	if err = ss.addServer(opt, handler); err != nil {
+		return err
 	}
 
 	handler.tcpRelayer = relay.NewProxyTCPRelayer("", transport.Tcp, options.DefaultOptions, makeStreamConn(sc, ac), nil)
-	if opt.udp {
+	if opt.udp && handler.packetBound == nil {
 		handler.udpRelayer = &udpRelayer{
 			addr:    opt.addr,
 			relayer: relay.NewNatmapUDPRelayer(makePacketConn(sc, ac), nil),
@@ -88,6 +126,9 @@ func (ss *ShadowsocksServer) Start() error {
 		return nil
 	}
 
+	if err := startPlugins(ss.plugins); err != nil {
+		return err
+	}
 	for _, handler := range ss.handlerList {
 		// whether enable start udp relayer
 		if handler.udpRelayer != nil {
@@ -96,6 +137,7 @@ func (ss *ShadowsocksServer) Start() error {
 	}
 
 	if err := ss.srvGroup.Start(); err != nil {
+		closePlugins(ss.plugins)
 		return err
 	}
 
@@ -106,6 +148,7 @@ func (ss *ShadowsocksServer) Close() error {
 	if ss.srvGroup.Len() == 0 {
 		return nil
 	}
+	defer closePlugins(ss.plugins)
 	if err := ss.srvGroup.Close(); err != nil {
 		return err
 	}
@@ -115,6 +158,51 @@ func (ss *ShadowsocksServer) Close() error {
 type serverHandler struct {
 	tcpRelayer *relay.ProxyTCPRelayer
 	udpRelayer *udpRelayer
+	// accept both the mux and the plain connections if not nil
+	mux *options.MuxOptions
+	// the udp packets over the quic datagrams if not nil
+	packetBound transport.UdpConnBound
+}
+
+// muxSupported the transports which are not multiplexed natively
+func muxSupported(typ transport.Type) bool {
+	return typ == transport.Tcp || typ == transport.Websocket || typ == transport.Obfs || typ == transport.Kcp
+}
+
+// serveMux relays the streams of the mux connection, and the plain connection as usual.
+// The mux session is carried by the decrypted stream, so the preface is detected after decryption
+func (h *serverHandler) serveMux(conn net.Conn) {
+	conn, ok, err := mux.Detect(h.tcpRelayer.WrapInbound(conn))
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
+	if !ok {
+		if err = h.tcpRelayer.RelayInboundToServer(conn); err != nil {
+			logger.Logger.ErrorBy(err)
+		}
+		return
+	}
+	config := mux.DefaultConfig
+	if h.mux.KeepAliveInterval > 0 {
+		config.KeepAliveInterval = h.mux.KeepAliveInterval
+	}
+	if h.mux.KeepAliveTimeout > 0 {
+		config.KeepAliveTimeout = h.mux.KeepAliveTimeout
+	}
+	sess := mux.Server(conn, config)
+	defer sess.Close()
+	for {
+		stream, err := sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			if err := h.tcpRelayer.RelayInboundToServer(stream); err != nil {
+				logger.Logger.ErrorBy(err)
+			}
+		}()
+	}
 }
 
 func (h *serverHandler) ServeQUIC(conn net.Conn) {
@@ -123,19 +211,51 @@ func (h *serverHandler) ServeQUIC(conn net.Conn) {
 	}
 }
 
+// ServeQUICPacket relays the udp sessions of the quic connection, each connection has its own nat map
+func (h *serverHandler) ServeQUICPacket(conn net.PacketConn) {
+	if h.packetBound == nil {
+		return
+	}
+	if err := relay.NewNatmapUDPRelayer(h.packetBound, nil).RelayToServer(conn); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
+
+func (h *serverHandler) ServeKCP(conn net.Conn) {
+	if h.mux != nil {
+		h.serveMux(conn)
+		return
+	}
+	if err := h.tcpRelayer.RelayToServer(conn); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
+
 func (h *serverHandler) ServeOBFS(conn net.Conn) {
+	if h.mux != nil {
+		h.serveMux(conn)
+		return
+	}
 	if err := h.tcpRelayer.RelayToServer(conn); err != nil {
 		logger.Logger.ErrorBy(err)
 	}
 }
 
 func (h *serverHandler) ServeWS(conn net.Conn) {
+	if h.mux != nil {
+		h.serveMux(conn)
+		return
+	}
 	if err := h.tcpRelayer.RelayToServer(conn); err != nil {
 		logger.Logger.ErrorBy(err)
 	}
 }
 
 func (h *serverHandler) ServeTCP(conn net.Conn) {
+	if h.mux != nil {
+		h.serveMux(conn)
+		return
+	}
 	if err := h.tcpRelayer.RelayToServer(conn); err != nil {
 		logger.Logger.ErrorBy(err)
 	}
@@ -153,6 +273,12 @@ func (h *serverHandler) ServeSSH(conn net.Conn) {
 	}
 }
 
+func (h *serverHandler) ServeHTTP2(conn net.Conn) {
+	if err := h.tcpRelayer.RelayToServer(conn); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
+
 type udpRelayer struct {
 	addr    string
 	relayer *relay.NatmapUDPRelayer
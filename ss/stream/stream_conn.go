@@ -8,6 +8,7 @@ import (
 
 	"github.com/josexy/mini-ss/bufferpool"
 	cipherx "github.com/josexy/mini-ss/cipher"
+	"github.com/josexy/mini-ss/connection"
 )
 
 type streamReader struct {
@@ -164,14 +165,12 @@ func (c *StreamConn) initWriter() error {
 	if err != nil {
 		return err
 	}
-	if _, err := c.Conn.Write(iv); err != nil {
-		return err
-	}
 	cp, err := c.cipher.GetEncrypter(iv)
 	if err != nil {
 		return err
 	}
-	c.w = newStreamWriter(c.Conn, cp)
+	// the iv is sent with the first payload
+	c.w = newStreamWriter(connection.NewConnWithPrefix(c.Conn, iv), cp)
 	return nil
 }
 
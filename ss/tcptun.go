@@ -21,7 +21,7 @@ func newTcpTunServer(localAddr, remoteAddr string) server.Server {
 		addr:       localAddr,
 		RemoteAddr: remoteAddr,
 	}
-	tts.Server = server.NewTcpServer(localAddr, tts, server.SimpleTcpTun)
+	tts.Server = server.NewTcpServer(localAddr, tts, server.SimpleTcpTun, nil)
 	return tts
 }
 
@@ -0,0 +1,292 @@
+package ss
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/rule"
+	"github.com/josexy/mini-ss/selector"
+	"github.com/josexy/mini-ss/server"
+	"github.com/josexy/mini-ss/statistic"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+// tproxyServer accepts the tcp connections of the iptables or nftables TPROXY rules (linux-only),
+// the local address of the accepted connection is its original destination
+type tproxyServer struct {
+	server.Server
+	addr string
+}
+
+func newTProxyServer(addr string) *tproxyServer {
+	ts := &tproxyServer{addr: addr}
+	ts.Server = server.NewTcpServer(addr, ts, server.TProxy, &options.TcpOptions{Transparent: true})
+	return ts
+}
+
+func (ts *tproxyServer) ServeTCP(conn net.Conn) {
+	dst, err := netip.ParseAddrPort(conn.LocalAddr().String())
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
+	relayTransparentTCP(conn, netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port()), "TPROXY")
+}
+
+var _ server.Server = (*tproxyUDPServer)(nil)
+
+// tproxyUDPPool the packets are read into the pooled buffers, which are put back once read by the flows
+var tproxyUDPPool = bufferpool.NewBufferPool(bufferpool.MaxUdpBufferSize)
+
+// tproxyUDPServer receives the udp packets of the TPROXY rules, the packets are relayed by the flows
+// of the source and the original destination, and the replies are sent from the original destination.
+// The listener only receives the first packets of a flow until the flow connects its own socket.
+type tproxyUDPServer struct {
+	addr    string
+	conn    *net.UDPConn
+	running atomic.Bool
+	flows   sync.Map
+	// the matched rule is shared by the global ruler, so the flows are matched one at a time
+	ruleMu sync.Mutex
+}
+
+func newTProxyUDPServer(addr string) *tproxyUDPServer {
+	return &tproxyUDPServer{addr: addr}
+}
+
+func (s *tproxyUDPServer) LocalAddr() string { return s.addr }
+
+func (s *tproxyUDPServer) Type() server.ServerType { return server.TProxy }
+
+func (s *tproxyUDPServer) Serve(*server.Conn) {}
+
+func (s *tproxyUDPServer) Start(ctx context.Context) error {
+	if s.running.Load() {
+		return server.ErrServerStarted
+	}
+	conn, err := transport.ListenTProxyUDP(ctx, s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.running.Store(true)
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	oob := make([]byte, 1024)
+	for {
+		buf := tproxyUDPPool.Get()
+		n, src, dst, err := transport.ReadFromTProxyUDP(conn, *buf, oob)
+		if err != nil {
+			tproxyUDPPool.Put(buf)
+			if !s.running.Load() || errors.Is(err, net.ErrClosed) {
+				break
+			}
+			logger.Logger.ErrorBy(err)
+			continue
+		}
+		data := tproxyPacket{buf: buf, n: n}
+
+		key := src.String() + "-" + dst.String()
+		if flow, ok := s.flows.Load(key); ok {
+			flow.(*tproxyPacketConn).deliver(data)
+			continue
+		}
+		flow, err := newTProxyPacketConn(ctx, src, dst)
+		if err != nil {
+			tproxyUDPPool.Put(buf)
+			logger.Logger.ErrorBy(err)
+			continue
+		}
+		s.flows.Store(key, flow)
+		flow.deliver(data)
+		go s.serveFlow(key, flow, dst)
+	}
+	return nil
+}
+
+func (s *tproxyUDPServer) matchRule(remote *string) (proxy string, ruleType rule.RuleType, ok bool) {
+	s.ruleMu.Lock()
+	defer s.ruleMu.Unlock()
+	if !rule.MatchRuler.Match(remote) {
+		return
+	}
+	proxy, err := rule.MatchRuler.Select()
+	if err != nil {
+		logger.Logger.ErrorBy(err)
+		return
+	}
+	return proxy, rule.MatchRuler.MatcherResult().RuleType, true
+}
+
+func (s *tproxyUDPServer) serveFlow(key string, conn *tproxyPacketConn, dst netip.AddrPort) {
+	defer func() {
+		s.flows.Delete(key)
+		conn.Close()
+	}()
+
+	remote := dst.Addr().String()
+	// the destination may be a fake ip address if the fake dns is enabled
+	if resolver.DefaultResolver.IsEnhancerMode() && resolver.DefaultResolver.IsFakeIP(dst.Addr()) {
+		record, err := resolver.DefaultResolver.FindByIP(dst.Addr())
+		if err != nil {
+			logger.Logger.ErrorBy(err)
+			return
+		}
+		remote = record.Domain
+	}
+	proxy, ruleType, ok := s.matchRule(&remote)
+	if !ok {
+		return
+	}
+	// the replies are still sent from the original destination
+	target := net.JoinHostPort(remote, strconv.FormatUint(uint64(dst.Port()), 10))
+	var pc net.PacketConn = conn
+	if statistic.EnableStatistic {
+		udpTracker := statistic.NewUDPTracker(pc, statistic.Context{
+			Src:     conn.src.String(),
+			Dst:     target,
+			Network: "UDP",
+			Type:    "TPROXY",
+			Rule:    string(ruleType),
+			Proxy:   proxy,
+		})
+		defer statistic.DefaultManager.Remove(udpTracker)
+		pc = udpTracker
+	}
+	if err := selector.ProxySelector.SelectPacket(proxy).Invoke(pc, target); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
+
+func (s *tproxyUDPServer) Close() error {
+	if !s.running.Load() {
+		return server.ErrServerClosed
+	}
+	s.running.Store(false)
+	err := s.conn.Close()
+	s.flows.Range(func(_, value any) bool {
+		value.(*tproxyPacketConn).Close()
+		return true
+	})
+	return err
+}
+
+var _ net.PacketConn = (*tproxyPacketConn)(nil)
+
+// tproxyPacket the packet of the pooled buffer
+type tproxyPacket struct {
+	buf *[]byte
+	n   int
+}
+
+// tproxyPacketConn the udp flow of the source and the original destination, the packets are read from
+// the tproxy server and the connected socket, and the replies are sent from the original destination
+type tproxyPacketConn struct {
+	*net.UDPConn
+	src      *net.UDPAddr
+	ch       chan tproxyPacket
+	done     chan struct{}
+	once     sync.Once
+	deadline atomic.Value // time.Time
+}
+
+func newTProxyPacketConn(ctx context.Context, src, dst netip.AddrPort) (*tproxyPacketConn, error) {
+	conn, err := transport.DialTransparentUDP(ctx, dst, src)
+	if err != nil {
+		return nil, err
+	}
+	c := &tproxyPacketConn{
+		UDPConn: conn,
+		src:     net.UDPAddrFromAddrPort(src),
+		ch:      make(chan tproxyPacket, 128),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// readLoop delivers the packets received by the connected socket
+func (c *tproxyPacketConn) readLoop() {
+	for {
+		buf := tproxyUDPPool.Get()
+		n, err := c.UDPConn.Read(*buf)
+		if err != nil {
+			tproxyUDPPool.Put(buf)
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			// the icmp errors of the connected socket are ignored
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		c.deliver(tproxyPacket{buf: buf, n: n})
+	}
+}
+
+func (c *tproxyPacketConn) deliver(p tproxyPacket) {
+	select {
+	case c.ch <- p:
+	case <-c.done:
+		tproxyUDPPool.Put(p.buf)
+	default:
+		// drop the packet if the flow is too slow
+		tproxyUDPPool.Put(p.buf)
+	}
+}
+
+func (c *tproxyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	var timeout <-chan time.Time
+	if deadline, ok := c.deadline.Load().(time.Time); ok && !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p := <-c.ch:
+		n := copy(b, (*p.buf)[:p.n])
+		tproxyUDPPool.Put(p.buf)
+		return n, c.src, nil
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *tproxyPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.UDPConn.Write(b)
+}
+
+func (c *tproxyPacketConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.UDPConn.Close()
+	})
+	return err
+}
+
+func (c *tproxyPacketConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *tproxyPacketConn) SetReadDeadline(t time.Time) error {
+	c.deadline.Store(t)
+	return nil
+}
@@ -0,0 +1,133 @@
+package ss
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/rule"
+	"github.com/josexy/mini-ss/selector"
+	"github.com/stretchr/testify/assert"
+)
+
+const netnsEnv = "MINI_SS_TEST_NETNS"
+
+// runInNetns runs the test in a new network namespace where it has CAP_NET_ADMIN,
+// it returns true in the namespace after the setup commands of ip are executed
+func runInNetns(t *testing.T, setup ...string) bool {
+	if os.Getenv(netnsEnv) == "1" {
+		for _, args := range setup {
+			if out, err := exec.Command("ip", strings.Fields(args)...).CombinedOutput(); err != nil {
+				t.Fatalf("ip %s: %v: %s", args, err, out)
+			}
+		}
+		return true
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip is required to setup the network namespace")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.v")
+	cmd.Env = append(os.Environ(), netnsEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Skipf("network namespace is unavailable: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("test in network namespace failed: %v\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), "--- SKIP") {
+		t.Skip(out.String())
+	}
+	return false
+}
+
+func TestTProxyUDPFlows(t *testing.T) {
+	// the fake destinations are local addresses, so the packets are received by the transparent sockets
+	if !runInNetns(t, "link set lo up", "route add local 198.18.0.0/16 dev lo") {
+		return
+	}
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	setMatchRuler(t, rule.NewRuler(rule.Global, "", "flow-echo", nil))
+
+	// the proxy node echoes the packets with the target of the flow
+	var mu sync.Mutex
+	var targets []string
+	selector.ProxySelector.AddPacketProxyInvoker("flow-echo", selector.PacketInvokerFunc(func(pc net.PacketConn, target string) error {
+		mu.Lock()
+		targets = append(targets, target)
+		mu.Unlock()
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return err
+			}
+			pc.WriteTo(append([]byte(target+"|"), buf[:n]...), addr)
+		}
+	}))
+
+	pc, err := net.ListenPacket("udp", ":0")
+	assert.Nil(t, err)
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+	srv := newTProxyUDPServer(":" + strconv.Itoa(port))
+	go srv.Start(context.Background())
+	assert.Eventually(t, srv.running.Load, time.Second, 10*time.Millisecond)
+	defer srv.Close()
+
+	newClient := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.Nil(t, err)
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	assertReply := func(client *net.UDPConn, dst netip.AddrPort, payload string) {
+		_, err := client.WriteToUDPAddrPort([]byte(payload), dst)
+		assert.Nil(t, err)
+		buf := make([]byte, 2048)
+		n, from, err := client.ReadFromUDPAddrPort(buf)
+		if !assert.Nil(t, err) {
+			return
+		}
+		// the reply is sent from the original destination
+		assert.Equal(t, dst, netip.AddrPortFrom(from.Addr().Unmap(), from.Port()))
+		assert.Equal(t, dst.String()+"|"+payload, string(buf[:n]))
+	}
+
+	dst1 := netip.AddrPortFrom(netip.MustParseAddr("198.18.0.1"), uint16(port))
+	dst2 := netip.AddrPortFrom(netip.MustParseAddr("198.18.0.2"), uint16(port))
+	clientA, clientB := newClient(), newClient()
+	// the following packets of a flow are received by its connected socket
+	for i := 0; i < 3; i++ {
+		assertReply(clientA, dst1, "a"+strconv.Itoa(i))
+		assertReply(clientB, dst1, "b"+strconv.Itoa(i))
+		assertReply(clientB, dst2, "b"+strconv.Itoa(i))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{dst1.String(), dst1.String(), dst2.String()}, targets)
+	var flows int
+	srv.flows.Range(func(_, _ any) bool {
+		flows++
+		return true
+	})
+	assert.Equal(t, 3, flows)
+}
@@ -0,0 +1,241 @@
+package ss
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/josexy/logx"
+	"github.com/josexy/mini-ss/address"
+	"github.com/josexy/mini-ss/bufferpool"
+	"github.com/josexy/mini-ss/relay"
+	"github.com/josexy/mini-ss/transport"
+	"github.com/josexy/mini-ss/trojan"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+const (
+	trojanHandshakeTimeout = 5 * time.Second
+	trojanUdpTimeout       = 60 * time.Second
+)
+
+var (
+	trojanAddrPool   = bufferpool.NewBufferPool(bufferpool.MaxAddressBufferSize)
+	trojanPacketPool = bufferpool.NewBufferPool(bufferpool.MaxUdpBufferSize)
+
+	errTrojanUdpDisabled = errors.New("trojan: udp relay disabled")
+)
+
+// trojanServerAddr the address of the packets read from the trojan proxy server
+type trojanServerAddr string
+
+func (a trojanServerAddr) Network() string { return "udp" }
+
+func (a trojanServerAddr) String() string { return string(a) }
+
+func makeTrojanConn(opt *serverOptions, forward transport.Dialer) (transport.TcpConnBound, transport.UdpConnBound, error) {
+	tlsConfig, err := opt.trojan.GetClientTlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := opt.addr
+	if tlsConfig != nil && tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	hash := trojan.Hash(opt.password)
+	wrapTLS := func(c net.Conn) net.Conn {
+		if tlsConfig != nil {
+			return tls.Client(c, tlsConfig)
+		}
+		return c
+	}
+
+	tcpBound := transport.TcpConnBoundHandler(func(c net.Conn) net.Conn {
+		return trojan.NewClientConn(wrapTLS(c), hash)
+	})
+	// the udp packets are relayed over a new stream connection with the same transport
+	dialer, err := transport.NewDialerWithForward(opt.transport, opt.opts, forward)
+	if err != nil {
+		return nil, nil, err
+	}
+	udpBound := transport.UdpConnBoundHandler(func(c net.PacketConn) net.PacketConn {
+		return trojan.NewClientPacketConn(c, trojanServerAddr(addr), hash, func(ctx context.Context) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, transport.DefaultDialTimeout)
+			defer cancel()
+			conn, err := dialer.Dial(ctx, opt.tcpAddr())
+			if err != nil {
+				return nil, err
+			}
+			return wrapTLS(conn), nil
+		})
+	})
+	return tcpBound, udpBound, nil
+}
+
+type trojanHandler struct {
+	hash      []byte
+	tlsConfig *tls.Config
+	fallback  string
+	udp       bool
+}
+
+func newTrojanHandler(opt *serverOptions) (*trojanHandler, error) {
+	tlsConfig, err := opt.trojan.GetServerTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &trojanHandler{
+		hash:      trojan.Hash(opt.password),
+		tlsConfig: tlsConfig,
+		fallback:  opt.trojan.Fallback,
+		udp:       opt.udp,
+	}, nil
+}
+
+func (h *trojanHandler) ServeTCP(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeWS(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeOBFS(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeQUIC(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeGRPC(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeSSH(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeHTTP2(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) ServeKCP(conn net.Conn) { h.serve(conn) }
+
+func (h *trojanHandler) serve(conn net.Conn) {
+	if err := h.relay(conn); err != nil {
+		logger.Logger.ErrorBy(err)
+	}
+}
+
+func (h *trojanHandler) relay(conn net.Conn) error {
+	if h.tlsConfig != nil {
+		conn = tls.Server(conn, h.tlsConfig)
+	}
+	// record the bytes read during the handshake, which are replayed to the fallback backend
+	var record bytes.Buffer
+	buf := trojanAddrPool.Get()
+	defer trojanAddrPool.Put(buf)
+	conn.SetReadDeadline(time.Now().Add(trojanHandshakeTimeout))
+	cmd, addr, err := trojan.ReadRequest(io.TeeReader(conn, &record), h.hash, *buf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		if record.Len() == 0 || h.fallback == "" {
+			return err
+		}
+		return h.relayToFallback(conn, record.Bytes(), err)
+	}
+
+	switch cmd {
+	case trojan.CmdConnect:
+		return h.relayStream(conn, addr.String())
+	case trojan.CmdUDPAssociate:
+		if !h.udp {
+			return errTrojanUdpDisabled
+		}
+		return h.relayPacket(conn)
+	}
+	return trojan.ErrInvalidRequest
+}
+
+func (h *trojanHandler) relayToFallback(conn net.Conn, head []byte, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transport.DefaultDialTimeout)
+	defer cancel()
+	dstConn, err := transport.DialTCP(ctx, h.fallback)
+	if err != nil {
+		return err
+	}
+	if _, err = dstConn.Write(head); err != nil {
+		dstConn.Close()
+		return err
+	}
+	logger.Logger.Debug("trojan-fallback",
+		logx.Any("client", conn.RemoteAddr()),
+		logx.String("fallback", h.fallback),
+		logx.Error("cause", cause),
+	)
+	return relay.IoCopyBidirectionalForStream(dstConn, conn)
+}
+
+func (h *trojanHandler) relayStream(conn net.Conn, remoteAddr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transport.DefaultDialTimeout)
+	defer cancel()
+	dstConn, err := transport.DialTCP(ctx, remoteAddr)
+	if err != nil {
+		return err
+	}
+	logger.Logger.Info("trojan-relay",
+		logx.Any("client", conn.RemoteAddr()),
+		logx.Any("relayer", conn.LocalAddr()),
+		logx.String("remote", remoteAddr),
+	)
+	return relay.IoCopyBidirectionalForStream(dstConn, conn)
+}
+
+func (h *trojanHandler) relayPacket(conn net.Conn) error {
+	pc, err := transport.ListenLocalUDP(context.Background())
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	defer conn.Close()
+
+	logger.Logger.Info("trojan-udp-relay",
+		logx.Any("client", conn.RemoteAddr()),
+		logx.Any("relayer", conn.LocalAddr()),
+	)
+
+	errCh := make(chan error, 2)
+	// client -> conn -> pc -> target
+	go func() {
+		buf := trojanPacketPool.Get()
+		defer trojanPacketPool.Put(buf)
+		for {
+			conn.SetReadDeadline(time.Now().Add(trojanUdpTimeout))
+			addr, n, err := trojan.ReadPacket(conn, *buf)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			targetAddr, err := net.ResolveUDPAddr("udp", addr.String())
+			if err != nil {
+				continue
+			}
+			pc.WriteTo((*buf)[len(addr):n], targetAddr)
+		}
+	}()
+	// target -> pc -> conn -> client
+	go func() {
+		buf := trojanPacketPool.Get()
+		defer trojanPacketPool.Put(buf)
+		abuf := trojanAddrPool.Get()
+		defer trojanAddrPool.Put(abuf)
+		for {
+			pc.SetReadDeadline(time.Now().Add(trojanUdpTimeout))
+			n, src, err := pc.ReadFrom(*buf)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			addr, err := address.ParseAddress(src.String(), *abuf)
+			if err != nil {
+				continue
+			}
+			if err = trojan.WritePacket(conn, addr, (*buf)[:n]); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	return <-errCh
+}
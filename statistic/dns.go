@@ -0,0 +1,96 @@
+package statistic
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDnsQueryLogSize the max number of the dns queries kept in the query log
+const DefaultDnsQueryLogSize = 1024
+
+var DefaultDnsManager = NewDnsManager(DefaultDnsQueryLogSize)
+
+type DnsQuery struct {
+	Time     time.Time     `json:"time"`
+	Source   string        `json:"source"`   // query source ['dns', 'lookup']
+	Name     string        `json:"name"`     // query domain name
+	Qtype    string        `json:"qtype"`    // query type
+	Upstream string        `json:"upstream"` // the nameserver which answered, or ['static-hosts', 'hosts-file', 'fake-ip']
+	Latency  time.Duration `json:"latency"`
+	Rcode    string        `json:"rcode"`
+	FakeIP   bool          `json:"fake_ip"` // whether a fake ip address was returned
+	Answers  []string      `json:"answers"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type DnsSnapshot struct {
+	Total   int64       `json:"total"`
+	Failed  int64       `json:"failed"`
+	FakeIP  int64       `json:"fake_ip"`
+	Queries []*DnsQuery `json:"queries"` // the recent queries, from oldest to newest
+}
+
+// DnsManager records the recent dns queries in a bounded ring buffer with aggregate counters
+type DnsManager struct {
+	mu      sync.Mutex
+	queries []*DnsQuery
+	next    int
+	full    bool
+	total   atomic.Int64
+	failed  atomic.Int64
+	fakeIP  atomic.Int64
+}
+
+func NewDnsManager(size int) *DnsManager {
+	if size <= 0 {
+		size = 1
+	}
+	return &DnsManager{queries: make([]*DnsQuery, size)}
+}
+
+func (manager *DnsManager) Add(query *DnsQuery) {
+	if query == nil {
+		return
+	}
+	manager.total.Add(1)
+	if query.Error != "" {
+		manager.failed.Add(1)
+	}
+	if query.FakeIP {
+		manager.fakeIP.Add(1)
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.queries[manager.next] = query
+	manager.next = (manager.next + 1) % len(manager.queries)
+	if manager.next == 0 {
+		manager.full = true
+	}
+}
+
+func (manager *DnsManager) Reset() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	clear(manager.queries)
+	manager.next = 0
+	manager.full = false
+	manager.total.Store(0)
+	manager.failed.Store(0)
+	manager.fakeIP.Store(0)
+}
+
+func (manager *DnsManager) DumpSnapshot() DnsSnapshot {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	snapshot := DnsSnapshot{
+		Total:  manager.total.Load(),
+		Failed: manager.failed.Load(),
+		FakeIP: manager.fakeIP.Load(),
+	}
+	if manager.full {
+		snapshot.Queries = append(snapshot.Queries, manager.queries[manager.next:]...)
+	}
+	snapshot.Queries = append(snapshot.Queries, manager.queries[:manager.next]...)
+	return snapshot
+}
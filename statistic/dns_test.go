@@ -0,0 +1,37 @@
+package statistic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDnsManager(t *testing.T) {
+	manager := NewDnsManager(3)
+	assert.Empty(t, manager.DumpSnapshot().Queries)
+
+	names := []string{"a.com", "b.com", "c.com", "d.com", "e.com"}
+	for i, name := range names {
+		query := &DnsQuery{Name: name, FakeIP: i%2 == 0}
+		if name == "b.com" {
+			query.Error = "timeout"
+		}
+		manager.Add(query)
+	}
+
+	snapshot := manager.DumpSnapshot()
+	assert.Equal(t, int64(5), snapshot.Total)
+	assert.Equal(t, int64(1), snapshot.Failed)
+	assert.Equal(t, int64(3), snapshot.FakeIP)
+	var got []string
+	for _, query := range snapshot.Queries {
+		got = append(got, query.Name)
+	}
+	// the oldest queries are dropped
+	assert.Equal(t, []string{"c.com", "d.com", "e.com"}, got)
+
+	manager.Reset()
+	snapshot = manager.DumpSnapshot()
+	assert.Zero(t, snapshot.Total)
+	assert.Empty(t, snapshot.Queries)
+}
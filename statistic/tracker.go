@@ -15,6 +15,7 @@ type Context struct {
 	Type          string       `json:"type"`    // connection type ['socks', 'http', 'tcp-tun', 'udp-tun', 'simple-tcp-tun']
 	Rule          string       `json:"rule"`    // matched rule type
 	Proxy         string       `json:"proxy"`   // matched proxy
+	User          string       `json:"user"`    // authenticated inbound username
 	downloadTotal atomic.Int64 // download
 	uploadTotal   atomic.Int64 // upload
 }
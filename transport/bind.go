@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/sockopt"
+)
+
+var errBindUnsupported = errors.New("unsupported transport dialer type for binding")
+
+// binder the dialers whose outbound sockets can be bound to the specified interface, source ip and routing mark
+type binder interface{ setBind(*options.BindOptions) }
+
+// SetDialerBind binds the outbound sockets of the dialer, the global options are used if opts is nil
+func SetDialerBind(d Dialer, opts *options.BindOptions) error {
+	if opts == nil {
+		return nil
+	}
+	bd, ok := d.(binder)
+	if !ok {
+		return errBindUnsupported
+	}
+	bd.setBind(opts)
+	return nil
+}
+
+// ListenUDPWithBind create an unconnected udp connection with the specified local addr and bind options
+func ListenUDPWithBind(ctx context.Context, addr string, opts *options.BindOptions) (net.PacketConn, error) {
+	b := sockopt.NewBind(opts)
+	var lc net.ListenConfig
+	if b.Empty() {
+		return lc.ListenPacket(ctx, "udp", addr)
+	}
+	addr, err := b.SetupListenConfig(&lc, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return lc.ListenPacket(ctx, b.Network("udp"), addr)
+}
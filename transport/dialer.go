@@ -2,10 +2,10 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"net"
 	"time"
 
-	"github.com/josexy/cropstun/bind"
 	"github.com/josexy/mini-ss/options"
 )
 
@@ -16,6 +16,8 @@ const (
 	Obfs
 	Grpc
 	Ssh
+	Http2
+	Kcp
 )
 
 const DefaultDialTimeout = 10 * time.Second
@@ -23,47 +25,78 @@ const DefaultDialTimeout = 10 * time.Second
 type Type uint8
 
 func (t Type) String() string {
-	switch t {
-	case Tcp:
-		return "tcp"
-	case Quic:
-		return "quic"
-	case Websocket:
-		return "websocket"
-	case Obfs:
-		return "obfs"
-	case Grpc:
-		return "grpc"
-	case Ssh:
-		return "ssh"
-	default:
-		return "unknown"
+	if entry, ok := lookup(t); ok {
+		return entry.name
 	}
+	return "unknown"
 }
 
 type Dialer interface {
 	Dial(context.Context, string) (net.Conn, error)
 }
 
-func NewDialer(tr Type, opt options.Options) Dialer {
-	var dialer Dialer
-	switch tr {
-	case Tcp:
-		dialer = new(tcpDialer)
-	case Websocket:
-		dialer = newWSDialer(opt)
-	case Quic:
-		dialer = newQUICDialer(opt)
-	case Grpc:
-		dialer = newGRPCDialer(opt)
-	case Ssh:
-		dialer = newSSHDialer(opt)
-	case Obfs:
-		dialer = newOBFSDialer(opt)
-	default:
-		panic("unsupported transport dialer type")
+// PacketDialer the dialers which relay the udp packets over the transport connections
+type PacketDialer interface {
+	Dialer
+	ListenPacket(context.Context, string) (net.PacketConn, error)
+}
+
+type DialFunc func(context.Context, string) (net.Conn, error)
+
+func (f DialFunc) Dial(ctx context.Context, addr string) (net.Conn, error) { return f(ctx, addr) }
+
+// forwarder the dialers which dial the underlying tcp connections with tcpDialer
+type forwarder interface{ setForward(Dialer) }
+
+// Forwardable reports whether the transport can be dialed through another proxy node
+func (t Type) Forwardable() bool {
+	entry, ok := lookup(t)
+	return ok && entry.forwardable
+}
+
+// Bindable reports whether the outbound sockets of the transport can be bound
+func (t Type) Bindable() bool {
+	entry, ok := lookup(t)
+	return ok && entry.bindable
+}
+
+var (
+	errUnsupportedDialer  = errors.New("unsupported transport dialer type")
+	errUnsupportedForward = errors.New("unsupported transport dialer type for forwarding")
+)
+
+func NewDialer(tr Type, opt options.Options) (Dialer, error) {
+	entry, ok := lookup(tr)
+	if !ok {
+		return nil, errUnsupportedDialer
 	}
-	return dialer
+	return entry.newDialer(opt), nil
+}
+
+// NewPacketDialer returns nil if the transport does not carry the udp packets,
+// only the quic transport with the datagram enabled is supported
+func NewPacketDialer(tr Type, opt options.Options) PacketDialer {
+	if tr != Quic {
+		return nil
+	}
+	if opts, ok := opt.(*options.QuicOptions); !ok || !opts.Datagram {
+		return nil
+	}
+	return newQUICDialer(opt)
+}
+
+// NewDialerWithForward the underlying tcp connections of the dialer are established through the forward dialer
+func NewDialerWithForward(tr Type, opt options.Options, forward Dialer) (Dialer, error) {
+	dialer, err := NewDialer(tr, opt)
+	if err != nil || forward == nil {
+		return dialer, err
+	}
+	fd, ok := dialer.(forwarder)
+	if !ok {
+		return nil, errUnsupportedForward
+	}
+	fd.setForward(forward)
+	return dialer, nil
 }
 
 func DialTCP(ctx context.Context, addr string) (net.Conn, error) {
@@ -73,15 +106,7 @@ func DialTCP(ctx context.Context, addr string) (net.Conn, error) {
 
 // ListenUDP create an unconnected udp connection with the specified local addr
 func ListenUDP(ctx context.Context, addr string) (net.PacketConn, error) {
-	if options.DefaultOptions.OutboundInterface == "" {
-		return (&net.ListenConfig{}).ListenPacket(ctx, "udp", addr)
-	}
-	var lc net.ListenConfig
-	addr, err := bind.BindToDeviceForPacket(options.DefaultOptions.OutboundInterface, &lc, "udp", addr)
-	if err != nil {
-		return nil, err
-	}
-	return lc.ListenPacket(ctx, "udp", addr)
+	return ListenUDPWithBind(ctx, addr, nil)
 }
 
 // ListenLocalUDP create an unconnected udp connection with random local addr
@@ -5,7 +5,6 @@ import (
 	"net"
 
 	"github.com/josexy/mini-ss/connection"
-	"github.com/josexy/mini-ss/connection/proto"
 	"github.com/josexy/mini-ss/options"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -18,8 +17,18 @@ type grpcDialer struct {
 	err      error
 	dialOpts []grpc.DialOption
 	opts     *options.GrpcOptions
+	cpool    *connPool[*grpcConn]
+	// the full method name of the stream
+	method string
 }
 
+type grpcConn struct {
+	idx int
+	*grpc.ClientConn
+}
+
+var grpcStreamDesc = &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+
 func newGRPCDialer(opt options.Options) *grpcDialer {
 	opt.Update()
 	grpcOpts := opt.(*options.GrpcOptions)
@@ -32,16 +41,26 @@ func newGRPCDialer(opt options.Options) *grpcDialer {
 	if grpcOpts.RevBuffer > 0 {
 		dialOpts = append(dialOpts, grpc.WithReadBufferSize(grpcOpts.RevBuffer))
 	}
-	callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	// the gun service of Xray doesn't support the compression
+	if grpcOpts.ServiceName == "" {
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
 
 	cred := insecure.NewCredentials()
 	tlsConfig, err := grpcOpts.TlsOptions.GetClientTlsConfig()
 	if tlsConfig != nil {
 		cred = credentials.NewTLS(tlsConfig)
 	}
+	service, tun, tunMulti := connection.GrpcServiceMethods(grpcOpts.ServiceName)
+	method := "/" + service + "/" + tun
+	if grpcOpts.Multi {
+		method = "/" + service + "/" + tunMulti
+	}
 	grpcDialer := &grpcDialer{
-		err:  err,
-		opts: grpcOpts,
+		err:    err,
+		opts:   grpcOpts,
+		cpool:  newConnPool[*grpcConn](grpcOpts.Conns),
+		method: method,
 	}
 	dialOpts = append(dialOpts,
 		grpc.WithDefaultCallOptions(callOpts...),
@@ -52,18 +71,51 @@ func newGRPCDialer(opt options.Options) *grpcDialer {
 	return grpcDialer
 }
 
+func (d *grpcDialer) dial(ctx context.Context, addr string, idx int) (*grpcConn, error) {
+	conn, err := grpc.DialContext(ctx, addr, d.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcConn{idx: idx, ClientConn: conn}, nil
+}
+
+// Dial the streams are opened on the pooled grpc connections
 func (d *grpcDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
 	if d.err != nil {
 		return nil, d.err
 	}
-	conn, err := grpc.DialContext(ctx, addr, d.dialOpts...)
+	conn, err := d.cpool.getConn(ctx, addr, d.dial)
 	if err != nil {
 		return nil, err
 	}
-	client := proto.NewStreamServiceClient(conn)
-	cStream, err := client.Transfer(ctx)
+	cStream, cancel, err := d.newStream(ctx, conn)
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// reset the connection slot and retry once
+		d.cpool.close(conn.idx, func(c *grpcConn) error { return c.Close() })
+		if conn, err = d.cpool.getConnWithIndex(ctx, addr, conn.idx, false, d.dial); err != nil {
+			return nil, err
+		}
+		if cStream, cancel, err = d.newStream(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	return connection.NewGrpcClientStreamConn(cStream, cancel, d.opts.Multi), nil
+}
+
+// newStream the stream outlives the dial context, which only limits the time to open the stream
+func (d *grpcDialer) newStream(ctx context.Context, conn *grpcConn) (grpc.ClientStream, context.CancelFunc, error) {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancel)
+	cStream, err := conn.NewStream(streamCtx, grpcStreamDesc, d.method)
+	if !stop() || err != nil {
+		cancel()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, nil, err
 	}
-	return connection.NewGrpcClientStreamConn(cStream, conn), nil
+	return cStream, cancel, nil
 }
@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+)
+
+// ConnAttemptDelay the delay between starting the connection attempts to the next addresses (RFC 8305)
+var ConnAttemptDelay = 250 * time.Millisecond
+
+// sortAddrs interleaves the address families starting with the preferred one
+func sortAddrs(ipv4, ipv6 []netip.Addr, pref options.IPPreference) []netip.Addr {
+	primary, fallback := ipv6, ipv4
+	if pref == options.PreferIPv4 {
+		primary, fallback = ipv4, ipv6
+	}
+	addrs := make([]netip.Addr, 0, len(primary)+len(fallback))
+	for i := 0; i < len(primary) || i < len(fallback); i++ {
+		if i < len(primary) {
+			addrs = append(addrs, primary[i])
+		}
+		if i < len(fallback) {
+			addrs = append(addrs, fallback[i])
+		}
+	}
+	return addrs
+}
+
+type dialAddrFunc func(context.Context, netip.Addr) (net.Conn, error)
+
+// dialParallel races the connection attempts to the addresses in order, the next attempt is started
+// once the previous one fails or ConnAttemptDelay elapses. The losers are canceled once one succeeds.
+func dialParallel(ctx context.Context, addrs []netip.Addr, dial dialAddrFunc) (net.Conn, error) {
+	if len(addrs) == 1 {
+		return dial(ctx, addrs[0])
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		net.Conn
+		error
+	}
+	results := make(chan dialResult)
+	returned := make(chan struct{})
+	defer close(returned)
+
+	startRacer := func(addr netip.Addr) {
+		conn, err := dial(ctx, addr)
+		select {
+		case results <- dialResult{Conn: conn, error: err}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	timer := time.NewTimer(ConnAttemptDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	next, pending := 0, 0
+	for {
+		if next < len(addrs) {
+			go startRacer(addrs[next])
+			next++
+			pending++
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(ConnAttemptDelay)
+		}
+		select {
+		case res := <-results:
+			pending--
+			if res.error == nil {
+				return res.Conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.error
+			}
+			if pending == 0 && next == len(addrs) {
+				return nil, firstErr
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
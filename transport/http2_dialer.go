@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+
+	"github.com/josexy/mini-ss/connection"
+	"github.com/josexy/mini-ss/options"
+	"golang.org/x/net/http2"
+)
+
+var errHttp2UnexpectedStatus = errors.New("http2: unexpected response status")
+
+type http2Dialer struct {
+	tcpDialer
+	err       error
+	tlsConfig *tls.Config
+	opts      *options.Http2Options
+	transport *http2.Transport
+}
+
+func newHTTP2Dialer(opt options.Options) *http2Dialer {
+	opt.Update()
+	h2Opts := opt.(*options.Http2Options)
+	tlsConfig, err := h2Opts.GetClientTlsConfig()
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	}
+	h2Dialer := &http2Dialer{
+		err:       err,
+		opts:      h2Opts,
+		tlsConfig: tlsConfig,
+	}
+	// all the streams to the same server share a single connection
+	h2Dialer.transport = &http2.Transport{
+		AllowHTTP:          tlsConfig == nil, // h2c
+		DisableCompression: true,
+		TLSClientConfig:    tlsConfig,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := h2Dialer.tcpDialer.Dial(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			// the tls config is always provided even for h2c
+			if h2Dialer.tlsConfig == nil {
+				return conn, nil
+			}
+			tlsConn := tls.Client(conn, cfg)
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+	}
+	return h2Dialer
+}
+
+func (d *http2Dialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	scheme := "http"
+	if d.tlsConfig != nil {
+		scheme = "https"
+	}
+	urls := &url.URL{Scheme: scheme, Host: addr, Path: d.opts.Path}
+	if d.opts.Method == http.MethodConnect {
+		urls = &url.URL{Scheme: scheme, Host: addr}
+	}
+
+	// the stream must outlive the dial context
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	var laddr, raddr net.Addr
+	streamCtx = httptrace.WithClientTrace(streamCtx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			laddr, raddr = info.Conn.LocalAddr(), info.Conn.RemoteAddr()
+		},
+	})
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(streamCtx, d.opts.Method, urls.String(), pr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.URL = urls
+	req.Host = d.opts.Host
+	if req.Host == "" {
+		req.Host = addr
+	}
+	req.ContentLength = -1
+	rsp, err := d.transport.RoundTrip(req)
+	if err != nil {
+		cancel()
+		pw.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		rsp.Body.Close()
+		cancel()
+		pw.Close()
+		return nil, fmt.Errorf("%w: %s", errHttp2UnexpectedStatus, rsp.Status)
+	}
+	return connection.NewHttp2ClientConn(rsp.Body, pw, cancel, laddr, raddr), nil
+}
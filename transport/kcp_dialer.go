@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/xtaci/kcp-go/v5"
+)
+
+type kcpDialer struct {
+	opts *options.KcpOptions
+	bind *options.BindOptions
+}
+
+func newKCPDialer(opt options.Options) *kcpDialer {
+	return &kcpDialer{opts: opt.(*options.KcpOptions)}
+}
+
+// SetupKcpSession applies the options to the kcp session, both sides must use the same mtu and fec shards.
+// The kcp packets are not encrypted by kcp, since the payload is encrypted by the cipher of shadowsocks
+func SetupKcpSession(sess *kcp.UDPSession, opts *options.KcpOptions) {
+	nodelay, nc := 0, 0
+	if opts.NoDelay {
+		nodelay = 1
+	}
+	if opts.NoCongestion {
+		nc = 1
+	}
+	sess.SetStreamMode(true)
+	sess.SetWriteDelay(false)
+	// send the acks back as soon as possible
+	sess.SetACKNoDelay(true)
+	if opts.Mtu > 0 {
+		sess.SetMtu(opts.Mtu)
+	}
+	sess.SetWindowSize(opts.SndWnd, opts.RcvWnd)
+	sess.SetNoDelay(nodelay, int(opts.Interval/time.Millisecond), opts.Resend, nc)
+}
+
+func (d *kcpDialer) setBind(bind *options.BindOptions) { d.bind = bind }
+
+// Dial each connection is a kcp session over a new udp socket
+func (d *kcpDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	raddr, err := resolver.DefaultResolver.ResolveUDPAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ListenUDPWithBind(ctx, "", d.bind)
+	if err != nil {
+		return nil, err
+	}
+	var conv [4]byte
+	rand.Read(conv[:])
+	// the session owns the udp socket
+	sess, err := kcp.NewConn4(binary.LittleEndian.Uint32(conv[:]), raddr, nil, d.opts.DataShards, d.opts.ParityShards, true, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	SetupKcpSession(sess, d.opts)
+	return sess, nil
+}
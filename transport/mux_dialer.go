@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/josexy/mini-ss/mux"
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/util/logger"
+)
+
+type muxSession struct {
+	*mux.Session
+	idx int
+}
+
+type muxDialer struct {
+	Dialer
+	opts   *options.MuxOptions
+	config mux.Config
+	cpool  *connPool[*muxSession]
+}
+
+// NewMuxDialer opens the streams over the physical connections dialed by the dialer
+func NewMuxDialer(dialer Dialer, opt options.Options) Dialer {
+	opt.Update()
+	muxOpts := opt.(*options.MuxOptions)
+	config := mux.DefaultConfig
+	if muxOpts.KeepAliveInterval > 0 {
+		config.KeepAliveInterval = muxOpts.KeepAliveInterval
+	}
+	if muxOpts.KeepAliveTimeout > 0 {
+		config.KeepAliveTimeout = muxOpts.KeepAliveTimeout
+	}
+	return &muxDialer{
+		Dialer: dialer,
+		opts:   muxOpts,
+		config: config,
+		cpool:  newConnPool[*muxSession](muxOpts.Conns),
+	}
+}
+
+func (d *muxDialer) dial(ctx context.Context, addr string, idx int) (*muxSession, error) {
+	conn, err := d.Dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := mux.Client(conn, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	logger.Logger.Tracef("mux new session for conn: %s, idx:[%d]", conn.LocalAddr(), idx)
+	return &muxSession{Session: sess, idx: idx}, nil
+}
+
+func (d *muxDialer) isFull(sess *muxSession) bool {
+	return d.opts.MaxStreams > 0 && sess.NumStreams() >= d.opts.MaxStreams
+}
+
+func (d *muxDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	sess, err := d.cpool.getConn(ctx, addr, d.dial)
+	if err != nil {
+		return nil, err
+	}
+	// prefer the other sessions in the pool if the session is full
+	for i := 1; i < d.cpool.size && d.isFull(sess); i++ {
+		if sess, err = d.cpool.getConn(ctx, addr, d.dial); err != nil {
+			return nil, err
+		}
+	}
+	var fails, retries = 0, 1
+	for {
+		var stream *mux.Stream
+		if stream, err = sess.OpenStream(); err == nil {
+			return stream, nil
+		}
+		if fails >= retries {
+			return nil, err
+		}
+		// Reset the broken session slot and dial again
+		d.cpool.close(sess.idx, func(s *muxSession) error { return s.Close() })
+		if sess, err = d.cpool.getConnWithIndex(ctx, addr, sess.idx, false, d.dial); err != nil {
+			return nil, err
+		}
+		fails++
+	}
+}
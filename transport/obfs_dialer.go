@@ -24,5 +24,8 @@ func (d *obfsDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	if d.opts.Mode == options.ObfsTLS {
+		return connection.NewObfsTlsConn(conn, d.opts.Host, false), nil
+	}
 	return connection.NewObfsConn(conn, d.opts.Host, false), nil
 }
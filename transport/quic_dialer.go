@@ -4,6 +4,10 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/josexy/mini-ss/connection"
@@ -13,10 +17,64 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
+// quicMigrateInterval how often the local address which routes to the server is checked for the migration
+var quicMigrateInterval = 5 * time.Second
+
 type quicConn struct {
 	addr string
 	idx  int
 	quic.EarlyConnection
+	raddr *net.UDPAddr
+	// the transports of the current and the previous paths, they are closed with the connection
+	mu         sync.Mutex
+	transports []*quic.Transport
+	// the udp sessions over the quic datagrams
+	sessions  sync.Map
+	sessionID atomic.Uint32
+	recvOnce  sync.Once
+}
+
+func (c *quicConn) addTransport(tr *quic.Transport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transports = append(c.transports, tr)
+}
+
+// closeTransports closes the udp sockets of all the paths after the connection is closed,
+// the previous paths can't be closed before since the transport closes its connections
+func (c *quicConn) closeTransports() {
+	<-c.Context().Done()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tr := range c.transports {
+		closeQuicTransport(tr)
+	}
+	c.transports = nil
+}
+
+// receiveDatagrams dispatches the quic datagrams to the udp sessions until the connection is closed
+func (c *quicConn) receiveDatagrams() {
+	defer c.sessions.Range(func(_, value any) bool {
+		value.(*quicDatagramConn).Close()
+		return true
+	})
+	connection.ReceiveQuicDatagrams(c.EarlyConnection, func(id uint32, payload []byte) {
+		if session, ok := c.sessions.Load(id); ok {
+			session.(*quicDatagramConn).deliver(payload)
+		}
+	})
+}
+
+func (c *quicConn) newDatagramSession() *quicDatagramConn {
+	c.recvOnce.Do(func() { go c.receiveDatagrams() })
+	session := &quicDatagramConn{
+		conn: c,
+		id:   c.sessionID.Add(1),
+		ch:   make(chan []byte, 128),
+		done: make(chan struct{}),
+	}
+	c.sessions.Store(session.id, session)
+	return session
 }
 
 type quicDialer struct {
@@ -24,6 +82,7 @@ type quicDialer struct {
 	tlsConfig *tls.Config
 	cpool     *connPool[*quicConn]
 	opts      *options.QuicOptions
+	bind      *options.BindOptions
 }
 
 func TlsConfigQuicALPN(config *tls.Config) *tls.Config {
@@ -48,28 +107,124 @@ func newQUICDialer(opt options.Options) *quicDialer {
 	}
 }
 
-func (d *quicDialer) dial(ctx context.Context, addr string) (quic.EarlyConnection, error) {
+// QuicConfig the quic config shared by the client and the server
+func QuicConfig(opts *options.QuicOptions) *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:           opts.HandshakeIdleTimeout,
+		KeepAlivePeriod:                opts.KeepAlivePeriod,
+		MaxIdleTimeout:                 opts.MaxIdleTimeout,
+		InitialStreamReceiveWindow:     opts.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         opts.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: opts.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     opts.MaxConnectionReceiveWindow,
+		EnableDatagrams:                opts.Datagram,
+		MaxIncomingStreams:             1 << 32,
+		MaxIncomingUniStreams:          1 << 32,
+		Versions: []quic.Version{
+			quic.Version1,
+			quic.Version2,
+		},
+	}
+}
+
+func (d *quicDialer) setBind(bind *options.BindOptions) { d.bind = bind }
+
+func (d *quicDialer) newTransport(ctx context.Context) (*quic.Transport, error) {
+	conn, err := ListenUDPWithBind(ctx, "", d.bind)
+	if err != nil {
+		return nil, err
+	}
+	return &quic.Transport{Conn: conn}, nil
+}
+
+func closeQuicTransport(tr *quic.Transport) {
+	tr.Close()
+	tr.Conn.Close()
+}
+
+func (d *quicDialer) dial(ctx context.Context, addr string, idx int) (*quicConn, error) {
 	var raddr *net.UDPAddr
 	var err error
 	if raddr, err = resolver.DefaultResolver.ResolveUDPAddr(ctx, addr); err != nil {
 		return nil, err
 	}
-	conn, err := ListenLocalUDP(ctx)
+	tr, err := d.newTransport(ctx)
 	if err != nil {
 		return nil, err
 	}
+	c, err := tr.DialEarly(ctx, raddr, TlsConfigQuicALPN(d.tlsConfig), QuicConfig(d.opts))
+	if err != nil {
+		closeQuicTransport(tr)
+		return nil, err
+	}
+	conn := &quicConn{addr: addr, idx: idx, EarlyConnection: c, raddr: raddr, transports: []*quic.Transport{tr}}
+	go conn.closeTransports()
+	if d.opts.Migrate {
+		go d.watchNetwork(conn)
+	}
+	return conn, nil
+}
 
-	return quic.DialEarly(ctx, conn, raddr, TlsConfigQuicALPN(d.tlsConfig), &quic.Config{
-		HandshakeIdleTimeout:  d.opts.HandshakeIdleTimeout,
-		KeepAlivePeriod:       d.opts.KeepAlivePeriod,
-		MaxIdleTimeout:        d.opts.MaxIdleTimeout,
-		MaxIncomingStreams:    1 << 32,
-		MaxIncomingUniStreams: 1 << 32,
-		Versions: []quic.Version{
-			quic.Version1,
-			quic.Version2,
-		},
-	})
+// watchNetwork migrates the connection once the local address which routes to the server changes,
+// such as switching from wifi to cellular
+func (d *quicDialer) watchNetwork(conn *quicConn) {
+	last, _ := routeLocalAddr(conn.raddr)
+	ticker := time.NewTicker(quicMigrateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		local, err := routeLocalAddr(conn.raddr)
+		// wait for the new network if there is no route to the server
+		if err != nil || local == last {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(conn.Context(), DefaultDialTimeout)
+		err = d.migrate(ctx, conn)
+		cancel()
+		if err != nil {
+			logger.Logger.Tracef("quic migrate conn: %s, idx:[%d], err: %v", conn.raddr, conn.idx, err)
+			continue
+		}
+		logger.Logger.Tracef("quic migrate conn: %s, idx:[%d], local: %s -> %s", conn.raddr, conn.idx, last, local)
+		last = local
+	}
+}
+
+// migrate moves the connection to a new udp socket after the path is validated
+func (d *quicDialer) migrate(ctx context.Context, conn *quicConn) error {
+	tr, err := d.newTransport(ctx)
+	if err != nil {
+		return err
+	}
+	path, err := conn.AddPath(tr)
+	if err != nil {
+		closeQuicTransport(tr)
+		return err
+	}
+	if err = path.Probe(ctx); err == nil {
+		err = path.Switch()
+	}
+	if err != nil {
+		path.Close()
+		closeQuicTransport(tr)
+		return err
+	}
+	conn.addTransport(tr)
+	return nil
+}
+
+// routeLocalAddr returns the local address which the system routes to the server with, no packet is sent
+func routeLocalAddr(raddr *net.UDPAddr) (netip.Addr, error) {
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr(), nil
 }
 
 func (d *quicDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
@@ -84,23 +239,11 @@ func (d *quicDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
 }
 
 func (d *quicDialer) getAndDial(ctx context.Context, addr string) (*quicConn, error) {
-	return d.cpool.getConn(ctx, addr, func(ctx context.Context, addr string, idx int) (*quicConn, error) {
-		c, err := d.dial(ctx, addr)
-		if err != nil {
-			return nil, err
-		}
-		return &quicConn{addr: addr, idx: idx, EarlyConnection: c}, nil
-	})
+	return d.cpool.getConn(ctx, addr, d.dial)
 }
 
 func (d *quicDialer) retryDial(ctx context.Context, addr string, index int) (*quicConn, error) {
-	return d.cpool.getConnWithIndex(ctx, addr, index, false, func(ctx context.Context, addr string, idx int) (*quicConn, error) {
-		c, err := d.dial(ctx, addr)
-		if err != nil {
-			return nil, err
-		}
-		return &quicConn{addr: addr, idx: idx, EarlyConnection: c}, nil
-	})
+	return d.cpool.getConnWithIndex(ctx, addr, index, false, d.dial)
 }
 
 func (d *quicDialer) openStreamConn(ctx context.Context, conn *quicConn) (net.Conn, error) {
@@ -135,3 +278,99 @@ func (d *quicDialer) openStreamConn(ctx context.Context, conn *quicConn) (net.Co
 	logger.Logger.Tracef("quic open stream [%d] for conn: %s, idx:[%d]", stream.StreamID(), conn.LocalAddr(), conn.idx)
 	return connection.NewQuicConn(stream, conn.LocalAddr(), conn.RemoteAddr()), nil
 }
+
+// ListenPacket opens a udp session over the datagrams of the pooled quic connection
+func (d *quicDialer) ListenPacket(ctx context.Context, addr string) (net.PacketConn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	conn, err := d.getAndDial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Context().Err() != nil {
+		// Reset the broken connection slot and redial once
+		d.cpool.close(conn.idx, func(qc *quicConn) error {
+			return qc.CloseWithError(quic.ApplicationErrorCode(0), "")
+		})
+		if conn, err = d.retryDial(ctx, conn.addr, conn.idx); err != nil {
+			return nil, err
+		}
+	}
+	logger.Logger.Tracef("quic open datagram session for conn: %s, idx:[%d]", conn.LocalAddr(), conn.idx)
+	return conn.newDatagramSession(), nil
+}
+
+var _ net.PacketConn = (*quicDatagramConn)(nil)
+
+// quicDatagramConn the client side udp session, all the packets are sent to the proxy server
+type quicDatagramConn struct {
+	conn     *quicConn
+	id       uint32
+	ch       chan []byte
+	done     chan struct{}
+	once     sync.Once
+	deadline atomic.Value // time.Time
+}
+
+func (c *quicDatagramConn) deliver(b []byte) {
+	select {
+	case c.ch <- b:
+	case <-c.done:
+	default:
+		// drop the packet if the session is too slow
+	}
+}
+
+func (c *quicDatagramConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+	var timeout <-chan time.Time
+	if deadline, ok := c.deadline.Load().(time.Time); ok && !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case data := <-c.ch:
+		return copy(b, data), c.conn.RemoteAddr(), nil
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *quicDatagramConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if err := connection.SendQuicDatagram(c.conn.EarlyConnection, c.id, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *quicDatagramConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.sessions.Delete(c.id)
+	})
+	return nil
+}
+
+func (c *quicDatagramConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+func (c *quicDatagramConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *quicDatagramConn) SetReadDeadline(t time.Time) error {
+	c.deadline.Store(t)
+	return nil
+}
+
+func (c *quicDatagramConn) SetWriteDeadline(time.Time) error { return nil }
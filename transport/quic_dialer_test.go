@@ -0,0 +1,279 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josexy/mini-ss/connection"
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/util/cert"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// startQuicEchoServer echoes the streams and the udp packets of the datagram sessions
+func startQuicEchoServer(t *testing.T, opts *options.QuicOptions) string {
+	privateKey, err := cert.GeneratePrivateKey()
+	assert.Nil(t, err)
+	certificate, err := cert.GenerateCertificate(pkix.Name{CommonName: "mini-ss"}, nil, nil, nil, nil, privateKey)
+	assert.Nil(t, err)
+	tlsConfig := TlsConfigQuicALPN(&tls.Config{Certificates: []tls.Certificate{certificate}})
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ln, err := quic.ListenEarly(pconn, tlsConfig, QuicConfig(opts))
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		ln.Close()
+		pconn.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			if opts.Datagram {
+				go func() {
+					dc := connection.NewQuicDatagramConn(conn)
+					buf := make([]byte, 65535)
+					for {
+						n, addr, err := dc.ReadFrom(buf)
+						if err != nil {
+							return
+						}
+						dc.WriteTo(buf[:n], addr)
+					}
+				}()
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func() {
+						defer stream.Close()
+						io.Copy(stream, stream)
+					}()
+				}
+			}()
+		}
+	}()
+	return pconn.LocalAddr().String()
+}
+
+func newTestQuicDialer(t *testing.T, modify func(*options.QuicOptions)) (*quicDialer, *options.QuicOptions) {
+	resolver.DefaultResolver = resolver.NewDnsResolver(nil, true)
+	opts := *options.DefaultQuicOptions
+	opts.Conns = 1
+	modify(&opts)
+	d := newQUICDialer(&opts)
+	t.Cleanup(func() {
+		d.cpool.close(0, func(qc *quicConn) error {
+			return qc.CloseWithError(quic.ApplicationErrorCode(0), "")
+		})
+	})
+	return d, &opts
+}
+
+func assertQuicStreamEcho(t *testing.T, conn net.Conn, payload []byte) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	go conn.Write(payload)
+	got := make([]byte, len(payload))
+	_, err := io.ReadFull(conn, got)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(payload, got))
+}
+
+func TestQuicDatagramSessions(t *testing.T) {
+	d, opts := newTestQuicDialer(t, func(o *options.QuicOptions) { o.Datagram = true })
+	addr := startQuicEchoServer(t, opts)
+
+	// the large packets don't fit into a datagram frame and are sent over the streams
+	sizes := []int{1, 512, 1200, 4096, 65000}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pc, err := d.ListenPacket(context.Background(), addr)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer pc.Close()
+			buf := make([]byte, 65535)
+			for _, size := range sizes {
+				payload := make([]byte, size)
+				rand.Read(payload)
+				payload[0] = byte(i)
+				_, err = pc.WriteTo(payload, nil)
+				assert.Nil(t, err)
+				// the packets of the other sessions must not be received
+				pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := pc.ReadFrom(buf)
+				if !assert.Nil(t, err, "size %d", size) {
+					return
+				}
+				assert.True(t, bytes.Equal(payload, buf[:n]), "size %d", size)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// all the sessions share the same quic connection
+	conn, err := d.getAndDial(context.Background(), addr)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), conn.sessionID.Load())
+}
+
+func TestQuicDatagramSessionClose(t *testing.T) {
+	d, opts := newTestQuicDialer(t, func(o *options.QuicOptions) { o.Datagram = true })
+	addr := startQuicEchoServer(t, opts)
+
+	pc, err := d.ListenPacket(context.Background(), addr)
+	assert.Nil(t, err)
+	pc.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err = pc.ReadFrom(make([]byte, 16))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	pc.Close()
+	_, err = pc.WriteTo([]byte("closed"), nil)
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, _, err = pc.ReadFrom(make([]byte, 16))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+// udpNatProxy forwards the packets of each client address with its own upstream socket like a NAT,
+// so that the server sees a new address once the client migrates
+type udpNatProxy struct {
+	conn    net.PacketConn
+	target  *net.UDPAddr
+	mu      sync.Mutex
+	mapping map[string]net.PacketConn
+	blocked map[string]bool
+}
+
+func startUDPNatProxy(t *testing.T, target string) *udpNatProxy {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	raddr, err := net.ResolveUDPAddr("udp", target)
+	assert.Nil(t, err)
+	p := &udpNatProxy{conn: conn, target: raddr, mapping: make(map[string]net.PacketConn), blocked: make(map[string]bool)}
+	t.Cleanup(func() {
+		conn.Close()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, upstream := range p.mapping {
+			upstream.Close()
+		}
+	})
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, src, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			p.mu.Lock()
+			if p.blocked[src.String()] {
+				p.mu.Unlock()
+				continue
+			}
+			upstream, ok := p.mapping[src.String()]
+			if !ok {
+				if upstream, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+					p.mu.Unlock()
+					continue
+				}
+				p.mapping[src.String()] = upstream
+				go p.reply(upstream, src)
+			}
+			p.mu.Unlock()
+			upstream.WriteTo(buf[:n], p.target)
+		}
+	}()
+	return p
+}
+
+func (p *udpNatProxy) reply(upstream net.PacketConn, src net.Addr) {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := upstream.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		blocked := p.blocked[src.String()]
+		p.mu.Unlock()
+		if !blocked {
+			p.conn.WriteTo(buf[:n], src)
+		}
+	}
+}
+
+func (p *udpNatProxy) sources() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var sources []string
+	for src := range p.mapping {
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// block drops the packets from and to the client addresses
+func (p *udpNatProxy) block(sources []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, src := range sources {
+		p.blocked[src] = true
+	}
+}
+
+func TestQuicMigrate(t *testing.T) {
+	d, opts := newTestQuicDialer(t, func(o *options.QuicOptions) { o.Migrate = true })
+	proxy := startUDPNatProxy(t, startQuicEchoServer(t, opts))
+	addr := proxy.conn.LocalAddr().String()
+
+	stream, err := d.Dial(context.Background(), addr)
+	assert.Nil(t, err)
+	defer stream.Close()
+	assertQuicStreamEcho(t, stream, []byte("before migration"))
+
+	conn, err := d.getAndDial(context.Background(), addr)
+	assert.Nil(t, err)
+	oldPath := proxy.sources()
+	assert.Len(t, oldPath, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, d.migrate(ctx, conn))
+	assert.Len(t, proxy.sources(), 2)
+
+	// the old path is gone, the same connection and the opened stream keep working over the new path
+	proxy.block(oldPath)
+	assertQuicStreamEcho(t, stream, []byte("after migration"))
+	stream2, err := d.Dial(context.Background(), addr)
+	assert.Nil(t, err)
+	defer stream2.Close()
+	assertQuicStreamEcho(t, stream2, []byte("new stream after migration"))
+	assert.Nil(t, conn.Context().Err())
+
+	// the udp sockets of all the paths are closed with the connection
+	conn.CloseWithError(quic.ApplicationErrorCode(0), "")
+	assert.Eventually(t, func() bool {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return conn.transports == nil
+	}, time.Second, 10*time.Millisecond)
+}
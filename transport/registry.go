@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/josexy/mini-ss/options"
+)
+
+// DialerFactory creates the dialer of the transport with its options
+type DialerFactory func(options.Options) Dialer
+
+type registryEntry struct {
+	name        string
+	newDialer   DialerFactory
+	forwardable bool
+	bindable    bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[Type]*registryEntry{
+		Tcp:       {name: "tcp", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newTCPDialer(opt) }},
+		Quic:      {name: "quic", bindable: true, newDialer: func(opt options.Options) Dialer { return newQUICDialer(opt) }},
+		Websocket: {name: "websocket", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newWSDialer(opt) }},
+		Obfs:      {name: "obfs", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newOBFSDialer(opt) }},
+		Grpc:      {name: "grpc", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newGRPCDialer(opt) }},
+		Ssh:       {name: "ssh", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newSSHDialer(opt) }},
+		Http2:     {name: "http2", forwardable: true, bindable: true, newDialer: func(opt options.Options) Dialer { return newHTTP2Dialer(opt) }},
+		Kcp:       {name: "kcp", bindable: true, newDialer: func(opt options.Options) Dialer { return newKCPDialer(opt) }},
+	}
+	// the alias names used by the config
+	registryAlias = map[string]Type{
+		"default": Tcp,
+		"ws":      Websocket,
+	}
+	nextType = Kcp + 1
+)
+
+var errEmptyTransport = errors.New("transport name and dialer factory must not be empty")
+
+// Register registers a transport which is implemented out of the core, and returns its type.
+// The dialers of the registered transports can't be dialed through another proxy node or bound.
+func Register(name string, newDialer DialerFactory) (Type, error) {
+	if name == "" || newDialer == nil {
+		return 0, errEmptyTransport
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := parseType(name); ok {
+		return 0, fmt.Errorf("transport %q is already registered", name)
+	}
+	if nextType == 0 {
+		return 0, errors.New("too many registered transports")
+	}
+	typ := nextType
+	nextType++
+	registry[typ] = &registryEntry{name: name, newDialer: newDialer}
+	return typ, nil
+}
+
+// ParseType looks up the transport type by the name or the alias, such as "ws" and "default"
+func ParseType(name string) (Type, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return parseType(name)
+}
+
+func parseType(name string) (Type, bool) {
+	if typ, ok := registryAlias[name]; ok {
+		return typ, true
+	}
+	for typ, entry := range registry {
+		if entry.name == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+func lookup(typ Type) (*registryEntry, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	entry, ok := registry[typ]
+	return entry, ok
+}
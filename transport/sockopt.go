@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/josexy/mini-ss/sockopt"
+)
+
+// setupTcpDialer enables tcp fast open and multipath tcp for the dialer.
+// Note that the connect returns immediately with fast open, so the errors are reported by the first read or write.
+func setupTcpDialer(dialer *net.Dialer, opts *options.TcpOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.FastOpen {
+		sockopt.AddDialerControl(dialer, setFastOpenConnect)
+	}
+	if opts.Multipath {
+		dialer.SetMultipathTCP(true)
+	}
+}
+
+// ListenTCP listens on the tcp addr with the fast open and multipath tcp options
+func ListenTCP(ctx context.Context, addr string, opts *options.TcpOptions) (net.Listener, error) {
+	var lc net.ListenConfig
+	if opts != nil {
+		if opts.FastOpen {
+			sockopt.AddListenControl(&lc, setFastOpenListen)
+		}
+		if opts.Multipath {
+			lc.SetMultipathTCP(true)
+		}
+		if opts.Transparent {
+			sockopt.AddListenControl(&lc, setTransparent)
+		}
+	}
+	return lc.Listen(ctx, "tcp", addr)
+}
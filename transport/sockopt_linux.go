@@ -0,0 +1,20 @@
+package transport
+
+import (
+	"syscall"
+
+	"github.com/josexy/mini-ss/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+// the length of the queue of the pending fast open requests
+const fastOpenQueueLen = 256
+
+// setFastOpenConnect the first write is sent within the SYN, and the connect returns immediately
+func setFastOpenConnect(c syscall.RawConn) error {
+	return sockopt.SetsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+}
+
+func setFastOpenListen(c syscall.RawConn) error {
+	return sockopt.SetsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, fastOpenQueueLen)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errFastOpenUnsupported = errors.New("tcp fast open is only supported on linux")
+
+func setFastOpenConnect(syscall.RawConn) error { return errFastOpenUnsupported }
+
+func setFastOpenListen(syscall.RawConn) error { return errFastOpenUnsupported }
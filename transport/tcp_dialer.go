@@ -4,97 +4,87 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/netip"
+	"strconv"
 
-	"github.com/josexy/cropstun/bind"
 	"github.com/josexy/mini-ss/options"
 	"github.com/josexy/mini-ss/resolver"
+	"github.com/josexy/mini-ss/sockopt"
 )
 
-type tcpDialer struct{}
+var errNoSuitableAddress = errors.New("no suitable address found")
 
-// FIXME: need dual stack dial?
-func (d *tcpDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
-	if options.DefaultOptions.OutboundInterface == "" {
-		tcpAddr, err := resolver.DefaultResolver.ResolveTCPAddr(ctx, addr)
-		if err != nil {
-			return nil, err
-		}
-		dialer := &net.Dialer{Timeout: DefaultDialTimeout}
-		return dialer.DialContext(ctx, "tcp", tcpAddr.String())
-	}
-	network := "tcp"
-	switch network {
-	case "tcp4", "tcp6":
-		return d.dialSingle(ctx, network, addr)
-	case "tcp":
-		return d.dualStackDialContext(ctx, network, addr)
-	default:
-		return nil, errors.New("network invalid")
-	}
+type tcpDialer struct {
+	// forward establishes the underlying tcp connections through another proxy node if not nil
+	forward Dialer
+	bind    *options.BindOptions
+	opts    *options.TcpOptions
 }
 
-func (d *tcpDialer) dialSingle(ctx context.Context, network string, addr string) (net.Conn, error) {
-	dialer := &net.Dialer{Timeout: DefaultDialTimeout}
+func newTCPDialer(opt options.Options) *tcpDialer {
+	d := new(tcpDialer)
+	// the tcp options are only available for the tcp transport
+	d.opts, _ = opt.(*options.TcpOptions)
+	return d
+}
 
-	tcpAddr, err := resolver.DefaultResolver.ResolveTCPAddr(ctx, addr)
+func (d *tcpDialer) setForward(forward Dialer) { d.forward = forward }
+
+func (d *tcpDialer) setBind(bind *options.BindOptions) { d.bind = bind }
+
+// Dial races the connections to the ipv4 and ipv6 addresses of the host with happy eyeballs (RFC 8305)
+func (d *tcpDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if d.forward != nil {
+		return d.forward.Dial(ctx, addr)
+	}
+	host, p, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	if err := bind.BindToDeviceForConn(options.DefaultOptions.OutboundInterface, dialer, network, tcpAddr.AddrPort().Addr()); err != nil {
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
 		return nil, err
 	}
-	return dialer.DialContext(ctx, network, tcpAddr.String())
-}
-
-func (d *tcpDialer) dualStackDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
-	host, _, err := net.SplitHostPort(addr)
+	ipv4, ipv6, err := resolver.DefaultResolver.LookupIPv4v6(ctx, host)
 	if err != nil {
 		return nil, err
 	}
-	returned := make(chan struct{})
-	defer close(returned)
-
-	type dialResult struct {
-		net.Conn
-		error
-		ipv6 bool
-		done bool
+	b := sockopt.NewBind(d.bind)
+	// the source ip restricts the address family
+	switch b.Network("tcp") {
+	case "tcp4":
+		ipv6 = nil
+	case "tcp6":
+		ipv4 = nil
 	}
-	results := make(chan dialResult)
-	var primary, fallback dialResult
-
-	startRacer := func(ctx context.Context, network, host string, ipv6 bool) {
-		result := dialResult{ipv6: ipv6, done: true}
-		defer func() {
-			select {
-			case results <- result:
-			case <-returned:
-				if result.Conn != nil {
-					result.Conn.Close()
-				}
-			}
-		}()
-		result.Conn, result.error = d.dialSingle(ctx, network, addr)
+	addrs := sortAddrs(ipv4, ipv6, options.DefaultOptions.IPPreference)
+	if len(addrs) == 0 {
+		return nil, errNoSuitableAddress
 	}
+	opts := d.opts
+	// the connect returns immediately with fast open, so the first address always wins the race
+	// and a broken address family could not fall back, fast open is only used for a single address
+	if opts != nil && opts.FastOpen && len(addrs) > 1 {
+		clone := *opts
+		clone.FastOpen = false
+		opts = &clone
+	}
+	return dialParallel(ctx, addrs, func(ctx context.Context, ip netip.Addr) (net.Conn, error) {
+		return dialSingle(ctx, b, opts, netip.AddrPortFrom(ip, uint16(port)))
+	})
+}
 
-	go startRacer(ctx, network+"4", host, false)
-	go startRacer(ctx, network+"6", host, true)
-
-	for res := range results {
-		if res.error == nil {
-			return res.Conn, nil
-		}
-
-		if !res.ipv6 {
-			primary = res
-		} else {
-			fallback = res
-		}
-
-		if primary.done && fallback.done {
-			return nil, primary.error
+func dialSingle(ctx context.Context, b sockopt.Bind, opts *options.TcpOptions, addr netip.AddrPort) (net.Conn, error) {
+	network := "tcp4"
+	if addr.Addr().Is6() {
+		network = "tcp6"
+	}
+	dialer := &net.Dialer{Timeout: DefaultDialTimeout}
+	if !b.Empty() {
+		if err := b.SetupDialer(dialer, network, addr.Addr()); err != nil {
+			return nil, err
 		}
 	}
-
-	return nil, errors.New("never touched")
+	setupTcpDialer(dialer, opts)
+	return dialer.DialContext(ctx, network, addr.String())
 }
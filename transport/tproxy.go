@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ListenTProxyUDP listens on the udp addr for the tproxy rules,
+// the original destination of each packet is read with ReadFromTProxyUDP
+func ListenTProxyUDP(ctx context.Context, addr string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(_, _ string, c syscall.RawConn) error {
+		if err := setTransparent(c); err != nil {
+			return err
+		}
+		// the flows whose original destination has the same port can still be bound
+		if err := setReuseAddr(c); err != nil {
+			return err
+		}
+		return setRecvOrigDst(c)
+	}}
+	conn, err := lc.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// ReadFromTProxyUDP reads a packet and its source and original destination addresses
+func ReadFromTProxyUDP(conn *net.UDPConn, b, oob []byte) (n int, src, dst netip.AddrPort, err error) {
+	n, oobn, _, src, err := conn.ReadMsgUDPAddrPort(b, oob)
+	if err != nil {
+		return
+	}
+	if dst, err = parseOrigDst(oob[:oobn]); err != nil {
+		return
+	}
+	return n, netip.AddrPortFrom(src.Addr().Unmap(), src.Port()), netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port()), nil
+}
+
+// DialTransparentUDP binds to the non-local laddr and connects to raddr, which is used to reply the packets
+// of the tproxy rules with the original destination as the source address. The following packets of the flow
+// are received by the connected socket instead of the tproxy listener, since it matches them exactly.
+func DialTransparentUDP(ctx context.Context, laddr, raddr netip.AddrPort) (*net.UDPConn, error) {
+	dialer := net.Dialer{
+		LocalAddr: net.UDPAddrFromAddrPort(laddr),
+		Control: func(_, _ string, c syscall.RawConn) error {
+			if err := setTransparent(c); err != nil {
+				return err
+			}
+			return setReuseAddr(c)
+		},
+	}
+	network := "udp4"
+	if laddr.Addr().Is6() {
+		network = "udp6"
+	}
+	conn, err := dialer.DialContext(ctx, network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// OriginalDst the original destination of the tcp connection redirected by the REDIRECT rules
+func OriginalDst(conn net.Conn) (netip.AddrPort, error) {
+	for {
+		nc, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = nc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return netip.AddrPort{}, errOriginalDstUnsupported
+	}
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	var dst netip.AddrPort
+	var innerErr error
+	if err = c.Control(func(fd uintptr) { dst, innerErr = getOriginalDst(fd) }); err != nil {
+		return netip.AddrPort{}, err
+	}
+	return dst, innerErr
+}
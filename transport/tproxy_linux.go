@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"syscall"
+
+	"github.com/josexy/mini-ss/sockopt"
+	"golang.org/x/sys/unix"
+)
+
+// SO_ORIGINAL_DST and IP6T_SO_ORIGINAL_DST of netfilter
+const soOriginalDst = 80
+
+var (
+	errOriginalDstUnsupported = errors.New("original destination is only supported by the tcp connections")
+	errOrigDstAddrNotFound    = errors.New("original destination address not found")
+)
+
+func socketDomain(c syscall.RawConn) (int, error) {
+	var domain int
+	var innerErr error
+	if err := c.Control(func(fd uintptr) {
+		domain, innerErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_DOMAIN)
+	}); err != nil {
+		return 0, err
+	}
+	return domain, innerErr
+}
+
+// setTransparent the socket can bind to and accept the non-local addresses, which requires CAP_NET_ADMIN
+func setTransparent(c syscall.RawConn) error {
+	domain, err := socketDomain(c)
+	if err != nil {
+		return err
+	}
+	if domain == unix.AF_INET6 {
+		// the dual stack socket receives both the ipv4 and ipv6 packets
+		if err = sockopt.SetsockoptInt(c, unix.SOL_IPV6, unix.IPV6_TRANSPARENT, 1); err != nil {
+			return err
+		}
+	}
+	return sockopt.SetsockoptInt(c, unix.SOL_IP, unix.IP_TRANSPARENT, 1)
+}
+
+func setRecvOrigDst(c syscall.RawConn) error {
+	domain, err := socketDomain(c)
+	if err != nil {
+		return err
+	}
+	if domain == unix.AF_INET6 {
+		if err = sockopt.SetsockoptInt(c, unix.SOL_IPV6, unix.IPV6_RECVORIGDSTADDR, 1); err != nil {
+			return err
+		}
+	}
+	return sockopt.SetsockoptInt(c, unix.SOL_IP, unix.IP_RECVORIGDSTADDR, 1)
+}
+
+func setReuseAddr(c syscall.RawConn) error {
+	return sockopt.SetsockoptInt(c, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+}
+
+// parseOrigDst parses the sockaddr_in or sockaddr_in6 of the IP_ORIGDSTADDR or IPV6_ORIGDSTADDR control message
+func parseOrigDst(oob []byte) (netip.AddrPort, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == unix.SOL_IP && msg.Header.Type == unix.IP_ORIGDSTADDR && len(msg.Data) >= unix.SizeofSockaddrInet4:
+			addr := netip.AddrFrom4([4]byte(msg.Data[4:8]))
+			return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(msg.Data[2:4])), nil
+		case msg.Header.Level == unix.SOL_IPV6 && msg.Header.Type == unix.IPV6_ORIGDSTADDR && len(msg.Data) >= unix.SizeofSockaddrInet6:
+			addr := netip.AddrFrom16([16]byte(msg.Data[8:24]))
+			return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(msg.Data[2:4])), nil
+		}
+	}
+	return netip.AddrPort{}, errOrigDstAddrNotFound
+}
+
+func getOriginalDst(fd uintptr) (netip.AddrPort, error) {
+	domain, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_DOMAIN)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	if domain == unix.AF_INET6 {
+		// the ipv4 connections accepted by the dual stack socket are still redirected by iptables
+		if info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.SOL_IPV6, soOriginalDst); err == nil {
+			// the port is in the network byte order
+			port := binary.BigEndian.Uint16(binary.NativeEndian.AppendUint16(nil, info.Addr.Port))
+			return netip.AddrPortFrom(netip.AddrFrom16(info.Addr.Addr).Unmap(), port), nil
+		}
+	}
+	mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, soOriginalDst)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	// sockaddr_in: family(2) port(2) addr(4)
+	port := binary.BigEndian.Uint16(mreq.Multiaddr[2:4])
+	return netip.AddrPortFrom(netip.AddrFrom4([4]byte(mreq.Multiaddr[4:8])), port), nil
+}
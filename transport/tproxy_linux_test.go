@@ -0,0 +1,220 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/josexy/mini-ss/options"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+const netnsEnv = "MINI_SS_TEST_NETNS"
+
+// runInNetns runs the test in a new network namespace where it has CAP_NET_ADMIN,
+// it returns true in the namespace after the setup commands of ip are executed
+func runInNetns(t *testing.T, setup ...string) bool {
+	if os.Getenv(netnsEnv) == "1" {
+		for _, args := range setup {
+			if out, err := exec.Command("ip", strings.Fields(args)...).CombinedOutput(); err != nil {
+				t.Fatalf("ip %s: %v: %s", args, err, out)
+			}
+		}
+		return true
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip is required to setup the network namespace")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.v")
+	cmd.Env = append(os.Environ(), netnsEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Skipf("network namespace is unavailable: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("test in network namespace failed: %v\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), "--- SKIP") {
+		t.Skip(out.String())
+	}
+	return false
+}
+
+func buildCmsg(level, typ int, data []byte) []byte {
+	b := make([]byte, unix.CmsgSpace(len(data)))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(unix.CmsgLen(len(data)))
+	copy(b[unix.CmsgLen(0):], data)
+	return b
+}
+
+func TestParseOrigDst(t *testing.T) {
+	// sockaddr_in: family(2) port(2) addr(4) zero(8)
+	sa4 := make([]byte, unix.SizeofSockaddrInet4)
+	sa4[2], sa4[3] = 0x00, 0x35
+	copy(sa4[4:8], []byte{198, 18, 0, 1})
+	// sockaddr_in6: family(2) port(2) flowinfo(4) addr(16) scope_id(4)
+	sa6 := make([]byte, unix.SizeofSockaddrInet6)
+	sa6[2], sa6[3] = 0x01, 0xbb
+	want6 := netip.MustParseAddr("2001:db8::1")
+	addr6 := want6.As16()
+	copy(sa6[8:24], addr6[:])
+
+	tests := []struct {
+		name    string
+		oob     []byte
+		want    netip.AddrPort
+		wantErr error
+	}{
+		{
+			name: "ipv4",
+			oob:  buildCmsg(unix.SOL_IP, unix.IP_ORIGDSTADDR, sa4),
+			want: netip.MustParseAddrPort("198.18.0.1:53"),
+		},
+		{
+			name: "ipv6",
+			oob:  buildCmsg(unix.SOL_IPV6, unix.IPV6_ORIGDSTADDR, sa6),
+			want: netip.AddrPortFrom(want6, 443),
+		},
+		{
+			name: "skip other messages",
+			oob:  append(buildCmsg(unix.SOL_IP, unix.IP_TTL, []byte{64, 0, 0, 0}), buildCmsg(unix.SOL_IP, unix.IP_ORIGDSTADDR, sa4)...),
+			want: netip.MustParseAddrPort("198.18.0.1:53"),
+		},
+		{
+			name:    "short sockaddr",
+			oob:     buildCmsg(unix.SOL_IP, unix.IP_ORIGDSTADDR, sa4[:8]),
+			wantErr: errOrigDstAddrNotFound,
+		},
+		{
+			name:    "not found",
+			oob:     buildCmsg(unix.SOL_IP, unix.IP_TTL, []byte{64, 0, 0, 0}),
+			wantErr: errOrigDstAddrNotFound,
+		},
+		{
+			name:    "empty",
+			wantErr: errOrigDstAddrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOrigDst(tt.oob)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseOrigDstMalformed(t *testing.T) {
+	oob := buildCmsg(unix.SOL_IP, unix.IP_ORIGDSTADDR, make([]byte, unix.SizeofSockaddrInet4))
+	// the length of the control message exceeds the buffer
+	_, err := parseOrigDst(oob[:unix.CmsgLen(0)+4])
+	assert.Error(t, err)
+}
+
+// wrappedConn the connection wrapped by the others, such as the tls connection
+type wrappedConn struct{ net.Conn }
+
+func (c wrappedConn) NetConn() net.Conn { return c.Conn }
+
+func TestOriginalDst(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	_, err := OriginalDst(c1)
+	assert.ErrorIs(t, err, errOriginalDstUnsupported)
+
+	// the fake destinations are local addresses, so the connections are accepted by the transparent listener
+	if !runInNetns(t, "link set lo up", "route add local 198.18.0.0/16 dev lo") {
+		return
+	}
+	ln, err := ListenTCP(context.Background(), "0.0.0.0:0", &options.TcpOptions{Transparent: true})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ln.Close()
+	dst := netip.AddrPortFrom(netip.MustParseAddr("198.18.0.1"), uint16(ln.Addr().(*net.TCPAddr).Port))
+	client, err := net.DialTimeout("tcp", dst.String(), 5*time.Second)
+	assert.Nil(t, err)
+	defer client.Close()
+	conn, err := ln.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, dst.String(), conn.LocalAddr().String())
+
+	// the original destination is only tracked by the conntrack of the nat rules
+	got, err := OriginalDst(wrappedConn{wrappedConn{conn}})
+	if errors.Is(err, unix.ENOENT) {
+		t.Log("the connection is not tracked without the nat rules")
+		return
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, dst, got)
+}
+
+func TestTProxyUDP(t *testing.T) {
+	if !runInNetns(t, "link set lo up", "route add local 198.18.0.0/16 dev lo") {
+		return
+	}
+	ln, err := ListenTProxyUDP(context.Background(), "0.0.0.0:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ln.Close()
+	ln.SetDeadline(time.Now().Add(5 * time.Second))
+	dst := netip.AddrPortFrom(netip.MustParseAddr("198.18.0.1"), uint16(ln.LocalAddr().(*net.UDPAddr).Port))
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.WriteToUDPAddrPort([]byte("first"), dst)
+	assert.Nil(t, err)
+
+	buf, oob := make([]byte, 64), make([]byte, 1024)
+	n, src, origDst, err := ReadFromTProxyUDP(ln, buf, oob)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(buf[:n]))
+	assert.Equal(t, client.LocalAddr().String(), src.String())
+	assert.Equal(t, dst, origDst)
+
+	// the reply is sent from the original destination, and the following packets are received by the flow
+	flow, err := DialTransparentUDP(context.Background(), origDst, src)
+	assert.Nil(t, err)
+	defer flow.Close()
+	flow.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = flow.Write([]byte("reply"))
+	assert.Nil(t, err)
+	n, from, err := client.ReadFromUDPAddrPort(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "reply", string(buf[:n]))
+	assert.Equal(t, dst, netip.AddrPortFrom(from.Addr().Unmap(), from.Port()))
+
+	_, err = client.WriteToUDPAddrPort([]byte("second"), dst)
+	assert.Nil(t, err)
+	n, err = flow.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(buf[:n]))
+}
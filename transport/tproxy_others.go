@@ -0,0 +1,24 @@
+//go:build !linux
+
+package transport
+
+import (
+	"errors"
+	"net/netip"
+	"syscall"
+)
+
+var (
+	errTProxyUnsupported      = errors.New("transparent proxy is only supported on linux")
+	errOriginalDstUnsupported = errTProxyUnsupported
+)
+
+func setTransparent(syscall.RawConn) error { return errTProxyUnsupported }
+
+func setRecvOrigDst(syscall.RawConn) error { return errTProxyUnsupported }
+
+func setReuseAddr(syscall.RawConn) error { return errTProxyUnsupported }
+
+func parseOrigDst([]byte) (netip.AddrPort, error) { return netip.AddrPort{}, errTProxyUnsupported }
+
+func getOriginalDst(uintptr) (netip.AddrPort, error) { return netip.AddrPort{}, errTProxyUnsupported }
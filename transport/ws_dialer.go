@@ -3,9 +3,11 @@ package transport
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -52,6 +54,13 @@ func (d *wsDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
 	if d.err != nil {
 		return nil, d.err
 	}
+	if d.opts.EarlyDataEnabled() {
+		return newWsEarlyDataConn(ctx, d, addr), nil
+	}
+	return d.dial(ctx, addr, nil)
+}
+
+func (d *wsDialer) dial(ctx context.Context, addr string, earlyData []byte) (net.Conn, error) {
 	scheme := "ws"
 	if d.tlsConfig != nil {
 		scheme = "wss"
@@ -66,10 +75,208 @@ func (d *wsDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
 	if d.opts.UserAgent != "" {
 		header.Add("User-Agent", d.opts.UserAgent)
 	}
-	conn, rsp, err := d.dialer.Dial(urls.String(), header)
+	for key, value := range d.opts.Headers {
+		header.Set(key, value)
+	}
+	if len(earlyData) > 0 {
+		encoded := base64.RawURLEncoding.EncodeToString(earlyData)
+		if d.opts.EarlyDataPath {
+			urls.Path += encoded
+		} else {
+			header.Set(d.opts.EarlyDataHeader, encoded)
+		}
+	}
+	// the websocket dialer only applies the deadline of the context to the handshake,
+	// so the underlying connection is closed to abort the handshake once the context is canceled
+	var stop func() bool
+	dialer := *d.dialer
+	dialer.NetDialContext = func(dialCtx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.dialer.NetDialContext(dialCtx, network, addr)
+		if err == nil {
+			stop = context.AfterFunc(ctx, func() { conn.Close() })
+		}
+		return conn, err
+	}
+	conn, rsp, err := dialer.DialContext(ctx, urls.String(), header)
+	if stop != nil && !stop() && err == nil {
+		conn.Close()
+		err = ctx.Err()
+	}
 	if err != nil {
 		return nil, err
 	}
 	rsp.Body.Close()
 	return connection.NewWebsocketConn(conn), nil
 }
+
+// wsEarlyDataConn delays the handshake until the first write, and the data is sent within the handshake request
+type wsEarlyDataConn struct {
+	dialer *wsDialer
+	addr   string
+	// the dial context whose values are used by the handshake, it's canceled after dialing usually
+	ctx context.Context
+
+	mu     sync.Mutex
+	conn   net.Conn
+	err    error
+	rd, wd time.Time
+	// the handshake is started by the first write or the conn is closed before it
+	started bool
+	closed  bool
+	// aborts the handshake in progress
+	cancel context.CancelFunc
+	// closed after the handshake is done or failed
+	ready chan struct{}
+}
+
+func newWsEarlyDataConn(ctx context.Context, dialer *wsDialer, addr string) *wsEarlyDataConn {
+	return &wsEarlyDataConn{
+		dialer: dialer,
+		addr:   addr,
+		ctx:    context.WithoutCancel(ctx),
+		ready:  make(chan struct{}),
+	}
+}
+
+// handshake the mutex is not held during the handshake, which is bounded by the write deadline
+// or the default dial timeout, and it's aborted by Close
+func (c *wsEarlyDataConn) handshake(earlyData []byte) {
+	c.mu.Lock()
+	if c.closed {
+		c.err = net.ErrClosed
+		close(c.ready)
+		c.mu.Unlock()
+		return
+	}
+	deadline := c.wd
+	if deadline.IsZero() {
+		deadline = time.Now().Add(DefaultDialTimeout)
+	}
+	ctx, cancel := context.WithDeadline(c.ctx, deadline)
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	conn, err := c.dialer.dial(ctx, c.addr, earlyData)
+	cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil && c.closed {
+		conn.Close()
+		err = net.ErrClosed
+	}
+	if err == nil {
+		if !c.rd.IsZero() {
+			conn.SetReadDeadline(c.rd)
+		}
+		if !c.wd.IsZero() {
+			conn.SetWriteDeadline(c.wd)
+		}
+		c.conn = conn
+	}
+	c.err = err
+	close(c.ready)
+}
+
+func (c *wsEarlyDataConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		<-c.ready
+		if c.err != nil {
+			return 0, c.err
+		}
+		return c.conn.Write(b)
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	n := min(len(b), c.dialer.opts.MaxEarlyData)
+	c.handshake(b[:n])
+	if c.err != nil {
+		return 0, c.err
+	}
+	if n < len(b) {
+		m, err := c.conn.Write(b[n:])
+		return n + m, err
+	}
+	return n, nil
+}
+
+func (c *wsEarlyDataConn) Read(b []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(b)
+}
+
+func (c *wsEarlyDataConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if !c.started {
+		c.started = true
+		c.err = net.ErrClosed
+		close(c.ready)
+		return nil
+	}
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	// the handshake is in progress or failed
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
+
+func (c *wsEarlyDataConn) LocalAddr() net.Addr {
+	select {
+	case <-c.ready:
+		if c.conn != nil {
+			return c.conn.LocalAddr()
+		}
+	default:
+	}
+	return &net.TCPAddr{}
+}
+
+func (c *wsEarlyDataConn) RemoteAddr() net.Addr {
+	select {
+	case <-c.ready:
+		if c.conn != nil {
+			return c.conn.RemoteAddr()
+		}
+	default:
+	}
+	return &net.TCPAddr{}
+}
+
+func (c *wsEarlyDataConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *wsEarlyDataConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rd = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *wsEarlyDataConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wd = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package trojan
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/josexy/mini-ss/address"
+)
+
+var _ net.Conn = (*Conn)(nil)
+
+// Conn the client stream connection, the request header is sent along with the first written bytes
+type Conn struct {
+	net.Conn
+	hash []byte
+	sent bool
+}
+
+func NewClientConn(c net.Conn, hash []byte) *Conn {
+	return &Conn{Conn: c, hash: hash}
+}
+
+// Write the first written bytes must start with the target address
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.sent {
+		return c.Conn.Write(b)
+	}
+	addr, err := address.ParseAddressFromBuffer(b)
+	if err != nil {
+		return 0, errUnsupportedAddr
+	}
+	var buf bytes.Buffer
+	writeRequest(&buf, c.hash, CmdConnect, addr)
+	buf.Write(b[len(addr):])
+	c.sent = true
+	if _, err = c.Conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+type DialFunc func(context.Context) (net.Conn, error)
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+// PacketConn the client udp associate, the packets are framed over a stream connection dialed on the first write.
+// The written packets are {ADDR}{PAYLOAD}, and so are the read packets which are from the proxy server.
+type PacketConn struct {
+	hash   []byte
+	dial   DialFunc
+	local  net.PacketConn
+	server net.Addr
+
+	conn     net.Conn
+	dialOnce sync.Once
+	dialErr  error
+	ready    chan struct{}
+	closed   chan struct{}
+	close    sync.Once
+	writeMu  sync.Mutex
+	sent     bool
+
+	deadlineMu    sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewClientPacketConn the local packet conn is only used for the local address and closed together
+func NewClientPacketConn(local net.PacketConn, server net.Addr, hash []byte, dial DialFunc) *PacketConn {
+	return &PacketConn{
+		hash:   hash,
+		dial:   dial,
+		local:  local,
+		server: server,
+		ready:  make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *PacketConn) connect() error {
+	c.dialOnce.Do(func() {
+		defer close(c.ready)
+		conn, err := c.dial(context.Background())
+		if err != nil {
+			c.dialErr = err
+			return
+		}
+		c.deadlineMu.Lock()
+		select {
+		case <-c.closed:
+			c.deadlineMu.Unlock()
+			conn.Close()
+			c.dialErr = net.ErrClosed
+			return
+		default:
+		}
+		conn.SetReadDeadline(c.readDeadline)
+		conn.SetWriteDeadline(c.writeDeadline)
+		c.conn = conn
+		c.deadlineMu.Unlock()
+	})
+	return c.dialErr
+}
+
+func (c *PacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if err := c.connect(); err != nil {
+		return 0, err
+	}
+	addr, err := address.ParseAddressFromBuffer(b)
+	if err != nil {
+		return 0, errUnsupportedAddr
+	}
+	var buf bytes.Buffer
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.sent {
+		writeRequest(&buf, c.hash, CmdUDPAssociate, addr)
+	}
+	if err = writePacket(&buf, addr, b[len(addr):]); err != nil {
+		return 0, err
+	}
+	if _, err = c.conn.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	c.sent = true
+	return len(b), nil
+}
+
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-c.ready:
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+	if c.dialErr != nil {
+		return 0, nil, c.dialErr
+	}
+	_, n, err := ReadPacket(c.conn, b)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, c.server, nil
+}
+
+func (c *PacketConn) Close() error {
+	var err error = net.ErrClosed
+	c.close.Do(func() {
+		close(c.closed)
+		err = c.local.Close()
+		c.deadlineMu.Lock()
+		if c.conn != nil {
+			err = c.conn.Close()
+		}
+		c.deadlineMu.Unlock()
+	})
+	return err
+}
+
+func (c *PacketConn) LocalAddr() net.Addr { return c.local.LocalAddr() }
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.writeDeadline = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
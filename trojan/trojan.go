@@ -0,0 +1,138 @@
+package trojan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/josexy/mini-ss/address"
+)
+
+const (
+	CmdConnect      byte = 0x01
+	CmdUDPAssociate byte = 0x03
+)
+
+// the length of the hex encoded SHA224 password
+const hashLen = sha256.Size224 * 2
+
+var crlf = []byte{'\r', '\n'}
+
+var (
+	ErrAuthFailed      = errors.New("trojan: authentication failed")
+	ErrInvalidRequest  = errors.New("trojan: invalid request")
+	errPacketTooLarge  = errors.New("trojan: packet too large")
+	errUnsupportedAddr = errors.New("trojan: unsupported address")
+)
+
+// Hash returns the hex encoded SHA224 of the password
+func Hash(password string) []byte {
+	sum := sha256.Sum224([]byte(password))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// writeRequest the request header: hex(SHA224(password)) CRLF CMD ADDR CRLF
+func writeRequest(buf *bytes.Buffer, hash []byte, cmd byte, addr address.Address) {
+	buf.Write(hash)
+	buf.Write(crlf)
+	buf.WriteByte(cmd)
+	buf.Write(addr)
+	buf.Write(crlf)
+}
+
+// ReadRequest reads and verifies the request header, the address is stored in b.
+// The hash and CRLF must arrive in the first read, which the clients send at once, so that the other
+// requests are rejected immediately instead of waiting for more bytes to be distinguished by the timing
+func ReadRequest(r io.Reader, hash []byte, b []byte) (byte, address.Address, error) {
+	var head [hashLen + 3]byte
+	n, err := r.Read(head[:])
+	if n < hashLen+2 {
+		if n == 0 && err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, ErrAuthFailed
+	}
+	if subtle.ConstantTimeCompare(head[:hashLen], hash) != 1 {
+		return 0, nil, ErrAuthFailed
+	}
+	if !bytes.Equal(head[hashLen:hashLen+2], crlf) {
+		return 0, nil, ErrInvalidRequest
+	}
+	if n < len(head) {
+		if _, err = io.ReadFull(r, head[n:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	cmd := head[hashLen+2]
+	if cmd != CmdConnect && cmd != CmdUDPAssociate {
+		return 0, nil, ErrInvalidRequest
+	}
+	addr, err := address.ParseAddressFromReader(r, b)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = readCRLF(r); err != nil {
+		return 0, nil, err
+	}
+	return cmd, addr, nil
+}
+
+func readCRLF(r io.Reader) error {
+	var tail [2]byte
+	if _, err := io.ReadFull(r, tail[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(tail[:], crlf) {
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+// writePacket the udp packet: ADDR LENGTH CRLF PAYLOAD
+func writePacket(buf *bytes.Buffer, addr address.Address, payload []byte) error {
+	if len(payload) > 0xffff {
+		return errPacketTooLarge
+	}
+	buf.Write(addr)
+	buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(payload))))
+	buf.Write(crlf)
+	buf.Write(payload)
+	return nil
+}
+
+// WritePacket writes a framed udp packet to the stream
+func WritePacket(w io.Writer, addr address.Address, payload []byte) error {
+	var buf bytes.Buffer
+	if err := writePacket(&buf, addr, payload); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadPacket reads a framed udp packet from the stream, b holds {ADDR}{PAYLOAD} and n is the total length
+func ReadPacket(r io.Reader, b []byte) (address.Address, int, error) {
+	addr, err := address.ParseAddressFromReader(r, b)
+	if err != nil {
+		return nil, 0, err
+	}
+	var size [2]byte
+	if _, err = io.ReadFull(r, size[:]); err != nil {
+		return nil, 0, err
+	}
+	if err = readCRLF(r); err != nil {
+		return nil, 0, err
+	}
+	length := int(binary.BigEndian.Uint16(size[:]))
+	if len(addr)+length > len(b) {
+		return nil, 0, io.ErrShortBuffer
+	}
+	if _, err = io.ReadFull(r, b[len(addr):len(addr)+length]); err != nil {
+		return nil, 0, err
+	}
+	return addr, len(addr) + length, nil
+}
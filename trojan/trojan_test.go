@@ -0,0 +1,98 @@
+package trojan
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/josexy/mini-ss/address"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	// echo -n "password" | sha224sum
+	assert.Equal(t, "d63dc919e201d7bc4c825630d2cf25fdc93d4b2f0d46706d29038d01", string(Hash("password")))
+}
+
+func TestConnRequest(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	hash := Hash("password")
+	go func() {
+		conn := NewClientConn(client, hash)
+		addr, _ := address.ParseAddress("www.example.com:443", make([]byte, 64))
+		conn.Write(addr)
+		conn.Write([]byte("hello"))
+	}()
+
+	cmd, addr, err := ReadRequest(server, hash, make([]byte, 64))
+	assert.Nil(t, err)
+	assert.Equal(t, CmdConnect, cmd)
+	assert.Equal(t, "www.example.com:443", addr.String())
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(server, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestReadRequestAuthFailed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		conn := NewClientConn(client, Hash("wrong"))
+		addr, _ := address.ParseAddress("127.0.0.1:80", make([]byte, 64))
+		conn.Write(addr)
+	}()
+	_, _, err := ReadRequest(server, Hash("password"), make([]byte, 64))
+	assert.ErrorIs(t, err, ErrAuthFailed)
+}
+
+func TestPacketConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	hash := Hash("password")
+	local, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	pc := NewClientPacketConn(local, &net.UDPAddr{}, hash, func(context.Context) (net.Conn, error) { return client, nil })
+	defer pc.Close()
+
+	addr, _ := address.ParseAddress("8.8.8.8:53", make([]byte, 64))
+	go func() {
+		pc.WriteTo(append(addr, []byte("query")...), nil)
+	}()
+
+	cmd, reqAddr, err := ReadRequest(server, hash, make([]byte, 64))
+	assert.Nil(t, err)
+	assert.Equal(t, CmdUDPAssociate, cmd)
+	assert.Equal(t, "8.8.8.8:53", reqAddr.String())
+
+	buf := make([]byte, 1024)
+	pktAddr, n, err := ReadPacket(server, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "8.8.8.8:53", pktAddr.String())
+	assert.Equal(t, "query", string(buf[len(pktAddr):n]))
+
+	go WritePacket(server, addr, []byte("answer"))
+	n, _, err = pc.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "answer", string(buf[len(addr):n]))
+	assert.Equal(t, addr.String(), address.Address(buf[:len(addr)]).String())
+}
+
+func TestReadRequestShortProbe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// the short probe is rejected without waiting for more bytes
+	go client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	_, _, err := ReadRequest(server, Hash("password"), make([]byte, 64))
+	assert.ErrorIs(t, err, ErrAuthFailed)
+}